@@ -8,5 +8,7 @@ export CGO_ENABLED=0
 ( cd $BASE_DIR && \
     go build -o bin/main main.go && \
     go build -o bin/create_users tools/create_users.go && \
-    go build -o bin/benchmark tools/benchmark.go \
+    go build -o bin/benchmark tools/benchmark.go && \
+    go build -o bin/check tools/check.go && \
+    go build -o bin/gateway tools/gateway.go \
 )
@@ -5,6 +5,9 @@ go 1.14
 require (
 	cs.utexas.edu/zjia/faas v0.0.0
 	cs.utexas.edu/zjia/faas/slib v0.0.0
+	github.com/alicebob/miniredis/v2 v2.14.3
+	github.com/go-redis/redis/v8 v8.11.4
+	github.com/go-sql-driver/mysql v1.5.0
 	github.com/golang/snappy v0.0.2 // indirect
 	github.com/montanaflynn/stats v0.6.3
 	go.mongodb.org/mongo-driver v1.4.6
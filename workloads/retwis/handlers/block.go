@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+
+	"cs.utexas.edu/zjia/faas/types"
+)
+
+// Posts of a user are not pushed to users it blocks, and blocked users
+// cannot follow it. Existing follow relations are kept.
+type BlockInput struct {
+	UserId    string `json:"userId"`
+	BlockeeId string `json:"blockeeId"`
+	Unblock   bool   `json:"unblock,omitempty"`
+}
+
+type BlockOutput struct {
+	Success      bool   `json:"success"`
+	Message      string `json:"message,omitempty"`
+	SessionToken string `json:"sessionToken,omitempty"`
+}
+
+type blockHandler struct {
+	store RetwisStore
+}
+
+func NewBlockHandler(store RetwisStore) types.FuncHandler {
+	return &blockHandler{store: store}
+}
+
+func (h *blockHandler) onRequest(ctx context.Context, input *BlockInput) (*BlockOutput, error) {
+	if input.UserId == input.BlockeeId {
+		return &BlockOutput{
+			Success: false,
+			Message: "userId and blockeeId cannot be same",
+		}, nil
+	}
+	return h.store.Block(ctx, input)
+}
+
+func (h *blockHandler) Call(ctx context.Context, input []byte) ([]byte, error) {
+	parsedInput := &BlockInput{}
+	err := json.Unmarshal(input, parsedInput)
+	if err != nil {
+		return nil, err
+	}
+	output, err := h.onRequest(ctx, parsedInput)
+	if err != nil {
+		return nil, err
+	}
+	if output.Success {
+		output.SessionToken, err = sessionToken(ctx, h.store)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(output)
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"cs.utexas.edu/zjia/faas/types"
+)
+
+type CheckInput struct {
+	MaxViolations int `json:"maxViolations,omitempty"`
+}
+
+// Success only tells the check finished. Violations lists at most
+// MaxViolations of all NumViolations found. NumPosts counts posts reachable
+// from post lists, which for SQL are all rows of the posts table.
+type CheckOutput struct {
+	Success       bool     `json:"success"`
+	Message       string   `json:"message,omitempty"`
+	NumUsers      int      `json:"numUsers"`
+	NumPosts      int      `json:"numPosts"`
+	NumViolations int      `json:"numViolations"`
+	Violations    []string `json:"violations,omitempty"`
+}
+
+const kDefaultMaxViolations = 100
+
+func (o *CheckOutput) addViolation(maxViolations int, format string, args ...interface{}) {
+	o.NumViolations++
+	if len(o.Violations) < maxViolations {
+		o.Violations = append(o.Violations, fmt.Sprintf(format, args...))
+	}
+}
+
+type checkHandler struct {
+	store RetwisStore
+}
+
+func NewCheckHandler(store RetwisStore) types.FuncHandler {
+	return &checkHandler{store: store}
+}
+
+func (h *checkHandler) onRequest(ctx context.Context, input *CheckInput) (*CheckOutput, error) {
+	checker, ok := h.store.(Checker)
+	if !ok {
+		return &CheckOutput{
+			Success: false,
+			Message: kNotSupportedMessage,
+		}, nil
+	}
+	if input.MaxViolations <= 0 {
+		input.MaxViolations = kDefaultMaxViolations
+	}
+	return checker.Check(ctx, input)
+}
+
+func (h *checkHandler) Call(ctx context.Context, input []byte) ([]byte, error) {
+	parsedInput := &CheckInput{}
+	err := json.Unmarshal(input, parsedInput)
+	if err != nil {
+		return nil, err
+	}
+	output, err := h.onRequest(ctx, parsedInput)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(output)
+}
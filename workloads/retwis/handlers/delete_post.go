@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+
+	"cs.utexas.edu/zjia/faas/types"
+)
+
+// Only the author can delete a post. The post is removed from the timeline
+// and from post lists of users it was pushed to.
+type DeletePostInput struct {
+	UserId string `json:"userId"`
+	PostId string `json:"postId"`
+}
+
+type DeletePostOutput struct {
+	Success      bool   `json:"success"`
+	Message      string `json:"message,omitempty"`
+	SessionToken string `json:"sessionToken,omitempty"`
+}
+
+type deletePostHandler struct {
+	store RetwisStore
+}
+
+func NewDeletePostHandler(store RetwisStore) types.FuncHandler {
+	return &deletePostHandler{store: store}
+}
+
+func (h *deletePostHandler) onRequest(ctx context.Context, input *DeletePostInput) (*DeletePostOutput, error) {
+	if input.UserId == "" {
+		return &DeletePostOutput{
+			Success: false,
+			Message: "userId cannot be empty",
+		}, nil
+	}
+	updater, ok := h.store.(PostUpdater)
+	if !ok {
+		return &DeletePostOutput{
+			Success: false,
+			Message: kNotSupportedMessage,
+		}, nil
+	}
+	return updater.DeletePost(ctx, input)
+}
+
+func (h *deletePostHandler) Call(ctx context.Context, input []byte) ([]byte, error) {
+	parsedInput := &DeletePostInput{}
+	err := json.Unmarshal(input, parsedInput)
+	if err != nil {
+		return nil, err
+	}
+	output, err := h.onRequest(ctx, parsedInput)
+	if err != nil {
+		return nil, err
+	}
+	if output.Success {
+		output.SessionToken, err = sessionToken(ctx, h.store)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(output)
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+
+	"cs.utexas.edu/zjia/faas/types"
+)
+
+// Only the author can edit a post. Previous bodies are kept as version history.
+type EditPostInput struct {
+	UserId string `json:"userId"`
+	PostId string `json:"postId"`
+	Body   string `json:"body"`
+}
+
+type EditPostOutput struct {
+	Success      bool   `json:"success"`
+	Message      string `json:"message,omitempty"`
+	Version      int    `json:"version,omitempty"`
+	SessionToken string `json:"sessionToken,omitempty"`
+}
+
+type editPostHandler struct {
+	store RetwisStore
+}
+
+func NewEditPostHandler(store RetwisStore) types.FuncHandler {
+	return &editPostHandler{store: store}
+}
+
+func (h *editPostHandler) onRequest(ctx context.Context, input *EditPostInput) (*EditPostOutput, error) {
+	if input.UserId == "" {
+		return &EditPostOutput{
+			Success: false,
+			Message: "userId cannot be empty",
+		}, nil
+	}
+	updater, ok := h.store.(PostUpdater)
+	if !ok {
+		return &EditPostOutput{
+			Success: false,
+			Message: kNotSupportedMessage,
+		}, nil
+	}
+	return updater.EditPost(ctx, input)
+}
+
+func (h *editPostHandler) Call(ctx context.Context, input []byte) ([]byte, error) {
+	parsedInput := &EditPostInput{}
+	err := json.Unmarshal(input, parsedInput)
+	if err != nil {
+		return nil, err
+	}
+	output, err := h.onRequest(ctx, parsedInput)
+	if err != nil {
+		return nil, err
+	}
+	if output.Success {
+		output.SessionToken, err = sessionToken(ctx, h.store)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(output)
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	"cs.utexas.edu/zjia/faas/types"
+)
+
+// Cursor of a follower or followee list is the last user id of the previous
+// page. Lists are ordered by user id.
+type FollowListInput struct {
+	UserId       string `json:"userId"`
+	Cursor       string `json:"cursor,omitempty"`
+	PageSize     int    `json:"pageSize,omitempty"`
+	SessionToken string `json:"sessionToken,omitempty"`
+}
+
+type FollowListOutput struct {
+	Success    bool     `json:"success"`
+	Message    string   `json:"message,omitempty"`
+	UserIds    []string `json:"userIds,omitempty"`
+	NextCursor string   `json:"nextCursor,omitempty"`
+}
+
+// pageUserIds sorts userIds, and returns the page after cursor
+func pageUserIds(userIds []string, cursor string, pageSize int) *FollowListOutput {
+	sort.Strings(userIds)
+	start := sort.SearchStrings(userIds, cursor)
+	if start < len(userIds) && userIds[start] == cursor {
+		start++
+	}
+	output := &FollowListOutput{Success: true}
+	if end := start + pageSize; end < len(userIds) {
+		output.UserIds = userIds[start:end]
+		output.NextCursor = userIds[end-1]
+	} else {
+		output.UserIds = userIds[start:]
+	}
+	return output
+}
+
+type followListHandler struct {
+	store     RetwisStore
+	followees bool
+}
+
+func NewFollowersHandler(store RetwisStore) types.FuncHandler {
+	return &followListHandler{store: store, followees: false}
+}
+
+func NewFolloweesHandler(store RetwisStore) types.FuncHandler {
+	return &followListHandler{store: store, followees: true}
+}
+
+func (h *followListHandler) Call(ctx context.Context, input []byte) ([]byte, error) {
+	parsedInput := &FollowListInput{}
+	err := json.Unmarshal(input, parsedInput)
+	if err != nil {
+		return nil, err
+	}
+	if message, err := waitForSession(ctx, h.store, parsedInput.SessionToken); err != nil {
+		return nil, err
+	} else if message != "" {
+		return json.Marshal(&FollowListOutput{Success: false, Message: message})
+	}
+	var output *FollowListOutput
+	if h.followees {
+		output, err = h.store.Followees(ctx, parsedInput)
+	} else {
+		output, err = h.store.Followers(ctx, parsedInput)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(output)
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+
+	"cs.utexas.edu/zjia/faas/types"
+)
+
+type LikePostInput struct {
+	UserId string `json:"userId"`
+	PostId string `json:"postId"`
+	Unlike bool   `json:"unlike,omitempty"`
+}
+
+type LikePostOutput struct {
+	Success      bool   `json:"success"`
+	Message      string `json:"message,omitempty"`
+	NumLikes     int    `json:"numLikes"`
+	SessionToken string `json:"sessionToken,omitempty"`
+}
+
+type likePostHandler struct {
+	store RetwisStore
+}
+
+func NewLikePostHandler(store RetwisStore) types.FuncHandler {
+	return &likePostHandler{store: store}
+}
+
+func (h *likePostHandler) onRequest(ctx context.Context, input *LikePostInput) (*LikePostOutput, error) {
+	updater, ok := h.store.(PostUpdater)
+	if !ok {
+		return &LikePostOutput{
+			Success: false,
+			Message: kNotSupportedMessage,
+		}, nil
+	}
+	return updater.LikePost(ctx, input)
+}
+
+func (h *likePostHandler) Call(ctx context.Context, input []byte) ([]byte, error) {
+	parsedInput := &LikePostInput{}
+	err := json.Unmarshal(input, parsedInput)
+	if err != nil {
+		return nil, err
+	}
+	output, err := h.onRequest(ctx, parsedInput)
+	if err != nil {
+		return nil, err
+	}
+	if output.Success {
+		output.SessionToken, err = sessionToken(ctx, h.store)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(output)
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+
+	"cs.utexas.edu/zjia/faas/types"
+)
+
+// Cursor of a conversation list is the peer id of the last conversation of
+// the previous page. A conversation getting a new message moves to the
+// front, so it may be listed again, or, if it was after the cursor, only
+// appear when the list is read again from the first page.
+type ListConversationsInput struct {
+	UserId       string `json:"userId"`
+	Cursor       string `json:"cursor,omitempty"`
+	PageSize     int    `json:"pageSize,omitempty"`
+	SessionToken string `json:"sessionToken,omitempty"`
+}
+
+type ConversationSummary struct {
+	PeerId    string `json:"peerId"`
+	NumUnread int    `json:"numUnread"`
+}
+
+// Conversations are ordered by their latest message, most recent first.
+// NumUnread counts unread messages across all conversations of the user.
+type ListConversationsOutput struct {
+	Success       bool                  `json:"success"`
+	Message       string                `json:"message,omitempty"`
+	Conversations []ConversationSummary `json:"conversations,omitempty"`
+	NumUnread     int                   `json:"numUnread"`
+	NextCursor    string                `json:"nextCursor,omitempty"`
+}
+
+type listConversationsHandler struct {
+	store RetwisStore
+}
+
+func NewListConversationsHandler(store RetwisStore) types.FuncHandler {
+	return &listConversationsHandler{store: store}
+}
+
+func (h *listConversationsHandler) onRequest(ctx context.Context, input *ListConversationsInput) (*ListConversationsOutput, error) {
+	messenger, ok := h.store.(Messenger)
+	if !ok {
+		return &ListConversationsOutput{
+			Success: false,
+			Message: kNotSupportedMessage,
+		}, nil
+	}
+	if message, err := waitForSession(ctx, h.store, input.SessionToken); err != nil {
+		return nil, err
+	} else if message != "" {
+		return &ListConversationsOutput{Success: false, Message: message}, nil
+	}
+	return messenger.ListConversations(ctx, input)
+}
+
+func (h *listConversationsHandler) Call(ctx context.Context, input []byte) ([]byte, error) {
+	parsedInput := &ListConversationsInput{}
+	err := json.Unmarshal(input, parsedInput)
+	if err != nil {
+		return nil, err
+	}
+	output, err := h.onRequest(ctx, parsedInput)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(output)
+}
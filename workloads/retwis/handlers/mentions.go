@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+
+	"cs.utexas.edu/zjia/faas/types"
+)
+
+// Posts mentioning the user, newest first
+type MentionsInput struct {
+	UserId       string `json:"userId"`
+	Cursor       string `json:"cursor,omitempty"`
+	PageSize     int    `json:"pageSize,omitempty"`
+	SessionToken string `json:"sessionToken,omitempty"`
+}
+
+type mentionsHandler struct {
+	store RetwisStore
+}
+
+func NewMentionsHandler(store RetwisStore) types.FuncHandler {
+	return &mentionsHandler{store: store}
+}
+
+func (h *mentionsHandler) onRequest(ctx context.Context, input *MentionsInput) (*PostListOutput, error) {
+	index, ok := h.store.(PostIndex)
+	if !ok {
+		return &PostListOutput{
+			Success: false,
+			Message: kNotSupportedMessage,
+		}, nil
+	}
+	if message, err := waitForSession(ctx, h.store, input.SessionToken); err != nil {
+		return nil, err
+	} else if message != "" {
+		return &PostListOutput{Success: false, Message: message}, nil
+	}
+	return index.Mentions(ctx, input)
+}
+
+func (h *mentionsHandler) Call(ctx context.Context, input []byte) ([]byte, error) {
+	parsedInput := &MentionsInput{}
+	err := json.Unmarshal(input, parsedInput)
+	if err != nil {
+		return nil, err
+	}
+	output, err := h.onRequest(ctx, parsedInput)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(output)
+}
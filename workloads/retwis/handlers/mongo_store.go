@@ -0,0 +1,425 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+
+	"cs.utexas.edu/zjia/faas-retwis/utils"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoStore struct {
+	client *mongo.Client
+}
+
+func newMongoStore(client *mongo.Client) *mongoStore {
+	return &mongoStore{client: client}
+}
+
+var errMongoBlocked = errors.New("Blocked by followee")
+
+func (s *mongoStore) Init(ctx context.Context) error {
+	db := s.client.Database("retwis")
+
+	if err := utils.MongoCreateCounter(ctx, db, "next_user_id"); err != nil {
+		return err
+	}
+
+	if err := utils.MongoCreateIndex(ctx, db.Collection("users"), "userId", true /* unique */); err != nil {
+		return err
+	}
+
+	if err := utils.MongoCreateIndex(ctx, db.Collection("users"), "username", true /* unique */); err != nil {
+		return err
+	}
+
+	if err := utils.MongoCreateIndex(ctx, db.Collection("user_posts"), "userId", false /* unique */); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *mongoStore) RegisterUser(ctx context.Context, input *RegisterInput) (*RegisterOutput, error) {
+	sess, err := s.client.StartSession(options.Session())
+	if err != nil {
+		return nil, err
+	}
+	defer sess.EndSession(ctx)
+
+	userId, err := sess.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		db := s.client.Database("retwis")
+		userIdValue, err := utils.MongoFetchAddCounter(sessCtx, db, "next_user_id", 1)
+		if err != nil {
+			return nil, err
+		}
+
+		userId := fmt.Sprintf("%08x", userIdValue)
+		userBson := bson.D{
+			{"userId", userId},
+			{"username", input.UserName},
+			{"password", input.Password},
+			{"auth", fmt.Sprintf("%016x", rand.Uint64())},
+			{"followers", bson.D{}},
+			{"followees", bson.D{}},
+			{"blocked", bson.D{}},
+			{"posts", bson.A{}},
+		}
+		if _, err := db.Collection("users").InsertOne(sessCtx, userBson); err != nil {
+			return nil, err
+		}
+
+		return userId, nil
+	}, utils.MongoTxnOptions())
+
+	if err != nil {
+		return &RegisterOutput{
+			Success: false,
+			Message: fmt.Sprintf("Mongo failed: %v", err),
+		}, nil
+	}
+
+	return &RegisterOutput{
+		Success: true,
+		UserId:  userId.(string),
+	}, nil
+}
+
+func (s *mongoStore) Login(ctx context.Context, input *LoginInput) (*LoginOutput, error) {
+	db := s.client.Database("retwis")
+
+	var user bson.M
+	if err := db.Collection("users").FindOne(ctx, bson.D{{"username", input.UserName}}).Decode(&user); err != nil {
+		return &LoginOutput{
+			Success: false,
+			Message: fmt.Sprintf("Mongo failed: %v", err),
+		}, nil
+	}
+
+	if input.Password != user["password"].(string) {
+		return &LoginOutput{
+			Success: false,
+			Message: "Incorrect password",
+		}, nil
+	}
+	return &LoginOutput{
+		Success: true,
+		UserId:  user["userId"].(string),
+		Auth:    user["auth"].(string),
+	}, nil
+}
+
+func (s *mongoStore) Follow(ctx context.Context, input *FollowInput) (*FollowOutput, error) {
+	sess, err := s.client.StartSession(options.Session())
+	if err != nil {
+		return nil, err
+	}
+	defer sess.EndSession(ctx)
+
+	_, err = sess.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		coll := s.client.Database("retwis").Collection("users")
+		user1Filter := bson.D{{"userId", input.UserId}}
+		user2Filter := bson.D{{"userId", input.FolloweeId}}
+		if !input.Unfollow {
+			blockedFilter := bson.D{
+				{"userId", input.FolloweeId},
+				{fmt.Sprintf("blocked.%s", input.UserId), true},
+			}
+			if count, err := coll.CountDocuments(sessCtx, blockedFilter); err != nil {
+				return nil, err
+			} else if count > 0 {
+				return nil, errMongoBlocked
+			}
+		}
+		var user1Update bson.D
+		var user2Update bson.D
+		if input.Unfollow {
+			user1Update = bson.D{{"$unset", bson.D{{fmt.Sprintf("followees.%s", input.FolloweeId), ""}}}}
+			user2Update = bson.D{{"$unset", bson.D{{fmt.Sprintf("followers.%s", input.UserId), ""}}}}
+		} else {
+			user1Update = bson.D{{"$set", bson.D{{fmt.Sprintf("followees.%s", input.FolloweeId), true}}}}
+			user2Update = bson.D{{"$set", bson.D{{fmt.Sprintf("followers.%s", input.UserId), true}}}}
+		}
+		if _, err := coll.UpdateOne(sessCtx, user1Filter, user1Update); err != nil {
+			return nil, err
+		}
+		if _, err := coll.UpdateOne(sessCtx, user2Filter, user2Update); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}, utils.MongoTxnOptions())
+
+	if err == errMongoBlocked {
+		return &FollowOutput{
+			Success: false,
+			Message: fmt.Sprintf("User %s has blocked user %s", input.FolloweeId, input.UserId),
+		}, nil
+	} else if err != nil {
+		return &FollowOutput{
+			Success: false,
+			Message: fmt.Sprintf("Mongo failed: %v", err),
+		}, nil
+	}
+	return &FollowOutput{
+		Success: true,
+	}, nil
+}
+
+func (s *mongoStore) followList(ctx context.Context, input *FollowListInput, field string) (*FollowListOutput, error) {
+	db := s.client.Database("retwis")
+
+	var user bson.M
+	if err := db.Collection("users").FindOne(ctx, bson.D{{"userId", input.UserId}}).Decode(&user); err != nil {
+		return &FollowListOutput{
+			Success: false,
+			Message: fmt.Sprintf("Mongo failed: %v", err),
+		}, nil
+	}
+
+	userIds := make([]string, 0)
+	if value, ok := user[field].(bson.M); ok {
+		for userId, _ := range value {
+			userIds = append(userIds, userId)
+		}
+	}
+	return pageUserIds(userIds, input.Cursor, clampPageSize(input.PageSize)), nil
+}
+
+func (s *mongoStore) Followers(ctx context.Context, input *FollowListInput) (*FollowListOutput, error) {
+	return s.followList(ctx, input, "followers")
+}
+
+func (s *mongoStore) Followees(ctx context.Context, input *FollowListInput) (*FollowListOutput, error) {
+	return s.followList(ctx, input, "followees")
+}
+
+func (s *mongoStore) Block(ctx context.Context, input *BlockInput) (*BlockOutput, error) {
+	coll := s.client.Database("retwis").Collection("users")
+
+	var update bson.D
+	if input.Unblock {
+		update = bson.D{{"$unset", bson.D{{fmt.Sprintf("blocked.%s", input.BlockeeId), ""}}}}
+	} else {
+		update = bson.D{{"$set", bson.D{{fmt.Sprintf("blocked.%s", input.BlockeeId), true}}}}
+	}
+	result, err := coll.UpdateOne(ctx, bson.D{{"userId", input.UserId}}, update)
+	if err != nil {
+		return &BlockOutput{
+			Success: false,
+			Message: fmt.Sprintf("Mongo failed: %v", err),
+		}, nil
+	} else if result.MatchedCount == 0 {
+		return &BlockOutput{
+			Success: false,
+			Message: fmt.Sprintf("Cannot find user with ID %s", input.UserId),
+		}, nil
+	}
+	return &BlockOutput{Success: true}, nil
+}
+
+func (s *mongoStore) Post(ctx context.Context, input *PostInput) (*PostOutput, error) {
+	sess, err := s.client.StartSession(options.Session())
+	if err != nil {
+		return nil, err
+	}
+	defer sess.EndSession(ctx)
+
+	db := s.client.Database("retwis")
+
+	_, err = sess.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		postColl := db.Collection("posts")
+		usersColl := db.Collection("users")
+		userPostsColl := db.Collection("user_posts")
+
+		var user bson.M
+		if err := usersColl.FindOne(sessCtx, bson.D{{"userId", input.UserId}}).Decode(&user); err != nil {
+			return nil, err
+		}
+
+		postBson := bson.D{
+			{"userId", input.UserId},
+			{"userName", user["username"].(string)},
+			{"body", input.Body},
+		}
+		var postId primitive.ObjectID
+		if result, err := postColl.InsertOne(sessCtx, postBson); err != nil {
+			return nil, err
+		} else {
+			postId = result.InsertedID.(primitive.ObjectID)
+		}
+
+		if value, ok := user["followers"].(bson.M); ok {
+			blocked, _ := user["blocked"].(bson.M)
+			followers := make([]string, 0, 4)
+			for follower, _ := range value {
+				if _, exists := blocked[follower]; !exists {
+					followers = append(followers, follower)
+				}
+			}
+			rand.Shuffle(len(followers), func(i, j int) {
+				followers[i], followers[j] = followers[j], followers[i]
+			})
+			if len(followers) > kMaxNotifyUsers {
+				followers = followers[0:kMaxNotifyUsers]
+			}
+			update := bson.M{
+				"$push": bson.M{
+					"posts": bson.M{
+						"$each":  bson.A{postId},
+						"$slice": -kUserPostListLimit,
+					},
+				},
+			}
+			for _, follower := range followers {
+				_, err := usersColl.UpdateOne(sessCtx, bson.D{{"userId", follower}}, update)
+				if err != nil {
+					return nil, err
+				}
+				_, err = userPostsColl.InsertOne(sessCtx, bson.D{{"userId", follower}, {"postId", postId}})
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		return nil, nil
+	}, utils.MongoTxnOptions())
+
+	if err != nil {
+		return &PostOutput{
+			Success: false,
+			Message: fmt.Sprintf("Mongo failed: %v", err),
+		}, nil
+	}
+
+	return &PostOutput{Success: true}, nil
+}
+
+// The capped "posts" array of a user only backs Profile. Post lists are read
+// from "user_posts", which keeps every post pushed to a user, and cursors
+// carry the ObjectID of the last returned document.
+func (s *mongoStore) PostList(ctx context.Context, input *PostListInput) (*PostListOutput, error) {
+	var cursorId primitive.ObjectID
+	if cursor, err := decodePostListCursor(input.Cursor); err != nil {
+		return &PostListOutput{
+			Success: false,
+			Message: "Invalid cursor",
+		}, nil
+	} else if cursor != nil {
+		if cursorId, err = primitive.ObjectIDFromHex(cursor.PostId); err != nil {
+			return &PostListOutput{
+				Success: false,
+				Message: "Invalid cursor",
+			}, nil
+		}
+	}
+
+	sess, err := s.client.StartSession(options.Session())
+	if err != nil {
+		return nil, err
+	}
+	defer sess.EndSession(ctx)
+
+	db := s.client.Database("retwis")
+	pageSize := clampPageSize(input.PageSize)
+	var lastId primitive.ObjectID
+
+	posts, err := sess.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		postColl := db.Collection("posts")
+		userPostsColl := db.Collection("user_posts")
+		posts := make([]interface{}, 0, pageSize)
+
+		filter := bson.D{}
+		coll := postColl
+		if input.UserId != "" {
+			filter = append(filter, bson.E{"userId", input.UserId})
+			coll = userPostsColl
+		}
+		opts := options.Find()
+		opts.SetSort(bson.D{{"_id", -1}})
+		opts.SetLimit(int64(pageSize))
+		if cursorId.IsZero() {
+			opts.SetSkip(int64(input.Skip))
+		} else {
+			filter = append(filter, bson.E{"_id", bson.D{{"$lt", cursorId}}})
+		}
+		cursor, err := coll.Find(sessCtx, filter, opts)
+		if err != nil {
+			return nil, err
+		}
+		var results []bson.M
+		err = cursor.All(sessCtx, &results)
+		if err != nil {
+			return nil, err
+		}
+		for _, result := range results {
+			lastId = result["_id"].(primitive.ObjectID)
+			post := result
+			if input.UserId != "" {
+				post = nil
+				err := postColl.FindOne(sessCtx, bson.D{{"_id", result["postId"]}}).Decode(&post)
+				if err != nil {
+					return nil, err
+				}
+			}
+			posts = append(posts, map[string]string{
+				"id":     post["_id"].(primitive.ObjectID).Hex(),
+				"userId": post["userId"].(string),
+				"body":   post["body"].(string),
+				"user":   post["userName"].(string),
+			})
+		}
+
+		return posts, nil
+	}, utils.MongoTxnOptions())
+
+	if err != nil {
+		return &PostListOutput{
+			Success: false,
+			Message: fmt.Sprintf("Mongo failed: %v", err),
+		}, nil
+	}
+
+	output := &PostListOutput{
+		Success: true,
+		Posts:   posts.([]interface{}),
+	}
+	if len(output.Posts) == pageSize {
+		output.NextCursor = encodePostListCursor(0, lastId.Hex())
+	}
+	return output, nil
+}
+
+func (s *mongoStore) Profile(ctx context.Context, input *ProfileInput) (*ProfileOutput, error) {
+	db := s.client.Database("retwis")
+
+	var user bson.M
+	if err := db.Collection("users").FindOne(ctx, bson.D{{"userId", input.UserId}}).Decode(&user); err != nil {
+		return &ProfileOutput{
+			Success: false,
+			Message: fmt.Sprintf("Mongo failed: %v", err),
+		}, nil
+	}
+
+	output := &ProfileOutput{Success: true}
+	if value, ok := user["username"].(string); ok {
+		output.UserName = value
+	}
+	if value, ok := user["followers"].(bson.M); ok {
+		output.NumFollowers = len(value)
+	}
+	if value, ok := user["followees"].(bson.M); ok {
+		output.NumFollowees = len(value)
+	}
+	if value, ok := user["posts"].(bson.A); ok {
+		output.NumPosts = len(value)
+	}
+
+	return output, nil
+}
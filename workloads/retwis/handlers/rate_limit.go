@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"cs.utexas.edu/zjia/faas/slib/statestore"
+)
+
+// Requests rejected by the rate limiter reply with this message
+const kRateLimitedMessage = "Rate limit exceeded"
+
+// rateLimit configures per-user token buckets: each user gets Rate tokens per
+// second, and can save up to Burst tokens. Every RetwisPost or RetwisFollow
+// takes one token.
+type rateLimit struct {
+	Rate  float64
+	Burst float64
+}
+
+// getRateLimit reads RETWIS_RATE_LIMIT (tokens per second) and
+// RETWIS_RATE_BURST (defaults to the rate). It returns nil if rate limiting
+// is disabled, which is the default.
+func getRateLimit() *rateLimit {
+	value, exists := os.LookupEnv("RETWIS_RATE_LIMIT")
+	if !exists {
+		return nil
+	}
+	rate, err := strconv.ParseFloat(value, 64)
+	if err != nil || rate <= 0 {
+		log.Printf("[WARN] Ignore invalid RETWIS_RATE_LIMIT: %s", value)
+		return nil
+	}
+	burst := rate
+	if value, exists := os.LookupEnv("RETWIS_RATE_BURST"); exists {
+		if parsed, err := strconv.ParseFloat(value, 64); err == nil && parsed >= 1 {
+			burst = parsed
+		} else {
+			log.Printf("[WARN] Ignore invalid RETWIS_RATE_BURST: %s", value)
+		}
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimit{Rate: rate, Burst: burst}
+}
+
+// slibTakeToken takes a token from the bucket of userId within txn. The
+// bucket lives in "ratelimit:<userId>", so all function instances share it.
+// As the bucket is updated by the transaction of the request, a token is only
+// consumed if the request commits. It returns false if the bucket is empty,
+// in which case the caller should abort txn.
+func slibTakeToken(txn statestore.Env, limit *rateLimit, userId string) bool {
+	bucketObj := txn.Object(fmt.Sprintf("ratelimit:%s", userId))
+	now := float64(time.Now().UnixNano()) / float64(time.Second)
+	tokens := limit.Burst
+	if value, _ := bucketObj.Get("tokens"); !value.IsNull() {
+		tokens = value.AsNumber()
+		if value, _ := bucketObj.Get("updatedAt"); !value.IsNull() && now > value.AsNumber() {
+			tokens += (now - value.AsNumber()) * limit.Rate
+		}
+		if tokens > limit.Burst {
+			tokens = limit.Burst
+		}
+	}
+	if tokens < 1 {
+		return false
+	}
+	bucketObj.SetNumber("tokens", tokens-1)
+	bucketObj.SetNumber("updatedAt", now)
+	return true
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+
+	"cs.utexas.edu/zjia/faas/types"
+)
+
+// Reading a conversation marks all its messages read for UserId. Cursor works
+// like the one of post lists, and pages go from newer to older messages.
+type ReadConversationInput struct {
+	UserId       string `json:"userId"`
+	PeerId       string `json:"peerId"`
+	Cursor       string `json:"cursor,omitempty"`
+	PageSize     int    `json:"pageSize,omitempty"`
+	SessionToken string `json:"sessionToken,omitempty"`
+}
+
+type ReadConversationOutput struct {
+	Success      bool          `json:"success"`
+	Message      string        `json:"message,omitempty"`
+	Messages     []interface{} `json:"messages,omitempty"`
+	NextCursor   string        `json:"nextCursor,omitempty"`
+	NumRead      int           `json:"numRead"`
+	SessionToken string        `json:"sessionToken,omitempty"`
+}
+
+type readConversationHandler struct {
+	store RetwisStore
+}
+
+func NewReadConversationHandler(store RetwisStore) types.FuncHandler {
+	return &readConversationHandler{store: store}
+}
+
+func (h *readConversationHandler) onRequest(ctx context.Context, input *ReadConversationInput) (*ReadConversationOutput, error) {
+	messenger, ok := h.store.(Messenger)
+	if !ok {
+		return &ReadConversationOutput{
+			Success: false,
+			Message: kNotSupportedMessage,
+		}, nil
+	}
+	if input.UserId == input.PeerId {
+		return &ReadConversationOutput{
+			Success: false,
+			Message: "userId and peerId cannot be same",
+		}, nil
+	}
+	if message, err := waitForSession(ctx, h.store, input.SessionToken); err != nil {
+		return nil, err
+	} else if message != "" {
+		return &ReadConversationOutput{Success: false, Message: message}, nil
+	}
+	return messenger.ReadConversation(ctx, input)
+}
+
+func (h *readConversationHandler) Call(ctx context.Context, input []byte) ([]byte, error) {
+	parsedInput := &ReadConversationInput{}
+	err := json.Unmarshal(input, parsedInput)
+	if err != nil {
+		return nil, err
+	}
+	output, err := h.onRequest(ctx, parsedInput)
+	if err != nil {
+		return nil, err
+	}
+	if output.Success && output.NumRead > 0 {
+		output.SessionToken, err = sessionToken(ctx, h.store)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(output)
+}
@@ -0,0 +1,478 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Key layout follows the classic Redis Retwis example:
+//
+//	username:<name>  -> user id
+//	user:<id>        -> hash of username, password, auth
+//	followers:<id>   -> set of follower ids
+//	followees:<id>   -> set of followee ids
+//	blocked:<id>     -> set of user ids blocked by this user
+//	posts:<id>       -> sorted set of post ids pushed to this user
+//	archive:<id>     -> sorted set of post ids evicted from posts:<id>
+//	post:<postId>    -> hash of id, userId, userName, body
+//	timeline         -> sorted set of most recent post ids
+//
+// Sorted sets are scored by the post sequence number from next_post_id.
+type redisStore struct {
+	client *redis.Client
+}
+
+func newRedisStore(client *redis.Client) *redisStore {
+	return &redisStore{client: client}
+}
+
+var kRedisRegisterScript = redis.NewScript(`
+if redis.call('SETNX', KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('HMSET', KEYS[2], 'username', ARGV[2], 'password', ARGV[3], 'auth', ARGV[4])
+return 1
+`)
+
+// Returns 1 (or 2) if the user (or followee) does not exist, 3 if the
+// followee blocks the user, otherwise 0.
+var kRedisFollowScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 1
+end
+if redis.call('EXISTS', KEYS[2]) == 0 then
+	return 2
+end
+if ARGV[3] ~= '1' and redis.call('SISMEMBER', KEYS[5], ARGV[1]) == 1 then
+	return 3
+end
+if ARGV[3] == '1' then
+	redis.call('SREM', KEYS[3], ARGV[2])
+	redis.call('SREM', KEYS[4], ARGV[1])
+else
+	redis.call('SADD', KEYS[3], ARGV[2])
+	redis.call('SADD', KEYS[4], ARGV[1])
+end
+return 0
+`)
+
+var kRedisBlockScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 1
+end
+if redis.call('EXISTS', KEYS[2]) == 0 then
+	return 2
+end
+if ARGV[2] == '1' then
+	redis.call('SREM', KEYS[3], ARGV[1])
+else
+	redis.call('SADD', KEYS[3], ARGV[1])
+end
+return 0
+`)
+
+// Follower post lists are derived from members of KEYS[2], so they cannot be
+// declared as KEYS. This is fine for a single Redis instance, but the script
+// is not compatible with Redis Cluster.
+//
+// Before Redis 7, the Lua PRNG is reseeded the same way for every script
+// call, so the fan-out sample is seeded from ARGV[8] instead.
+var kRedisPostScript = redis.NewScript(`
+local userName = redis.call('HGET', KEYS[1], 'username')
+if not userName then
+	return 0
+end
+local seqnum = tonumber(ARGV[1])
+local postId = ARGV[2]
+redis.call('HMSET', KEYS[3], 'id', postId, 'userId', ARGV[3], 'userName', userName, 'body', ARGV[4])
+local followers = redis.call('SDIFF', KEYS[2], KEYS[5])
+local numNotify = math.min(#followers, tonumber(ARGV[5]))
+math.randomseed(tonumber(ARGV[8]))
+for i = 1, numNotify do
+	local j = math.random(i, #followers)
+	followers[i], followers[j] = followers[j], followers[i]
+end
+for i = 1, numNotify do
+	local follower = followers[i]
+	local key = 'posts:' .. follower
+	redis.call('ZADD', key, seqnum, postId)
+	local evicted = redis.call('ZRANGE', key, 0, -tonumber(ARGV[6]) - 1, 'WITHSCORES')
+	for i = 1, #evicted, 2 do
+		redis.call('ZADD', 'archive:' .. follower, evicted[i + 1], evicted[i])
+	end
+	redis.call('ZREMRANGEBYRANK', key, 0, -tonumber(ARGV[6]) - 1)
+end
+redis.call('ZADD', KEYS[4], seqnum, postId)
+redis.call('ZREMRANGEBYRANK', KEYS[4], 0, -tonumber(ARGV[7]) - 1)
+return 1
+`)
+
+func (s *redisStore) Init(ctx context.Context) error {
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, "timeline")
+		pipe.Set(ctx, "next_user_id", 0, 0)
+		pipe.Set(ctx, "next_post_id", 0, 0)
+		return nil
+	})
+	return err
+}
+
+func (s *redisStore) RegisterUser(ctx context.Context, input *RegisterInput) (*RegisterOutput, error) {
+	userIdValue, err := s.client.Incr(ctx, "next_user_id").Result()
+	if err != nil {
+		return nil, err
+	}
+	userId := fmt.Sprintf("%08x", userIdValue-1)
+
+	created, err := kRedisRegisterScript.Run(ctx, s.client,
+		[]string{fmt.Sprintf("username:%s", input.UserName), fmt.Sprintf("user:%s", userId)},
+		userId, input.UserName, input.Password, fmt.Sprintf("%016x", rand.Uint64())).Int()
+	if err != nil {
+		return &RegisterOutput{
+			Success: false,
+			Message: fmt.Sprintf("Redis failed: %v", err),
+		}, nil
+	}
+	if created == 0 {
+		return &RegisterOutput{
+			Success: false,
+			Message: fmt.Sprintf("User name \"%s\" already exists", input.UserName),
+		}, nil
+	}
+
+	return &RegisterOutput{
+		Success: true,
+		UserId:  userId,
+	}, nil
+}
+
+func (s *redisStore) Login(ctx context.Context, input *LoginInput) (*LoginOutput, error) {
+	userId, err := s.client.Get(ctx, fmt.Sprintf("username:%s", input.UserName)).Result()
+	if err == redis.Nil {
+		return &LoginOutput{
+			Success: false,
+			Message: fmt.Sprintf("User name \"%s\" does not exists", input.UserName),
+		}, nil
+	} else if err != nil {
+		return &LoginOutput{
+			Success: false,
+			Message: fmt.Sprintf("Redis failed: %v", err),
+		}, nil
+	}
+
+	values, err := s.client.HMGet(ctx, fmt.Sprintf("user:%s", userId), "password", "auth").Result()
+	if err != nil {
+		return &LoginOutput{
+			Success: false,
+			Message: fmt.Sprintf("Redis failed: %v", err),
+		}, nil
+	}
+	if password, ok := values[0].(string); !ok {
+		return &LoginOutput{
+			Success: false,
+			Message: fmt.Sprintf("Cannot find user with ID %s", userId),
+		}, nil
+	} else if input.Password != password {
+		return &LoginOutput{
+			Success: false,
+			Message: "Incorrect password",
+		}, nil
+	}
+
+	output := &LoginOutput{Success: true, UserId: userId}
+	if auth, ok := values[1].(string); ok {
+		output.Auth = auth
+	}
+	return output, nil
+}
+
+func (s *redisStore) Follow(ctx context.Context, input *FollowInput) (*FollowOutput, error) {
+	unfollow := "0"
+	if input.Unfollow {
+		unfollow = "1"
+	}
+	result, err := kRedisFollowScript.Run(ctx, s.client,
+		[]string{
+			fmt.Sprintf("user:%s", input.UserId),
+			fmt.Sprintf("user:%s", input.FolloweeId),
+			fmt.Sprintf("followees:%s", input.UserId),
+			fmt.Sprintf("followers:%s", input.FolloweeId),
+			fmt.Sprintf("blocked:%s", input.FolloweeId),
+		},
+		input.UserId, input.FolloweeId, unfollow).Int()
+	if err != nil {
+		return &FollowOutput{
+			Success: false,
+			Message: fmt.Sprintf("Redis failed: %v", err),
+		}, nil
+	}
+
+	switch result {
+	case 1:
+		return &FollowOutput{
+			Success: false,
+			Message: fmt.Sprintf("Cannot find user with ID %s", input.UserId),
+		}, nil
+	case 2:
+		return &FollowOutput{
+			Success: false,
+			Message: fmt.Sprintf("Cannot find user with ID %s", input.FolloweeId),
+		}, nil
+	case 3:
+		return &FollowOutput{
+			Success: false,
+			Message: fmt.Sprintf("User %s has blocked user %s", input.FolloweeId, input.UserId),
+		}, nil
+	default:
+		return &FollowOutput{
+			Success: true,
+		}, nil
+	}
+}
+
+func (s *redisStore) followList(ctx context.Context, input *FollowListInput, key string) (*FollowListOutput, error) {
+	if exists, err := s.client.Exists(ctx, fmt.Sprintf("user:%s", input.UserId)).Result(); err != nil {
+		return &FollowListOutput{
+			Success: false,
+			Message: fmt.Sprintf("Redis failed: %v", err),
+		}, nil
+	} else if exists == 0 {
+		return &FollowListOutput{
+			Success: false,
+			Message: fmt.Sprintf("Cannot find user with ID %s", input.UserId),
+		}, nil
+	}
+	userIds, err := s.client.SMembers(ctx, key).Result()
+	if err != nil {
+		return &FollowListOutput{
+			Success: false,
+			Message: fmt.Sprintf("Redis failed: %v", err),
+		}, nil
+	}
+	return pageUserIds(userIds, input.Cursor, clampPageSize(input.PageSize)), nil
+}
+
+func (s *redisStore) Followers(ctx context.Context, input *FollowListInput) (*FollowListOutput, error) {
+	return s.followList(ctx, input, fmt.Sprintf("followers:%s", input.UserId))
+}
+
+func (s *redisStore) Followees(ctx context.Context, input *FollowListInput) (*FollowListOutput, error) {
+	return s.followList(ctx, input, fmt.Sprintf("followees:%s", input.UserId))
+}
+
+func (s *redisStore) Block(ctx context.Context, input *BlockInput) (*BlockOutput, error) {
+	unblock := "0"
+	if input.Unblock {
+		unblock = "1"
+	}
+	result, err := kRedisBlockScript.Run(ctx, s.client,
+		[]string{
+			fmt.Sprintf("user:%s", input.UserId),
+			fmt.Sprintf("user:%s", input.BlockeeId),
+			fmt.Sprintf("blocked:%s", input.UserId),
+		},
+		input.BlockeeId, unblock).Int()
+	if err != nil {
+		return &BlockOutput{
+			Success: false,
+			Message: fmt.Sprintf("Redis failed: %v", err),
+		}, nil
+	}
+
+	switch result {
+	case 1:
+		return &BlockOutput{
+			Success: false,
+			Message: fmt.Sprintf("Cannot find user with ID %s", input.UserId),
+		}, nil
+	case 2:
+		return &BlockOutput{
+			Success: false,
+			Message: fmt.Sprintf("Cannot find user with ID %s", input.BlockeeId),
+		}, nil
+	default:
+		return &BlockOutput{
+			Success: true,
+		}, nil
+	}
+}
+
+func (s *redisStore) Post(ctx context.Context, input *PostInput) (*PostOutput, error) {
+	seqnum, err := s.client.Incr(ctx, "next_post_id").Result()
+	if err != nil {
+		return nil, err
+	}
+	postId := fmt.Sprintf("%016x", seqnum)
+
+	posted, err := kRedisPostScript.Run(ctx, s.client,
+		[]string{
+			fmt.Sprintf("user:%s", input.UserId),
+			fmt.Sprintf("followers:%s", input.UserId),
+			fmt.Sprintf("post:%s", postId),
+			"timeline",
+			fmt.Sprintf("blocked:%s", input.UserId),
+		},
+		seqnum, postId, input.UserId, input.Body,
+		kMaxNotifyUsers, kUserPostListLimit, kTimeLinePostListLimit, rand.Int31()).Int()
+	if err != nil {
+		return &PostOutput{
+			Success: false,
+			Message: fmt.Sprintf("Redis failed: %v", err),
+		}, nil
+	}
+	if posted == 0 {
+		return &PostOutput{
+			Success: false,
+			Message: fmt.Sprintf("Cannot find user with ID %s", input.UserId),
+		}, nil
+	}
+
+	return &PostOutput{Success: true}, nil
+}
+
+// Cursors carry the score (post seqnum) of the last returned post. A user
+// post list continues into archive:<id> once posts:<id> is exhausted.
+func (s *redisStore) PostList(ctx context.Context, input *PostListInput) (*PostListOutput, error) {
+	cursor, err := decodePostListCursor(input.Cursor)
+	if err != nil {
+		return &PostListOutput{
+			Success: false,
+			Message: "Invalid cursor",
+		}, nil
+	}
+
+	postListKeys := []string{"timeline"}
+	if input.UserId != "" {
+		if exists, err := s.client.Exists(ctx, fmt.Sprintf("user:%s", input.UserId)).Result(); err != nil {
+			return &PostListOutput{
+				Success: false,
+				Message: fmt.Sprintf("Redis failed: %v", err),
+			}, nil
+		} else if exists == 0 {
+			return &PostListOutput{
+				Success: false,
+				Message: fmt.Sprintf("Cannot find user with ID %s", input.UserId),
+			}, nil
+		}
+		postListKeys = []string{
+			fmt.Sprintf("posts:%s", input.UserId),
+			fmt.Sprintf("archive:%s", input.UserId),
+		}
+	}
+
+	pageSize := clampPageSize(input.PageSize)
+	max := "+inf"
+	offset := int64(input.Skip)
+	if cursor != nil {
+		max = fmt.Sprintf("(%d", cursor.Seqnum)
+		offset = 0
+	}
+	entries := make([]redis.Z, 0, pageSize)
+	for _, key := range postListKeys {
+		if offset > 0 && len(entries) == 0 && key != postListKeys[0] {
+			// Skip went past the previous list, so only skip what remains
+			if n, err := s.client.ZCard(ctx, postListKeys[0]).Result(); err != nil {
+				return &PostListOutput{
+					Success: false,
+					Message: fmt.Sprintf("Redis failed: %v", err),
+				}, nil
+			} else if offset -= n; offset < 0 {
+				offset = 0
+			}
+		} else if len(entries) > 0 {
+			max = fmt.Sprintf("(%d", int64(entries[len(entries)-1].Score))
+			offset = 0
+		}
+		results, err := s.client.ZRevRangeByScoreWithScores(ctx, key, &redis.ZRangeBy{
+			Min:    "-inf",
+			Max:    max,
+			Offset: offset,
+			Count:  int64(pageSize - len(entries)),
+		}).Result()
+		if err != nil {
+			return &PostListOutput{
+				Success: false,
+				Message: fmt.Sprintf("Redis failed: %v", err),
+			}, nil
+		}
+		entries = append(entries, results...)
+		if len(entries) == pageSize {
+			break
+		}
+	}
+
+	cmds := make([]*redis.SliceCmd, 0, len(entries))
+	_, err = s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, entry := range entries {
+			cmds = append(cmds, pipe.HMGet(ctx, fmt.Sprintf("post:%s", entry.Member), "body", "userName", "userId"))
+		}
+		return nil
+	})
+	if err != nil {
+		return &PostListOutput{
+			Success: false,
+			Message: fmt.Sprintf("Redis failed: %v", err),
+		}, nil
+	}
+
+	output := &PostListOutput{
+		Success: true,
+		Posts:   make([]interface{}, 0, len(cmds)),
+	}
+	for i, cmd := range cmds {
+		values := cmd.Val()
+		post := make(map[string]string)
+		if body, ok := values[0].(string); ok {
+			post["body"] = body
+		}
+		if userName, ok := values[1].(string); ok {
+			post["user"] = userName
+		}
+		if len(post) > 0 {
+			if userId, ok := values[2].(string); ok {
+				post["userId"] = userId
+			}
+			post["id"] = fmt.Sprintf("%v", entries[i].Member)
+			output.Posts = append(output.Posts, post)
+		}
+	}
+	if len(entries) == pageSize {
+		last := entries[len(entries)-1]
+		output.NextCursor = encodePostListCursor(uint64(last.Score), fmt.Sprintf("%v", last.Member))
+	}
+	return output, nil
+}
+
+func (s *redisStore) Profile(ctx context.Context, input *ProfileInput) (*ProfileOutput, error) {
+	var userName *redis.StringCmd
+	var numFollowers, numFollowees, numPosts *redis.IntCmd
+	_, err := s.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		userName = pipe.HGet(ctx, fmt.Sprintf("user:%s", input.UserId), "username")
+		numFollowers = pipe.SCard(ctx, fmt.Sprintf("followers:%s", input.UserId))
+		numFollowees = pipe.SCard(ctx, fmt.Sprintf("followees:%s", input.UserId))
+		numPosts = pipe.ZCard(ctx, fmt.Sprintf("posts:%s", input.UserId))
+		return nil
+	})
+	if err == redis.Nil {
+		return &ProfileOutput{
+			Success: false,
+			Message: fmt.Sprintf("Cannot find user with ID %s", input.UserId),
+		}, nil
+	} else if err != nil {
+		return &ProfileOutput{
+			Success: false,
+			Message: fmt.Sprintf("Redis failed: %v", err),
+		}, nil
+	}
+
+	return &ProfileOutput{
+		Success:      true,
+		UserName:     userName.Val(),
+		NumFollowers: int(numFollowers.Val()),
+		NumFollowees: int(numFollowees.Val()),
+		NumPosts:     int(numPosts.Val()),
+	}, nil
+}
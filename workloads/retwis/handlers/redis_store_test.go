@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func newTestRedisStore(t *testing.T) *redisStore {
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Close)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	store := newRedisStore(client)
+	if err := store.Init(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func registerTestUser(t *testing.T, store *redisStore, name string) string {
+	output, err := store.RegisterUser(context.Background(), &RegisterInput{UserName: name, Password: "pw"})
+	if err != nil || !output.Success {
+		t.Fatalf("RegisterUser(%s) = %+v, %v", name, output, err)
+	}
+	return output.UserId
+}
+
+func TestRedisPostFanOut(t *testing.T) {
+	ctx := context.Background()
+	store := newTestRedisStore(t)
+	author := registerTestUser(t, store, "author")
+	const numFollowers = 4 * kMaxNotifyUsers
+	followers := make([]string, 0, numFollowers)
+	for i := 0; i < numFollowers; i++ {
+		follower := registerTestUser(t, store, fmt.Sprintf("follower%d", i))
+		output, err := store.Follow(ctx, &FollowInput{UserId: follower, FolloweeId: author})
+		if err != nil || !output.Success {
+			t.Fatalf("Follow = %+v, %v", output, err)
+		}
+		followers = append(followers, follower)
+	}
+
+	const numPosts = 16
+	for i := 0; i < numPosts; i++ {
+		output, err := store.Post(ctx, &PostInput{UserId: author, Body: fmt.Sprintf("post %d", i)})
+		if err != nil || !output.Success {
+			t.Fatalf("Post = %+v, %v", output, err)
+		}
+	}
+
+	timeline, err := store.PostList(ctx, &PostListInput{PageSize: numPosts})
+	if err != nil || !timeline.Success {
+		t.Fatalf("PostList = %+v, %v", timeline, err)
+	}
+	if len(timeline.Posts) != numPosts {
+		t.Errorf("timeline has %d posts, want %d", len(timeline.Posts), numPosts)
+	}
+
+	delivered := 0
+	reached := 0
+	for _, follower := range followers {
+		output, err := store.PostList(ctx, &PostListInput{UserId: follower, PageSize: numPosts})
+		if err != nil || !output.Success {
+			t.Fatalf("PostList(%s) = %+v, %v", follower, output, err)
+		}
+		delivered += len(output.Posts)
+		if len(output.Posts) > 0 {
+			reached++
+		}
+	}
+	if delivered != numPosts*kMaxNotifyUsers {
+		t.Errorf("delivered %d posts, want %d", delivered, numPosts*kMaxNotifyUsers)
+	}
+	// With the same sample for every post, only kMaxNotifyUsers followers
+	// would ever see a post
+	if reached <= kMaxNotifyUsers {
+		t.Errorf("posts reached %d of %d followers", reached, numFollowers)
+	}
+}
+
+func TestRedisPostSkipsBlockedFollowers(t *testing.T) {
+	ctx := context.Background()
+	store := newTestRedisStore(t)
+	author := registerTestUser(t, store, "author")
+	follower := registerTestUser(t, store, "follower")
+	if output, err := store.Follow(ctx, &FollowInput{UserId: follower, FolloweeId: author}); err != nil || !output.Success {
+		t.Fatalf("Follow = %+v, %v", output, err)
+	}
+	if output, err := store.Block(ctx, &BlockInput{UserId: author, BlockeeId: follower}); err != nil || !output.Success {
+		t.Fatalf("Block = %+v, %v", output, err)
+	}
+	if output, err := store.Post(ctx, &PostInput{UserId: author, Body: "hidden"}); err != nil || !output.Success {
+		t.Fatalf("Post = %+v, %v", output, err)
+	}
+	output, err := store.PostList(ctx, &PostListInput{UserId: follower})
+	if err != nil || !output.Success {
+		t.Fatalf("PostList = %+v, %v", output, err)
+	}
+	if len(output.Posts) != 0 {
+		t.Errorf("blocked follower got %d posts", len(output.Posts))
+	}
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"cs.utexas.edu/zjia/faas/types"
+)
+
+// Search finds posts containing all keywords of Query, newest first
+type SearchInput struct {
+	Query        string `json:"query"`
+	Cursor       string `json:"cursor,omitempty"`
+	PageSize     int    `json:"pageSize,omitempty"`
+	SessionToken string `json:"sessionToken,omitempty"`
+}
+
+var kKeywordRegexp = regexp.MustCompile(`\w+`)
+
+// parseKeywords extracts distinct lower-cased words of text, ignoring words
+// shorter than kMinKeywordLength. The result is limited to kMaxKeywordsPerPost.
+func parseKeywords(text string) []string {
+	keywords := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, word := range kKeywordRegexp.FindAllString(text, -1) {
+		if len(word) < kMinKeywordLength {
+			continue
+		}
+		word = strings.ToLower(word)
+		if !seen[word] {
+			seen[word] = true
+			keywords = append(keywords, word)
+			if len(keywords) == kMaxKeywordsPerPost {
+				break
+			}
+		}
+	}
+	return keywords
+}
+
+// matchKeywords tells whether body contains all keywords
+func matchKeywords(body string, keywords []string) bool {
+	words := make(map[string]bool)
+	for _, word := range kKeywordRegexp.FindAllString(body, -1) {
+		words[strings.ToLower(word)] = true
+	}
+	for _, keyword := range keywords {
+		if !words[keyword] {
+			return false
+		}
+	}
+	return true
+}
+
+type searchHandler struct {
+	store RetwisStore
+}
+
+func NewSearchHandler(store RetwisStore) types.FuncHandler {
+	return &searchHandler{store: store}
+}
+
+func (h *searchHandler) onRequest(ctx context.Context, input *SearchInput) (*PostListOutput, error) {
+	index, ok := h.store.(PostIndex)
+	if !ok {
+		return &PostListOutput{
+			Success: false,
+			Message: kNotSupportedMessage,
+		}, nil
+	}
+	if len(parseKeywords(input.Query)) == 0 {
+		return &PostListOutput{
+			Success: false,
+			Message: "Query has no keywords",
+		}, nil
+	}
+	if message, err := waitForSession(ctx, h.store, input.SessionToken); err != nil {
+		return nil, err
+	} else if message != "" {
+		return &PostListOutput{Success: false, Message: message}, nil
+	}
+	return index.Search(ctx, input)
+}
+
+func (h *searchHandler) Call(ctx context.Context, input []byte) ([]byte, error) {
+	parsedInput := &SearchInput{}
+	err := json.Unmarshal(input, parsedInput)
+	if err != nil {
+		return nil, err
+	}
+	output, err := h.onRequest(ctx, parsedInput)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(output)
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+
+	"cs.utexas.edu/zjia/faas/types"
+)
+
+type SendMessageInput struct {
+	UserId      string `json:"userId"`
+	RecipientId string `json:"recipientId"`
+	Body        string `json:"body"`
+}
+
+type SendMessageOutput struct {
+	Success      bool   `json:"success"`
+	Message      string `json:"message,omitempty"`
+	MessageId    string `json:"messageId,omitempty"`
+	SessionToken string `json:"sessionToken,omitempty"`
+}
+
+type sendMessageHandler struct {
+	store RetwisStore
+}
+
+func NewSendMessageHandler(store RetwisStore) types.FuncHandler {
+	return &sendMessageHandler{store: store}
+}
+
+func (h *sendMessageHandler) onRequest(ctx context.Context, input *SendMessageInput) (*SendMessageOutput, error) {
+	messenger, ok := h.store.(Messenger)
+	if !ok {
+		return &SendMessageOutput{
+			Success: false,
+			Message: kNotSupportedMessage,
+		}, nil
+	}
+	if input.UserId == input.RecipientId {
+		return &SendMessageOutput{
+			Success: false,
+			Message: "userId and recipientId cannot be same",
+		}, nil
+	}
+	return messenger.SendMessage(ctx, input)
+}
+
+func (h *sendMessageHandler) Call(ctx context.Context, input []byte) ([]byte, error) {
+	parsedInput := &SendMessageInput{}
+	err := json.Unmarshal(input, parsedInput)
+	if err != nil {
+		return nil, err
+	}
+	output, err := h.onRequest(ctx, parsedInput)
+	if err != nil {
+		return nil, err
+	}
+	if output.Success {
+		output.SessionToken, err = sessionToken(ctx, h.store)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(output)
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// SessionStore is implemented by stores whose reads may lag behind writes
+// committed by other function instances. Mutating handlers return a session
+// token covering the write they just committed, and read handlers given that
+// token wait until the store reflects it (read-your-writes). Stores without
+// this interface ignore session tokens, as their reads are never stale.
+type SessionStore interface {
+	// LastCommittedSeqnum returns a log position at or after every write
+	// committed so far
+	LastCommittedSeqnum(ctx context.Context) (uint64, error)
+	// WaitForSeqnum blocks until reads reflect all writes up to seqnum
+	WaitForSeqnum(ctx context.Context, seqnum uint64) error
+}
+
+const kSessionWaitTimeout = 2 * time.Second
+
+const kSessionTimeoutMessage = "Timed out waiting for session to catch up"
+
+func encodeSessionToken(seqnum uint64) string {
+	return fmt.Sprintf("%016x", seqnum)
+}
+
+func decodeSessionToken(token string) (uint64, error) {
+	return strconv.ParseUint(token, 16, 64)
+}
+
+// sessionToken returns the token a mutating handler replies with after a
+// successful write, or "" if store does not support sessions.
+func sessionToken(ctx context.Context, store RetwisStore) (string, error) {
+	session, ok := store.(SessionStore)
+	if !ok {
+		return "", nil
+	}
+	seqnum, err := session.LastCommittedSeqnum(ctx)
+	if err != nil {
+		return "", err
+	}
+	return encodeSessionToken(seqnum), nil
+}
+
+// waitForSession is called by read handlers before reading. A non-empty
+// message means the session cannot be honored and should be returned to the
+// client as a failure.
+func waitForSession(ctx context.Context, store RetwisStore, token string) (string /* message */, error) {
+	if token == "" {
+		return "", nil
+	}
+	session, ok := store.(SessionStore)
+	if !ok {
+		return "", nil
+	}
+	seqnum, err := decodeSessionToken(token)
+	if err != nil {
+		return fmt.Sprintf("Invalid session token %s", token), nil
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, kSessionWaitTimeout)
+	defer cancel()
+	if err := session.WaitForSeqnum(waitCtx, seqnum); err != nil {
+		if err == context.DeadlineExceeded && ctx.Err() == nil {
+			return kSessionTimeoutMessage, nil
+		}
+		return "", err
+	}
+	return "", nil
+}
@@ -0,0 +1,1226 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"cs.utexas.edu/zjia/faas/slib/statestore"
+	"cs.utexas.edu/zjia/faas/types"
+)
+
+type slibStore struct {
+	env       types.Environment
+	rateLimit *rateLimit
+}
+
+func newSlibStore(env types.Environment) *slibStore {
+	return &slibStore{env: env, rateLimit: getRateLimit()}
+}
+
+func (s *slibStore) Init(ctx context.Context) error {
+	store := statestore.CreateEnv(ctx, s.env)
+
+	if result := store.Object("timeline").MakeArray("posts", 0); result.Err != nil {
+		return result.Err
+	}
+
+	if result := store.Object("next_user_id").SetNumber("value", 0); result.Err != nil {
+		return result.Err
+	}
+
+	return nil
+}
+
+func (s *slibStore) RegisterUser(ctx context.Context, input *RegisterInput) (*RegisterOutput, error) {
+	store := statestore.CreateEnv(ctx, s.env)
+	nextUserIdObj := store.Object("next_user_id")
+	result := nextUserIdObj.NumberFetchAdd("value", 1)
+	if result.Err != nil {
+		return nil, result.Err
+	}
+	userIdValue := uint32(result.Value.AsNumber())
+
+	txn, err := statestore.CreateTxnEnv(ctx, s.env)
+	if err != nil {
+		return nil, err
+	}
+
+	userNameObj := txn.Object(fmt.Sprintf("username:%s", input.UserName))
+	if value, _ := userNameObj.Get("id"); !value.IsNull() {
+		txn.TxnAbort()
+		return &RegisterOutput{
+			Success: false,
+			Message: fmt.Sprintf("User name \"%s\" already exists", input.UserName),
+		}, nil
+	}
+
+	userId := fmt.Sprintf("%08x", userIdValue)
+	userNameObj.SetString("id", userId)
+
+	userObj := txn.Object(fmt.Sprintf("userid:%s", userId))
+	userObj.SetString("username", input.UserName)
+	userObj.SetString("password", input.Password)
+	userObj.SetString("auth", fmt.Sprintf("%016x", rand.Uint64()))
+	userObj.MakeObject("followers")
+	userObj.MakeObject("followees")
+	userObj.MakeObject("blocked")
+	userObj.MakeArray("posts", 0)
+	userObj.SetNumber("numArchived", 0)
+
+	if committed, err := txn.TxnCommit(); err != nil {
+		return nil, err
+	} else if committed {
+		return &RegisterOutput{
+			Success: true,
+			UserId:  userId,
+		}, nil
+	} else {
+		return &RegisterOutput{
+			Success: false,
+			Message: "Failed to commit transaction due to conflicts",
+		}, nil
+	}
+}
+
+func (s *slibStore) Login(ctx context.Context, input *LoginInput) (*LoginOutput, error) {
+	txn, err := statestore.CreateReadOnlyTxnEnv(ctx, s.env)
+	if err != nil {
+		return nil, err
+	}
+
+	userId := ""
+
+	userNameObj := txn.Object(fmt.Sprintf("username:%s", input.UserName))
+	if value, _ := userNameObj.Get("id"); !value.IsNull() {
+		userId = value.AsString()
+	} else {
+		return &LoginOutput{
+			Success: false,
+			Message: fmt.Sprintf("User name \"%s\" does not exists", input.UserName),
+		}, nil
+	}
+
+	userObj := txn.Object(fmt.Sprintf("userid:%s", userId))
+	if value, _ := userObj.Get("password"); !value.IsNull() {
+		if input.Password != value.AsString() {
+			return &LoginOutput{
+				Success: false,
+				Message: "Incorrect password",
+			}, nil
+		}
+	} else {
+		return &LoginOutput{
+			Success: false,
+			Message: fmt.Sprintf("Cannot find user with ID %s", userId),
+		}, nil
+	}
+
+	output := &LoginOutput{Success: true, UserId: userId}
+	if value, _ := userObj.Get("auth"); !value.IsNull() {
+		output.Auth = value.AsString()
+	}
+	return output, nil
+}
+
+func (s *slibStore) Follow(ctx context.Context, input *FollowInput) (*FollowOutput, error) {
+	txn, err := statestore.CreateTxnEnv(ctx, s.env)
+	if err != nil {
+		return nil, err
+	}
+
+	userObj1 := txn.Object(fmt.Sprintf("userid:%s", input.UserId))
+	if value, _ := userObj1.Get("username"); value.IsNull() {
+		txn.TxnAbort()
+		return &FollowOutput{
+			Success: false,
+			Message: fmt.Sprintf("Cannot find user with ID %s", input.UserId),
+		}, nil
+	}
+
+	if s.rateLimit != nil && !slibTakeToken(txn, s.rateLimit, input.UserId) {
+		txn.TxnAbort()
+		return &FollowOutput{
+			Success: false,
+			Message: kRateLimitedMessage,
+		}, nil
+	}
+
+	userObj2 := txn.Object(fmt.Sprintf("userid:%s", input.FolloweeId))
+	if value, _ := userObj2.Get("username"); value.IsNull() {
+		txn.TxnAbort()
+		return &FollowOutput{
+			Success: false,
+			Message: fmt.Sprintf("Cannot find user with ID %s", input.FolloweeId),
+		}, nil
+	}
+
+	if !input.Unfollow {
+		if value, _ := userObj2.Get(fmt.Sprintf("blocked.%s", input.UserId)); !value.IsNull() {
+			txn.TxnAbort()
+			return &FollowOutput{
+				Success: false,
+				Message: fmt.Sprintf("User %s has blocked user %s", input.FolloweeId, input.UserId),
+			}, nil
+		}
+	}
+
+	if input.Unfollow {
+		userObj1.Delete(fmt.Sprintf("followees.%s", input.FolloweeId))
+		userObj2.Delete(fmt.Sprintf("followers.%s", input.UserId))
+	} else {
+		userObj1.SetBoolean(fmt.Sprintf("followees.%s", input.FolloweeId), true)
+		userObj2.SetBoolean(fmt.Sprintf("followers.%s", input.UserId), true)
+	}
+
+	if committed, err := txn.TxnCommit(); err != nil {
+		return nil, err
+	} else if committed {
+		return &FollowOutput{
+			Success: true,
+		}, nil
+	} else {
+		return &FollowOutput{
+			Success: false,
+			Message: "Failed to commit transaction due to conflicts",
+		}, nil
+	}
+}
+
+func (s *slibStore) followList(ctx context.Context, input *FollowListInput, field string) (*FollowListOutput, error) {
+	store := statestore.CreateEnv(ctx, s.env)
+	userObj := store.Object(fmt.Sprintf("userid:%s", input.UserId))
+	value, _ := userObj.Get(field)
+	if value.IsNull() {
+		return &FollowListOutput{
+			Success: false,
+			Message: fmt.Sprintf("Cannot find user with ID %s", input.UserId),
+		}, nil
+	}
+	userIds := make([]string, 0, value.Size())
+	for userId, _ := range value.AsObject() {
+		userIds = append(userIds, userId)
+	}
+	return pageUserIds(userIds, input.Cursor, clampPageSize(input.PageSize)), nil
+}
+
+func (s *slibStore) Followers(ctx context.Context, input *FollowListInput) (*FollowListOutput, error) {
+	return s.followList(ctx, input, "followers")
+}
+
+func (s *slibStore) Followees(ctx context.Context, input *FollowListInput) (*FollowListOutput, error) {
+	return s.followList(ctx, input, "followees")
+}
+
+func (s *slibStore) Block(ctx context.Context, input *BlockInput) (*BlockOutput, error) {
+	txn, err := statestore.CreateTxnEnv(ctx, s.env)
+	if err != nil {
+		return nil, err
+	}
+
+	userObj := txn.Object(fmt.Sprintf("userid:%s", input.UserId))
+	if value, _ := userObj.Get("username"); value.IsNull() {
+		txn.TxnAbort()
+		return &BlockOutput{
+			Success: false,
+			Message: fmt.Sprintf("Cannot find user with ID %s", input.UserId),
+		}, nil
+	}
+
+	blockeeObj := txn.Object(fmt.Sprintf("userid:%s", input.BlockeeId))
+	if value, _ := blockeeObj.Get("username"); value.IsNull() {
+		txn.TxnAbort()
+		return &BlockOutput{
+			Success: false,
+			Message: fmt.Sprintf("Cannot find user with ID %s", input.BlockeeId),
+		}, nil
+	}
+
+	if input.Unblock {
+		userObj.Delete(fmt.Sprintf("blocked.%s", input.BlockeeId))
+	} else {
+		if value, _ := userObj.Get("blocked"); value.IsNull() {
+			userObj.MakeObject("blocked")
+		}
+		userObj.SetBoolean(fmt.Sprintf("blocked.%s", input.BlockeeId), true)
+	}
+
+	if committed, err := txn.TxnCommit(); err != nil {
+		return nil, err
+	} else if committed {
+		return &BlockOutput{
+			Success: true,
+		}, nil
+	} else {
+		return &BlockOutput{
+			Success: false,
+			Message: "Failed to commit transaction due to conflicts",
+		}, nil
+	}
+}
+
+func (s *slibStore) Post(ctx context.Context, input *PostInput) (*PostOutput, error) {
+	txn, err := statestore.CreateTxnEnv(ctx, s.env)
+	if err != nil {
+		return nil, err
+	}
+
+	userObj := txn.Object(fmt.Sprintf("userid:%s", input.UserId))
+	userName := ""
+	if value, _ := userObj.Get("username"); !value.IsNull() {
+		userName = value.AsString()
+	} else {
+		txn.TxnAbort()
+		return &PostOutput{
+			Success: false,
+			Message: fmt.Sprintf("Cannot find user with ID %s", input.UserId),
+		}, nil
+	}
+
+	if s.rateLimit != nil && !slibTakeToken(txn, s.rateLimit, input.UserId) {
+		txn.TxnAbort()
+		return &PostOutput{
+			Success: false,
+			Message: kRateLimitedMessage,
+		}, nil
+	}
+
+	postId := fmt.Sprintf("%016x", s.env.GenerateUniqueID())
+	postObj := txn.Object(fmt.Sprintf("post:%s", postId))
+	postObj.SetString("id", postId)
+	postObj.SetString("userId", input.UserId)
+	postObj.SetString("userName", userName)
+	postObj.SetString("body", input.Body)
+	postObj.SetNumber("version", 1)
+	postObj.MakeArray("history", 0)
+	postObj.MakeObject("likes")
+	postObj.SetNumber("numLikes", 0)
+
+	if value, _ := userObj.Get("followers"); !value.IsNull() && value.Size() > 0 {
+		blocked := make(map[string]interface{})
+		if value, _ := userObj.Get("blocked"); !value.IsNull() {
+			blocked = value.AsObject()
+		}
+		followers := make([]string, 0, 4)
+		for follower, _ := range value.AsObject() {
+			if _, exists := blocked[follower]; !exists {
+				followers = append(followers, follower)
+			}
+		}
+		rand.Shuffle(len(followers), func(i, j int) {
+			followers[i], followers[j] = followers[j], followers[i]
+		})
+		if len(followers) > kMaxNotifyUsers {
+			followers = followers[0:kMaxNotifyUsers]
+		}
+		for _, follower := range followers {
+			followUserObj := txn.Object(fmt.Sprintf("userid:%s", follower))
+			if value, _ := followUserObj.Get("posts"); !value.IsNull() && value.Size() >= kUserPostListLimit {
+				s.archiveOldestPost(txn, follower, followUserObj, value.AsArray()[0].(string))
+			}
+			followUserObj.ArrayPushBackWithLimit("posts", statestore.StringValue(postId), kUserPostListLimit)
+		}
+	}
+
+	// Indexes reflect the body a post is created with
+	tags, mentions := parsePostBody(input.Body)
+	for _, tag := range tags {
+		slibPushIndex(txn.Object(fmt.Sprintf("tag:%s", tag)), postId, kTagPostListLimit)
+	}
+	for _, mention := range mentions {
+		if value, _ := txn.Object(fmt.Sprintf("username:%s", mention)).Get("id"); !value.IsNull() {
+			mentionsObj := txn.Object(fmt.Sprintf("mentions:%s", value.AsString()))
+			slibPushIndex(mentionsObj, postId, kMentionPostListLimit)
+		}
+	}
+	for _, keyword := range parseKeywords(input.Body) {
+		slibPushIndex(txn.Object(fmt.Sprintf("keyword:%s", keyword)), postId, kKeywordPostListLimit)
+	}
+
+	if committed, err := txn.TxnCommit(); err != nil {
+		return nil, err
+	} else if !committed {
+		return &PostOutput{
+			Success: false,
+			Message: "Failed to commit transaction due to conflicts",
+		}, nil
+	}
+
+	store := statestore.CreateEnv(ctx, s.env)
+	timelineObj := store.Object("timeline")
+	result := timelineObj.ArrayPushBackWithLimit("posts", statestore.StringValue(postId), kTimeLinePostListLimit)
+	if result.Err != nil {
+		return nil, result.Err
+	}
+
+	return &PostOutput{Success: true}, nil
+}
+
+// Posts pushed to a user are numbered from zero in push order. The first
+// numArchived of them live in "archive:<userId>:<chunk>" objects, and the
+// rest are in the capped "posts" array of the user.
+func (s *slibStore) archiveOldestPost(txn statestore.Env, userId string, userObj *statestore.ObjectRef, postId string) {
+	numArchived := 0
+	if value, _ := userObj.Get("numArchived"); !value.IsNull() {
+		numArchived = int(value.AsNumber())
+	}
+	chunkObj := txn.Object(fmt.Sprintf("archive:%s:%d", userId, numArchived/kArchiveChunkSize))
+	if numArchived%kArchiveChunkSize == 0 {
+		chunkObj.MakeArray("posts", 0)
+	}
+	chunkObj.ArrayPushBack("posts", statestore.StringValue(postId))
+	userObj.SetNumber("numArchived", float64(numArchived+1))
+}
+
+func slibPushIndex(indexObj *statestore.ObjectRef, postId string, limit int) {
+	if value, _ := indexObj.Get("posts"); value.IsNull() {
+		indexObj.MakeArray("posts", 0)
+	}
+	indexObj.ArrayPushBackWithLimit("posts", statestore.StringValue(postId), limit)
+}
+
+func (s *slibStore) PostList(ctx context.Context, input *PostListInput) (*PostListOutput, error) {
+	cursor, err := decodePostListCursor(input.Cursor)
+	if err != nil {
+		return &PostListOutput{
+			Success: false,
+			Message: "Invalid cursor",
+		}, nil
+	}
+
+	txn, err := statestore.CreateReadOnlyTxnEnv(ctx, s.env)
+	if err != nil {
+		return nil, err
+	}
+
+	var postList []interface{}
+	numArchived := 0
+
+	if input.UserId == "" {
+		timelineObj := txn.Object("timeline")
+		if value, _ := timelineObj.Get("posts"); !value.IsNull() {
+			postList = value.AsArray()
+		} else {
+			postList = make([]interface{}, 0)
+		}
+	} else {
+		userObj := txn.Object(fmt.Sprintf("userid:%s", input.UserId))
+		if value, _ := userObj.Get("posts"); !value.IsNull() {
+			postList = value.AsArray()
+		} else {
+			return &PostListOutput{
+				Success: false,
+				Message: fmt.Sprintf("Cannot find user with ID %s", input.UserId),
+			}, nil
+		}
+		if value, _ := userObj.Get("numArchived"); !value.IsNull() {
+			numArchived = int(value.AsNumber())
+		}
+	}
+
+	output := &PostListOutput{
+		Success: true,
+		Posts:   make([]interface{}, 0),
+	}
+
+	// Posts at [0, end) are older than the requested page
+	end := numArchived + len(postList) - input.Skip
+	if cursor != nil {
+		if input.UserId != "" {
+			end = int(cursor.Seqnum)
+		} else {
+			// Timeline is not archived, so its cursor is simply the post id.
+			// Once the post falls off the timeline, there is nothing older.
+			end = 0
+			for i, postId := range postList {
+				if postId.(string) == cursor.PostId {
+					end = i
+					break
+				}
+			}
+		}
+	}
+	if end > numArchived+len(postList) {
+		end = numArchived + len(postList)
+	}
+
+	pageSize := clampPageSize(input.PageSize)
+	archiveChunks := make(map[int][]interface{})
+	for i := end - 1; i >= 0; i-- {
+		var postId string
+		if i >= numArchived {
+			postId = postList[i-numArchived].(string)
+		} else {
+			chunk, exists := archiveChunks[i/kArchiveChunkSize]
+			if !exists {
+				chunkObj := txn.Object(fmt.Sprintf("archive:%s:%d", input.UserId, i/kArchiveChunkSize))
+				if value, _ := chunkObj.Get("posts"); !value.IsNull() {
+					chunk = value.AsArray()
+				}
+				archiveChunks[i/kArchiveChunkSize] = chunk
+			}
+			if i%kArchiveChunkSize >= len(chunk) {
+				continue
+			}
+			postId = chunk[i%kArchiveChunkSize].(string)
+		}
+		if post := slibReadPost(txn, postId); post != nil {
+			output.Posts = append(output.Posts, post)
+			if len(output.Posts) == pageSize {
+				if i > 0 {
+					output.NextCursor = encodePostListCursor(uint64(i), postId)
+				}
+				break
+			}
+		}
+	}
+	return output, nil
+}
+
+func (s *slibStore) TagTimeline(ctx context.Context, input *TagTimelineInput) (*PostListOutput, error) {
+	return s.readIndex(ctx, fmt.Sprintf("tag:%s", strings.ToLower(input.Tag)), input.Cursor, input.PageSize)
+}
+
+func (s *slibStore) Mentions(ctx context.Context, input *MentionsInput) (*PostListOutput, error) {
+	return s.readIndex(ctx, fmt.Sprintf("mentions:%s", input.UserId), input.Cursor, input.PageSize)
+}
+
+func (s *slibStore) readIndex(ctx context.Context, name string, cursor string, pageSize int) (*PostListOutput, error) {
+	parsedCursor, err := decodePostListCursor(cursor)
+	if err != nil {
+		return &PostListOutput{
+			Success: false,
+			Message: "Invalid cursor",
+		}, nil
+	}
+
+	txn, err := statestore.CreateReadOnlyTxnEnv(ctx, s.env)
+	if err != nil {
+		return nil, err
+	}
+
+	postList := make([]interface{}, 0)
+	if value, _ := txn.Object(name).Get("posts"); !value.IsNull() {
+		postList = value.AsArray()
+	}
+	return slibReadPostPage(txn, postList, parsedCursor, clampPageSize(pageSize), nil), nil
+}
+
+// Search reads the shortest keyword index among query keywords. Indexes
+// reflect every body a post once had, so posts are matched against their
+// current body.
+func (s *slibStore) Search(ctx context.Context, input *SearchInput) (*PostListOutput, error) {
+	cursor, err := decodePostListCursor(input.Cursor)
+	if err != nil {
+		return &PostListOutput{
+			Success: false,
+			Message: "Invalid cursor",
+		}, nil
+	}
+
+	txn, err := statestore.CreateReadOnlyTxnEnv(ctx, s.env)
+	if err != nil {
+		return nil, err
+	}
+
+	keywords := parseKeywords(input.Query)
+	var postList []interface{}
+	for _, keyword := range keywords {
+		value, _ := txn.Object(fmt.Sprintf("keyword:%s", keyword)).Get("posts")
+		if value.IsNull() {
+			postList = make([]interface{}, 0)
+			break
+		}
+		if postList == nil || value.Size() < len(postList) {
+			postList = value.AsArray()
+		}
+	}
+	match := func(post map[string]string) bool {
+		return matchKeywords(post["body"], keywords)
+	}
+	return slibReadPostPage(txn, postList, cursor, clampPageSize(input.PageSize), match), nil
+}
+
+// slibReadPost returns nil if the post is deleted
+func slibReadPost(txn statestore.Env, postId string) map[string]string {
+	postObj := txn.Object(fmt.Sprintf("post:%s", postId))
+	post := make(map[string]string)
+	if value, _ := postObj.Get("body"); !value.IsNull() {
+		post["body"] = value.AsString()
+	} else {
+		return nil
+	}
+	if value, _ := postObj.Get("userName"); !value.IsNull() {
+		post["user"] = value.AsString()
+	}
+	if value, _ := postObj.Get("userId"); !value.IsNull() {
+		post["userId"] = value.AsString()
+	}
+	post["id"] = postId
+	return post
+}
+
+// slibReadPostPage pages through postList, which holds post ids in the order
+// they are pushed. Cursor carries the post id, as entries never move. If match
+// is not nil, posts it rejects are skipped.
+func slibReadPostPage(txn statestore.Env, postList []interface{}, cursor *postListCursor, pageSize int, match func(map[string]string) bool) *PostListOutput {
+	output := &PostListOutput{
+		Success: true,
+		Posts:   make([]interface{}, 0),
+	}
+	end := len(postList)
+	if cursor != nil {
+		// Once the post falls off the list, there is nothing older
+		end = 0
+		for i, postId := range postList {
+			if postId.(string) == cursor.PostId {
+				end = i
+				break
+			}
+		}
+	}
+	for i := end - 1; i >= 0; i-- {
+		postId := postList[i].(string)
+		if post := slibReadPost(txn, postId); post != nil && (match == nil || match(post)) {
+			output.Posts = append(output.Posts, post)
+			if len(output.Posts) == pageSize {
+				if i > 0 {
+					output.NextCursor = encodePostListCursor(0, postId)
+				}
+				break
+			}
+		}
+	}
+	return output
+}
+
+// slibCheckPost reads the post within txn, and checks it is authored by
+// userId unless userId is empty. On failure, it returns nil with the reason.
+func slibCheckPost(txn statestore.Env, postId string, userId string) (*statestore.ObjectRef, string) {
+	postObj := txn.Object(fmt.Sprintf("post:%s", postId))
+	if value, _ := postObj.Get("body"); value.IsNull() {
+		return nil, fmt.Sprintf("Cannot find post with ID %s", postId)
+	}
+	if userId != "" {
+		if value, _ := postObj.Get("userId"); value.IsNull() || value.AsString() != userId {
+			return nil, fmt.Sprintf("Post %s is not authored by user %s", postId, userId)
+		}
+	}
+	return postObj, ""
+}
+
+// slibArrayRemove rebuilds the array at path without element. Later entries
+// shift by one, so it is not used on post lists, whose cursors are positions.
+func slibArrayRemove(obj *statestore.ObjectRef, path string, target string) {
+	value, _ := obj.Get(path)
+	if value.IsNull() {
+		return
+	}
+	elements := value.AsArray()
+	remaining := make([]string, 0, len(elements))
+	for _, element := range elements {
+		if element.(string) != target {
+			remaining = append(remaining, element.(string))
+		}
+	}
+	if len(remaining) == len(elements) {
+		return
+	}
+	obj.MakeArray(path, 0)
+	for _, element := range remaining {
+		obj.ArrayPushBack(path, statestore.StringValue(element))
+	}
+}
+
+func (s *slibStore) DeletePost(ctx context.Context, input *DeletePostInput) (*DeletePostOutput, error) {
+	txn, err := statestore.CreateTxnEnv(ctx, s.env)
+	if err != nil {
+		return nil, err
+	}
+
+	postObj, message := slibCheckPost(txn, input.PostId, input.UserId)
+	if postObj == nil {
+		txn.TxnAbort()
+		return &DeletePostOutput{
+			Success: false,
+			Message: message,
+		}, nil
+	}
+
+	// The post object is the tombstone: entries of the post stay in place in
+	// post lists, so that cursors keep their positions, and readers skip them
+	// as the body is gone
+	postObj.Delete("body")
+	postObj.Delete("history")
+	postObj.Delete("likes")
+	postObj.SetBoolean("deleted", true)
+
+	if committed, err := txn.TxnCommit(); err != nil {
+		return nil, err
+	} else if committed {
+		return &DeletePostOutput{
+			Success: true,
+		}, nil
+	} else {
+		return &DeletePostOutput{
+			Success: false,
+			Message: "Failed to commit transaction due to conflicts",
+		}, nil
+	}
+}
+
+func (s *slibStore) EditPost(ctx context.Context, input *EditPostInput) (*EditPostOutput, error) {
+	txn, err := statestore.CreateTxnEnv(ctx, s.env)
+	if err != nil {
+		return nil, err
+	}
+
+	postObj, message := slibCheckPost(txn, input.PostId, input.UserId)
+	if postObj == nil {
+		txn.TxnAbort()
+		return &EditPostOutput{
+			Success: false,
+			Message: message,
+		}, nil
+	}
+
+	version := 1
+	if value, _ := postObj.Get("version"); !value.IsNull() {
+		version = int(value.AsNumber())
+	}
+	if value, _ := postObj.Get("history"); value.IsNull() {
+		postObj.MakeArray("history", 0)
+	}
+	body, _ := postObj.Get("body")
+	postObj.ArrayPushBack("history", body)
+	postObj.SetString("body", input.Body)
+	// Posts stay in indexes of words they no longer contain, which Search
+	// filters out, so only words new to the post are indexed
+	for _, keyword := range parseKeywords(input.Body) {
+		if !matchKeywords(body.AsString(), []string{keyword}) {
+			slibPushIndex(txn.Object(fmt.Sprintf("keyword:%s", keyword)), input.PostId, kKeywordPostListLimit)
+		}
+	}
+	postObj.SetNumber("version", float64(version+1))
+
+	if committed, err := txn.TxnCommit(); err != nil {
+		return nil, err
+	} else if committed {
+		return &EditPostOutput{
+			Success: true,
+			Version: version + 1,
+		}, nil
+	} else {
+		return &EditPostOutput{
+			Success: false,
+			Message: "Failed to commit transaction due to conflicts",
+		}, nil
+	}
+}
+
+func (s *slibStore) LikePost(ctx context.Context, input *LikePostInput) (*LikePostOutput, error) {
+	txn, err := statestore.CreateTxnEnv(ctx, s.env)
+	if err != nil {
+		return nil, err
+	}
+
+	userObj := txn.Object(fmt.Sprintf("userid:%s", input.UserId))
+	if value, _ := userObj.Get("username"); value.IsNull() {
+		txn.TxnAbort()
+		return &LikePostOutput{
+			Success: false,
+			Message: fmt.Sprintf("Cannot find user with ID %s", input.UserId),
+		}, nil
+	}
+
+	postObj, message := slibCheckPost(txn, input.PostId, "")
+	if postObj == nil {
+		txn.TxnAbort()
+		return &LikePostOutput{
+			Success: false,
+			Message: message,
+		}, nil
+	}
+
+	numLikes := 0
+	if value, _ := postObj.Get("numLikes"); !value.IsNull() {
+		numLikes = int(value.AsNumber())
+	}
+	likePath := fmt.Sprintf("likes.%s", input.UserId)
+	liked, _ := postObj.Get(likePath)
+	// Counter only changes when the like actually changed
+	if input.Unlike && !liked.IsNull() {
+		postObj.Delete(likePath)
+		numLikes--
+	} else if !input.Unlike && liked.IsNull() {
+		if value, _ := postObj.Get("likes"); value.IsNull() {
+			postObj.MakeObject("likes")
+		}
+		postObj.SetBoolean(likePath, true)
+		numLikes++
+	}
+	postObj.SetNumber("numLikes", float64(numLikes))
+
+	if committed, err := txn.TxnCommit(); err != nil {
+		return nil, err
+	} else if committed {
+		return &LikePostOutput{
+			Success:  true,
+			NumLikes: numLikes,
+		}, nil
+	} else {
+		return &LikePostOutput{
+			Success: false,
+			Message: "Failed to commit transaction due to conflicts",
+		}, nil
+	}
+}
+
+func (s *slibStore) Profile(ctx context.Context, input *ProfileInput) (*ProfileOutput, error) {
+	output := &ProfileOutput{Success: true}
+
+	store := statestore.CreateEnv(ctx, s.env)
+	userObj := store.Object(fmt.Sprintf("userid:%s", input.UserId))
+	if value, _ := userObj.Get("username"); !value.IsNull() {
+		output.UserName = value.AsString()
+	} else {
+		return &ProfileOutput{
+			Success: false,
+			Message: fmt.Sprintf("Cannot find user with ID %s", input.UserId),
+		}, nil
+	}
+	if value, _ := userObj.Get("followers"); !value.IsNull() {
+		output.NumFollowers = value.Size()
+	}
+	if value, _ := userObj.Get("followees"); !value.IsNull() {
+		output.NumFollowees = value.Size()
+	}
+	if value, _ := userObj.Get("posts"); !value.IsNull() {
+		output.NumPosts = value.Size()
+	}
+
+	return output, nil
+}
+
+// Messages between two users live in "conversation:<userId1>:<userId2>",
+// with the smaller user id first. Its "messages" array keeps the latest
+// kConversationMessageLimit message ids, and "numMessages" counts every
+// message ever sent, so message i is at index i-numMessages+len(messages)
+// while it is kept. "inbox:<userId>" lists peers of a user in the order of
+// their latest message, with unread counters per peer and in total.
+func slibConversationName(userId1 string, userId2 string) string {
+	if userId1 > userId2 {
+		userId1, userId2 = userId2, userId1
+	}
+	return fmt.Sprintf("conversation:%s:%s", userId1, userId2)
+}
+
+// slibInboxObject creates the inbox of userId on its first use
+func slibInboxObject(txn statestore.Env, userId string) *statestore.ObjectRef {
+	inboxObj := txn.Object(fmt.Sprintf("inbox:%s", userId))
+	if value, _ := inboxObj.Get("conversations"); value.IsNull() {
+		inboxObj.MakeArray("conversations", 0)
+		inboxObj.MakeObject("unread")
+		inboxObj.SetNumber("numUnread", 0)
+	}
+	return inboxObj
+}
+
+// slibMoveToBack moves peerId to the most recent end of the inbox
+func slibMoveToBack(inboxObj *statestore.ObjectRef, peerId string) {
+	slibArrayRemove(inboxObj, "conversations", peerId)
+	inboxObj.ArrayPushBack("conversations", statestore.StringValue(peerId))
+}
+
+func (s *slibStore) SendMessage(ctx context.Context, input *SendMessageInput) (*SendMessageOutput, error) {
+	txn, err := statestore.CreateTxnEnv(ctx, s.env)
+	if err != nil {
+		return nil, err
+	}
+
+	userObj := txn.Object(fmt.Sprintf("userid:%s", input.UserId))
+	userName := ""
+	if value, _ := userObj.Get("username"); !value.IsNull() {
+		userName = value.AsString()
+	} else {
+		txn.TxnAbort()
+		return &SendMessageOutput{
+			Success: false,
+			Message: fmt.Sprintf("Cannot find user with ID %s", input.UserId),
+		}, nil
+	}
+
+	recipientObj := txn.Object(fmt.Sprintf("userid:%s", input.RecipientId))
+	if value, _ := recipientObj.Get("username"); value.IsNull() {
+		txn.TxnAbort()
+		return &SendMessageOutput{
+			Success: false,
+			Message: fmt.Sprintf("Cannot find user with ID %s", input.RecipientId),
+		}, nil
+	}
+	if value, _ := recipientObj.Get(fmt.Sprintf("blocked.%s", input.UserId)); !value.IsNull() {
+		txn.TxnAbort()
+		return &SendMessageOutput{
+			Success: false,
+			Message: fmt.Sprintf("User %s has blocked user %s", input.RecipientId, input.UserId),
+		}, nil
+	}
+
+	messageId := fmt.Sprintf("%016x", s.env.GenerateUniqueID())
+	messageObj := txn.Object(fmt.Sprintf("message:%s", messageId))
+	messageObj.SetString("id", messageId)
+	messageObj.SetString("userId", input.UserId)
+	messageObj.SetString("userName", userName)
+	messageObj.SetString("body", input.Body)
+
+	conversationObj := txn.Object(slibConversationName(input.UserId, input.RecipientId))
+	numMessages := 0
+	if value, _ := conversationObj.Get("numMessages"); !value.IsNull() {
+		numMessages = int(value.AsNumber())
+	} else {
+		conversationObj.MakeArray("messages", 0)
+	}
+	conversationObj.ArrayPushBackWithLimit("messages", statestore.StringValue(messageId), kConversationMessageLimit)
+	conversationObj.SetNumber("numMessages", float64(numMessages+1))
+
+	slibMoveToBack(slibInboxObject(txn, input.UserId), input.RecipientId)
+
+	// Both unread counters are read within the transaction, so concurrent
+	// messages to the same recipient conflict instead of losing increments
+	recipientInboxObj := slibInboxObject(txn, input.RecipientId)
+	slibMoveToBack(recipientInboxObj, input.UserId)
+	unreadPath := fmt.Sprintf("unread.%s", input.UserId)
+	numUnread := 0
+	if value, _ := recipientInboxObj.Get(unreadPath); !value.IsNull() {
+		numUnread = int(value.AsNumber())
+	}
+	recipientInboxObj.SetNumber(unreadPath, float64(numUnread+1))
+	totalUnread := 0
+	if value, _ := recipientInboxObj.Get("numUnread"); !value.IsNull() {
+		totalUnread = int(value.AsNumber())
+	}
+	recipientInboxObj.SetNumber("numUnread", float64(totalUnread+1))
+
+	if committed, err := txn.TxnCommit(); err != nil {
+		return nil, err
+	} else if committed {
+		return &SendMessageOutput{
+			Success:   true,
+			MessageId: messageId,
+		}, nil
+	} else {
+		return &SendMessageOutput{
+			Success: false,
+			Message: "Failed to commit transaction due to conflicts",
+		}, nil
+	}
+}
+
+func (s *slibStore) ListConversations(ctx context.Context, input *ListConversationsInput) (*ListConversationsOutput, error) {
+	txn, err := statestore.CreateReadOnlyTxnEnv(ctx, s.env)
+	if err != nil {
+		return nil, err
+	}
+
+	userObj := txn.Object(fmt.Sprintf("userid:%s", input.UserId))
+	if value, _ := userObj.Get("username"); value.IsNull() {
+		return &ListConversationsOutput{
+			Success: false,
+			Message: fmt.Sprintf("Cannot find user with ID %s", input.UserId),
+		}, nil
+	}
+
+	output := &ListConversationsOutput{
+		Success:       true,
+		Conversations: make([]ConversationSummary, 0),
+	}
+	inboxObj := txn.Object(fmt.Sprintf("inbox:%s", input.UserId))
+	value, _ := inboxObj.Get("conversations")
+	if value.IsNull() {
+		return output, nil
+	}
+	peers := value.AsArray()
+	unread := make(map[string]interface{})
+	if value, _ := inboxObj.Get("unread"); !value.IsNull() {
+		unread = value.AsObject()
+	}
+	if value, _ := inboxObj.Get("numUnread"); !value.IsNull() {
+		output.NumUnread = int(value.AsNumber())
+	}
+	// Conversations at [0, end) are older than the requested page
+	end := len(peers)
+	if input.Cursor != "" {
+		end = 0
+		for i, peerId := range peers {
+			if peerId.(string) == input.Cursor {
+				end = i
+				break
+			}
+		}
+	}
+	pageSize := clampPageSize(input.PageSize)
+	for i := end - 1; i >= 0; i-- {
+		peerId := peers[i].(string)
+		summary := ConversationSummary{PeerId: peerId}
+		if numUnread, exists := unread[peerId]; exists {
+			summary.NumUnread = int(numUnread.(float64))
+		}
+		output.Conversations = append(output.Conversations, summary)
+		if len(output.Conversations) == pageSize {
+			if i > 0 {
+				output.NextCursor = peerId
+			}
+			break
+		}
+	}
+	return output, nil
+}
+
+func (s *slibStore) ReadConversation(ctx context.Context, input *ReadConversationInput) (*ReadConversationOutput, error) {
+	cursor, err := decodePostListCursor(input.Cursor)
+	if err != nil {
+		return &ReadConversationOutput{
+			Success: false,
+			Message: "Invalid cursor",
+		}, nil
+	}
+
+	txn, err := statestore.CreateTxnEnv(ctx, s.env)
+	if err != nil {
+		return nil, err
+	}
+
+	userObj := txn.Object(fmt.Sprintf("userid:%s", input.UserId))
+	if value, _ := userObj.Get("username"); value.IsNull() {
+		txn.TxnAbort()
+		return &ReadConversationOutput{
+			Success: false,
+			Message: fmt.Sprintf("Cannot find user with ID %s", input.UserId),
+		}, nil
+	}
+	peerObj := txn.Object(fmt.Sprintf("userid:%s", input.PeerId))
+	if value, _ := peerObj.Get("username"); value.IsNull() {
+		txn.TxnAbort()
+		return &ReadConversationOutput{
+			Success: false,
+			Message: fmt.Sprintf("Cannot find user with ID %s", input.PeerId),
+		}, nil
+	}
+
+	output := &ReadConversationOutput{
+		Success:  true,
+		Messages: make([]interface{}, 0),
+	}
+	conversationObj := txn.Object(slibConversationName(input.UserId, input.PeerId))
+	messages := make([]interface{}, 0)
+	if value, _ := conversationObj.Get("messages"); !value.IsNull() {
+		messages = value.AsArray()
+	}
+	numMessages := len(messages)
+	if value, _ := conversationObj.Get("numMessages"); !value.IsNull() {
+		numMessages = int(value.AsNumber())
+	}
+	numDropped := numMessages - len(messages)
+
+	// Messages at [0, end) are older than the requested page
+	end := numMessages
+	if cursor != nil && int(cursor.Seqnum) < end {
+		end = int(cursor.Seqnum)
+	}
+	pageSize := clampPageSize(input.PageSize)
+	for i := end - 1; i >= numDropped; i-- {
+		messageId := messages[i-numDropped].(string)
+		messageObj := txn.Object(fmt.Sprintf("message:%s", messageId))
+		message := make(map[string]string)
+		if value, _ := messageObj.Get("body"); !value.IsNull() {
+			message["body"] = value.AsString()
+		} else {
+			continue
+		}
+		if value, _ := messageObj.Get("userName"); !value.IsNull() {
+			message["user"] = value.AsString()
+		}
+		if value, _ := messageObj.Get("userId"); !value.IsNull() {
+			message["userId"] = value.AsString()
+		}
+		message["id"] = messageId
+		output.Messages = append(output.Messages, message)
+		if len(output.Messages) == pageSize {
+			if i > numDropped {
+				output.NextCursor = encodePostListCursor(uint64(i), messageId)
+			}
+			break
+		}
+	}
+
+	inboxObj := txn.Object(fmt.Sprintf("inbox:%s", input.UserId))
+	unreadPath := fmt.Sprintf("unread.%s", input.PeerId)
+	if value, _ := inboxObj.Get(unreadPath); !value.IsNull() {
+		output.NumRead = int(value.AsNumber())
+	}
+	if output.NumRead == 0 {
+		// Nothing to mark read, and the page is from a consistent snapshot
+		txn.TxnAbort()
+		return output, nil
+	}
+	inboxObj.Delete(unreadPath)
+	totalUnread := 0
+	if value, _ := inboxObj.Get("numUnread"); !value.IsNull() {
+		totalUnread = int(value.AsNumber())
+	}
+	inboxObj.SetNumber("numUnread", float64(totalUnread-output.NumRead))
+
+	if committed, err := txn.TxnCommit(); err != nil {
+		return nil, err
+	} else if committed {
+		return output, nil
+	} else {
+		return &ReadConversationOutput{
+			Success: false,
+			Message: "Failed to commit transaction due to conflicts",
+		}, nil
+	}
+}
+
+// All statestore objects share the default log stream, so its tail bounds
+// every committed write. A reader whose engine has not yet seen that tail may
+// serve older object state.
+const kSlibLogTag = 0
+
+func (s *slibStore) LastCommittedSeqnum(ctx context.Context) (uint64, error) {
+	tail, err := s.env.SharedLogCheckTail(ctx, kSlibLogTag)
+	if err != nil {
+		return 0, err
+	}
+	if tail == nil {
+		return 0, nil
+	}
+	return tail.SeqNum, nil
+}
+
+func (s *slibStore) WaitForSeqnum(ctx context.Context, seqnum uint64) error {
+	backoff := time.Millisecond
+	for {
+		tail, err := s.env.SharedLogCheckTail(ctx, kSlibLogTag)
+		if err != nil {
+			return err
+		}
+		if tail != nil && tail.SeqNum >= seqnum {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		if backoff < 64*time.Millisecond {
+			backoff *= 2
+		}
+	}
+}
+
+// Check reads everything within one read-only transaction, so violations
+// are not artifacts of concurrent updates.
+func (s *slibStore) Check(ctx context.Context, input *CheckInput) (*CheckOutput, error) {
+	txn, err := statestore.CreateReadOnlyTxnEnv(ctx, s.env)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &CheckOutput{Success: true, Violations: make([]string, 0)}
+	violation := func(format string, args ...interface{}) {
+		output.addViolation(input.MaxViolations, format, args...)
+	}
+
+	numUsers := 0
+	if value, _ := txn.Object("next_user_id").Get("value"); !value.IsNull() {
+		numUsers = int(value.AsNumber())
+	}
+	users := make(map[string]*statestore.ObjectRef)
+	for i := 0; i < numUsers; i++ {
+		userId := fmt.Sprintf("%08x", i)
+		userObj := txn.Object(fmt.Sprintf("userid:%s", userId))
+		if value, _ := userObj.Get("username"); !value.IsNull() {
+			users[userId] = userObj
+			nameObj := txn.Object(fmt.Sprintf("username:%s", value.AsString()))
+			if id, _ := nameObj.Get("id"); id.IsNull() || id.AsString() != userId {
+				violation("username:%s does not point to user %s", value.AsString(), userId)
+			}
+		}
+	}
+	output.NumUsers = len(users)
+	// Ids taken by failed registrations stay unused, so fewer users than
+	// next_user_id may exist, but none at or beyond it
+	nextUserObj := txn.Object(fmt.Sprintf("userid:%08x", numUsers))
+	if value, _ := nextUserObj.Get("username"); !value.IsNull() {
+		violation("next_user_id is %d, but user %08x exists", numUsers, numUsers)
+	}
+
+	hasRelation := func(userId string, field string, otherId string) bool {
+		userObj, exists := users[userId]
+		if !exists {
+			return false
+		}
+		value, _ := userObj.Get(fmt.Sprintf("%s.%s", field, otherId))
+		return !value.IsNull()
+	}
+	checkPostList := func(name string, postList statestore.Value) {
+		if postList.IsNull() {
+			return
+		}
+		for _, postId := range postList.AsArray() {
+			postObj := txn.Object(fmt.Sprintf("post:%s", postId.(string)))
+			// Deleted posts are tombstoned in place
+			if value, _ := postObj.Get("id"); value.IsNull() {
+				violation("%s contains post %s, which does not exist", name, postId.(string))
+			}
+		}
+	}
+
+	postIds := make(map[string]bool)
+	for userId, userObj := range users {
+		if value, _ := userObj.Get("followers"); !value.IsNull() {
+			for followerId := range value.AsObject() {
+				if !hasRelation(followerId, "followees", userId) {
+					violation("%s is a follower of %s, but not the other way around", followerId, userId)
+				}
+			}
+		}
+		if value, _ := userObj.Get("followees"); !value.IsNull() {
+			for followeeId := range value.AsObject() {
+				if !hasRelation(followeeId, "followers", userId) {
+					violation("%s is a followee of %s, but not the other way around", followeeId, userId)
+				}
+			}
+		}
+		inboxObj := txn.Object(fmt.Sprintf("inbox:%s", userId))
+		if value, _ := inboxObj.Get("unread"); !value.IsNull() {
+			sum := 0
+			for _, numUnread := range value.AsObject() {
+				sum += int(numUnread.(float64))
+			}
+			if total, _ := inboxObj.Get("numUnread"); total.IsNull() || int(total.AsNumber()) != sum {
+				violation("Unread counters of user %s do not add up to numUnread", userId)
+			}
+		}
+		value, _ := userObj.Get("posts")
+		checkPostList(fmt.Sprintf("Post list of user %s", userId), value)
+		if !value.IsNull() {
+			for _, postId := range value.AsArray() {
+				postIds[postId.(string)] = true
+			}
+		}
+	}
+	value, _ := txn.Object("timeline").Get("posts")
+	checkPostList("Timeline", value)
+	if !value.IsNull() {
+		for _, postId := range value.AsArray() {
+			postIds[postId.(string)] = true
+		}
+	}
+	output.NumPosts = len(postIds)
+
+	return output, nil
+}
@@ -0,0 +1,1014 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+type sqlStore struct {
+	db *sql.DB
+}
+
+func newSqlStore(db *sql.DB) *sqlStore {
+	return &sqlStore{db: db}
+}
+
+const kMysqlErrDupEntry = 1062
+
+// User ids are allocated from the next_user_id table starting from 1, while
+// Retwis user ids are zero-based hex strings (the format tools/ use to build
+// requests).
+func sqlUserIdToString(id int64) string {
+	return fmt.Sprintf("%08x", id-1)
+}
+
+func sqlUserIdFromString(userId string) (int64, error) {
+	id, err := strconv.ParseUint(userId, 16, 32)
+	if err != nil {
+		return 0, err
+	}
+	return int64(id) + 1, nil
+}
+
+func sqlPostIdToString(id int64) string {
+	return fmt.Sprintf("%016x", id)
+}
+
+func sqlPostIdFromString(postId string) (int64, error) {
+	id, err := strconv.ParseUint(postId, 16, 63)
+	if err != nil {
+		return 0, err
+	}
+	return int64(id), nil
+}
+
+var kSqlSchema = []string{
+	"DROP TABLE IF EXISTS next_user_id",
+	"DROP TABLE IF EXISTS users",
+	"DROP TABLE IF EXISTS posts",
+	"DROP TABLE IF EXISTS follow",
+	"DROP TABLE IF EXISTS block",
+	"DROP TABLE IF EXISTS post_history",
+	"DROP TABLE IF EXISTS likes",
+	"DROP TABLE IF EXISTS post_tags",
+	"DROP TABLE IF EXISTS mentions",
+	// Unlike AUTO_INCREMENT, which skips ids of failed INSERTs, the counter
+	// is updated in the transaction inserting the user, so ids stay dense
+	// as tools/ expect
+	`CREATE TABLE next_user_id (value BIGINT NOT NULL)`,
+	"INSERT INTO next_user_id (value) VALUES (0)",
+	`CREATE TABLE users (
+		user_id BIGINT NOT NULL PRIMARY KEY,
+		username VARCHAR(255) NOT NULL UNIQUE,
+		password VARCHAR(255) NOT NULL,
+		auth VARCHAR(255) NOT NULL,
+		followers INT NOT NULL DEFAULT 0,
+		followees INT NOT NULL DEFAULT 0,
+		posts INT NOT NULL DEFAULT 0)`,
+	`CREATE TABLE posts (
+		post_id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+		user_id BIGINT NOT NULL,
+		username VARCHAR(255) NOT NULL,
+		body VARCHAR(255) NOT NULL,
+		version INT NOT NULL DEFAULT 1,
+		likes INT NOT NULL DEFAULT 0,
+		INDEX (user_id),
+		FULLTEXT INDEX (body))`,
+	`CREATE TABLE follow (
+		user_id BIGINT NOT NULL,
+		followee_id BIGINT NOT NULL,
+		PRIMARY KEY (user_id, followee_id),
+		INDEX (followee_id))`,
+	`CREATE TABLE block (
+		user_id BIGINT NOT NULL,
+		blocked_id BIGINT NOT NULL,
+		PRIMARY KEY (user_id, blocked_id))`,
+	`CREATE TABLE post_history (
+		post_id BIGINT NOT NULL,
+		version INT NOT NULL,
+		body VARCHAR(255) NOT NULL,
+		PRIMARY KEY (post_id, version))`,
+	`CREATE TABLE likes (
+		post_id BIGINT NOT NULL,
+		user_id BIGINT NOT NULL,
+		PRIMARY KEY (post_id, user_id))`,
+	`CREATE TABLE post_tags (
+		tag VARCHAR(255) NOT NULL,
+		post_id BIGINT NOT NULL,
+		PRIMARY KEY (tag, post_id),
+		INDEX (post_id))`,
+	`CREATE TABLE mentions (
+		user_id BIGINT NOT NULL,
+		post_id BIGINT NOT NULL,
+		PRIMARY KEY (user_id, post_id),
+		INDEX (post_id))`,
+}
+
+func (s *sqlStore) Init(ctx context.Context) error {
+	for _, query := range kSqlSchema {
+		if _, err := s.db.ExecContext(ctx, query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sqlStore) RegisterUser(ctx context.Context, input *RegisterInput) (*RegisterOutput, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return &RegisterOutput{
+			Success: false,
+			Message: fmt.Sprintf("SQL failed: %v", err),
+		}, nil
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, "UPDATE next_user_id SET value = LAST_INSERT_ID(value + 1)")
+	if err != nil {
+		return &RegisterOutput{
+			Success: false,
+			Message: fmt.Sprintf("SQL failed: %v", err),
+		}, nil
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return &RegisterOutput{
+			Success: false,
+			Message: fmt.Sprintf("SQL failed: %v", err),
+		}, nil
+	}
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO users (user_id, username, password, auth) VALUES (?, ?, ?, ?)",
+		id, input.UserName, input.Password, fmt.Sprintf("%016x", rand.Uint64()))
+	if err != nil {
+		if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == kMysqlErrDupEntry {
+			return &RegisterOutput{
+				Success: false,
+				Message: fmt.Sprintf("User name \"%s\" already exists", input.UserName),
+			}, nil
+		}
+		return &RegisterOutput{
+			Success: false,
+			Message: fmt.Sprintf("SQL failed: %v", err),
+		}, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return &RegisterOutput{
+			Success: false,
+			Message: fmt.Sprintf("SQL failed: %v", err),
+		}, nil
+	}
+	return &RegisterOutput{
+		Success: true,
+		UserId:  sqlUserIdToString(id),
+	}, nil
+}
+
+func (s *sqlStore) Login(ctx context.Context, input *LoginInput) (*LoginOutput, error) {
+	var id int64
+	var password string
+	var auth string
+	row := s.db.QueryRowContext(ctx,
+		"SELECT user_id, password, auth FROM users WHERE username = ?", input.UserName)
+	if err := row.Scan(&id, &password, &auth); err == sql.ErrNoRows {
+		return &LoginOutput{
+			Success: false,
+			Message: fmt.Sprintf("User name \"%s\" does not exists", input.UserName),
+		}, nil
+	} else if err != nil {
+		return &LoginOutput{
+			Success: false,
+			Message: fmt.Sprintf("SQL failed: %v", err),
+		}, nil
+	}
+	if input.Password != password {
+		return &LoginOutput{
+			Success: false,
+			Message: "Incorrect password",
+		}, nil
+	}
+	return &LoginOutput{
+		Success: true,
+		UserId:  sqlUserIdToString(id),
+		Auth:    auth,
+	}, nil
+}
+
+// sqlLockUser locks the row of userId within tx, and reports its username.
+// Empty username means the user does not exist.
+func sqlLockUser(ctx context.Context, tx *sql.Tx, userId string) (int64, string, error) {
+	id, err := sqlUserIdFromString(userId)
+	if err != nil {
+		return 0, "", nil
+	}
+	var username string
+	row := tx.QueryRowContext(ctx, "SELECT username FROM users WHERE user_id = ? FOR UPDATE", id)
+	if err := row.Scan(&username); err == sql.ErrNoRows {
+		return id, "", nil
+	} else if err != nil {
+		return 0, "", err
+	}
+	return id, username, nil
+}
+
+func (s *sqlStore) Follow(ctx context.Context, input *FollowInput) (*FollowOutput, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return &FollowOutput{
+			Success: false,
+			Message: fmt.Sprintf("SQL failed: %v", err),
+		}, nil
+	}
+	defer tx.Rollback()
+
+	userId, userName, err := sqlLockUser(ctx, tx, input.UserId)
+	if err != nil {
+		return &FollowOutput{
+			Success: false,
+			Message: fmt.Sprintf("SQL failed: %v", err),
+		}, nil
+	} else if userName == "" {
+		return &FollowOutput{
+			Success: false,
+			Message: fmt.Sprintf("Cannot find user with ID %s", input.UserId),
+		}, nil
+	}
+	followeeId, followeeName, err := sqlLockUser(ctx, tx, input.FolloweeId)
+	if err != nil {
+		return &FollowOutput{
+			Success: false,
+			Message: fmt.Sprintf("SQL failed: %v", err),
+		}, nil
+	} else if followeeName == "" {
+		return &FollowOutput{
+			Success: false,
+			Message: fmt.Sprintf("Cannot find user with ID %s", input.FolloweeId),
+		}, nil
+	}
+
+	if !input.Unfollow {
+		var blocked int
+		row := tx.QueryRowContext(ctx,
+			"SELECT COUNT(*) FROM block WHERE user_id = ? AND blocked_id = ?", followeeId, userId)
+		if err := row.Scan(&blocked); err != nil {
+			return &FollowOutput{
+				Success: false,
+				Message: fmt.Sprintf("SQL failed: %v", err),
+			}, nil
+		} else if blocked > 0 {
+			return &FollowOutput{
+				Success: false,
+				Message: fmt.Sprintf("User %s has blocked user %s", input.FolloweeId, input.UserId),
+			}, nil
+		}
+	}
+
+	var res sql.Result
+	delta := 1
+	if input.Unfollow {
+		res, err = tx.ExecContext(ctx,
+			"DELETE FROM follow WHERE user_id = ? AND followee_id = ?", userId, followeeId)
+		delta = -1
+	} else {
+		res, err = tx.ExecContext(ctx,
+			"INSERT IGNORE INTO follow (user_id, followee_id) VALUES (?, ?)", userId, followeeId)
+	}
+	if err != nil {
+		return &FollowOutput{
+			Success: false,
+			Message: fmt.Sprintf("SQL failed: %v", err),
+		}, nil
+	}
+	// Counters only change when the relation actually changed
+	if rows, err := res.RowsAffected(); err == nil && rows > 0 {
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE users SET followees = followees + ? WHERE user_id = ?", delta, userId); err != nil {
+			return &FollowOutput{
+				Success: false,
+				Message: fmt.Sprintf("SQL failed: %v", err),
+			}, nil
+		}
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE users SET followers = followers + ? WHERE user_id = ?", delta, followeeId); err != nil {
+			return &FollowOutput{
+				Success: false,
+				Message: fmt.Sprintf("SQL failed: %v", err),
+			}, nil
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return &FollowOutput{
+			Success: false,
+			Message: fmt.Sprintf("SQL failed: %v", err),
+		}, nil
+	}
+	return &FollowOutput{Success: true}, nil
+}
+
+func (s *sqlStore) followList(ctx context.Context, input *FollowListInput, query string) (*FollowListOutput, error) {
+	userId, err := sqlUserIdFromString(input.UserId)
+	if err != nil {
+		return &FollowListOutput{
+			Success: false,
+			Message: fmt.Sprintf("Cannot find user with ID %s", input.UserId),
+		}, nil
+	}
+	var after int64
+	if input.Cursor != "" {
+		if after, err = sqlUserIdFromString(input.Cursor); err != nil {
+			return &FollowListOutput{
+				Success: false,
+				Message: "Invalid cursor",
+			}, nil
+		}
+	}
+
+	var exists int
+	row := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE user_id = ?", userId)
+	if err := row.Scan(&exists); err != nil {
+		return &FollowListOutput{
+			Success: false,
+			Message: fmt.Sprintf("SQL failed: %v", err),
+		}, nil
+	} else if exists == 0 {
+		return &FollowListOutput{
+			Success: false,
+			Message: fmt.Sprintf("Cannot find user with ID %s", input.UserId),
+		}, nil
+	}
+
+	pageSize := clampPageSize(input.PageSize)
+	rows, err := s.db.QueryContext(ctx, query, userId, after, pageSize)
+	if err != nil {
+		return &FollowListOutput{
+			Success: false,
+			Message: fmt.Sprintf("SQL failed: %v", err),
+		}, nil
+	}
+	defer rows.Close()
+
+	output := &FollowListOutput{
+		Success: true,
+		UserIds: make([]string, 0, pageSize),
+	}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return &FollowListOutput{
+				Success: false,
+				Message: fmt.Sprintf("SQL failed: %v", err),
+			}, nil
+		}
+		output.UserIds = append(output.UserIds, sqlUserIdToString(id))
+	}
+	if err := rows.Err(); err != nil {
+		return &FollowListOutput{
+			Success: false,
+			Message: fmt.Sprintf("SQL failed: %v", err),
+		}, nil
+	}
+	if len(output.UserIds) == pageSize {
+		output.NextCursor = output.UserIds[pageSize-1]
+	}
+	return output, nil
+}
+
+func (s *sqlStore) Followers(ctx context.Context, input *FollowListInput) (*FollowListOutput, error) {
+	return s.followList(ctx, input,
+		"SELECT user_id FROM follow WHERE followee_id = ? AND user_id > ? ORDER BY user_id LIMIT ?")
+}
+
+func (s *sqlStore) Followees(ctx context.Context, input *FollowListInput) (*FollowListOutput, error) {
+	return s.followList(ctx, input,
+		"SELECT followee_id FROM follow WHERE user_id = ? AND followee_id > ? ORDER BY followee_id LIMIT ?")
+}
+
+func (s *sqlStore) Block(ctx context.Context, input *BlockInput) (*BlockOutput, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return &BlockOutput{
+			Success: false,
+			Message: fmt.Sprintf("SQL failed: %v", err),
+		}, nil
+	}
+	defer tx.Rollback()
+
+	userId, userName, err := sqlLockUser(ctx, tx, input.UserId)
+	if err != nil {
+		return &BlockOutput{
+			Success: false,
+			Message: fmt.Sprintf("SQL failed: %v", err),
+		}, nil
+	} else if userName == "" {
+		return &BlockOutput{
+			Success: false,
+			Message: fmt.Sprintf("Cannot find user with ID %s", input.UserId),
+		}, nil
+	}
+	blockeeId, blockeeName, err := sqlLockUser(ctx, tx, input.BlockeeId)
+	if err != nil {
+		return &BlockOutput{
+			Success: false,
+			Message: fmt.Sprintf("SQL failed: %v", err),
+		}, nil
+	} else if blockeeName == "" {
+		return &BlockOutput{
+			Success: false,
+			Message: fmt.Sprintf("Cannot find user with ID %s", input.BlockeeId),
+		}, nil
+	}
+
+	if input.Unblock {
+		_, err = tx.ExecContext(ctx,
+			"DELETE FROM block WHERE user_id = ? AND blocked_id = ?", userId, blockeeId)
+	} else {
+		_, err = tx.ExecContext(ctx,
+			"INSERT IGNORE INTO block (user_id, blocked_id) VALUES (?, ?)", userId, blockeeId)
+	}
+	if err != nil {
+		return &BlockOutput{
+			Success: false,
+			Message: fmt.Sprintf("SQL failed: %v", err),
+		}, nil
+	}
+
+	if err := tx.Commit(); err != nil {
+		return &BlockOutput{
+			Success: false,
+			Message: fmt.Sprintf("SQL failed: %v", err),
+		}, nil
+	}
+	return &BlockOutput{Success: true}, nil
+}
+
+func (s *sqlStore) Post(ctx context.Context, input *PostInput) (*PostOutput, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return &PostOutput{
+			Success: false,
+			Message: fmt.Sprintf("SQL failed: %v", err),
+		}, nil
+	}
+	defer tx.Rollback()
+
+	userId, userName, err := sqlLockUser(ctx, tx, input.UserId)
+	if err != nil {
+		return &PostOutput{
+			Success: false,
+			Message: fmt.Sprintf("SQL failed: %v", err),
+		}, nil
+	} else if userName == "" {
+		return &PostOutput{
+			Success: false,
+			Message: fmt.Sprintf("Cannot find user with ID %s", input.UserId),
+		}, nil
+	}
+
+	res, err := tx.ExecContext(ctx,
+		"INSERT INTO posts (user_id, username, body) VALUES (?, ?, ?)",
+		userId, userName, input.Body)
+	if err != nil {
+		return &PostOutput{
+			Success: false,
+			Message: fmt.Sprintf("SQL failed: %v", err),
+		}, nil
+	}
+	postId, err := res.LastInsertId()
+	if err != nil {
+		return &PostOutput{
+			Success: false,
+			Message: fmt.Sprintf("SQL failed: %v", err),
+		}, nil
+	}
+	// Indexes reflect the body a post is created with
+	tags, mentions := parsePostBody(input.Body)
+	for _, tag := range tags {
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO post_tags (tag, post_id) VALUES (?, ?)", tag, postId); err != nil {
+			return &PostOutput{
+				Success: false,
+				Message: fmt.Sprintf("SQL failed: %v", err),
+			}, nil
+		}
+	}
+	for _, mention := range mentions {
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO mentions (user_id, post_id) SELECT user_id, ? FROM users WHERE username = ?",
+			postId, mention); err != nil {
+			return &PostOutput{
+				Success: false,
+				Message: fmt.Sprintf("SQL failed: %v", err),
+			}, nil
+		}
+	}
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE users SET posts = posts + 1 WHERE user_id = ?", userId); err != nil {
+		return &PostOutput{
+			Success: false,
+			Message: fmt.Sprintf("SQL failed: %v", err),
+		}, nil
+	}
+
+	if err := tx.Commit(); err != nil {
+		return &PostOutput{
+			Success: false,
+			Message: fmt.Sprintf("SQL failed: %v", err),
+		}, nil
+	}
+	return &PostOutput{Success: true}, nil
+}
+
+// Posts are never evicted from the posts table, so post_id serves as the
+// cursor seqnum and pages can go arbitrarily deep.
+func (s *sqlStore) PostList(ctx context.Context, input *PostListInput) (*PostListOutput, error) {
+	cursor, err := decodePostListCursor(input.Cursor)
+	if err != nil {
+		return &PostListOutput{
+			Success: false,
+			Message: "Invalid cursor",
+		}, nil
+	}
+
+	conds := make([]string, 0, 3)
+	args := make([]interface{}, 0, 4)
+	query := "SELECT posts.post_id, posts.user_id, posts.body, posts.username FROM posts"
+	if input.UserId != "" {
+		userId, parseErr := sqlUserIdFromString(input.UserId)
+		if parseErr != nil {
+			return &PostListOutput{
+				Success: false,
+				Message: fmt.Sprintf("Cannot find user with ID %s", input.UserId),
+			}, nil
+		}
+		// Timeline of a user consists of posts from users it follows,
+		// except those who block it
+		query += " INNER JOIN follow ON posts.user_id = follow.followee_id"
+		conds = append(conds, "follow.user_id = ?", `NOT EXISTS (SELECT 1 FROM block
+			WHERE block.user_id = posts.user_id AND block.blocked_id = follow.user_id)`)
+		args = append(args, userId)
+	}
+	offset := input.Skip
+	if cursor != nil {
+		conds = append(conds, "posts.post_id < ?")
+		args = append(args, cursor.Seqnum)
+		offset = 0
+	}
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	pageSize := clampPageSize(input.PageSize)
+	query += " ORDER BY posts.post_id DESC LIMIT ? OFFSET ?"
+	args = append(args, pageSize, offset)
+
+	return s.queryPosts(ctx, query, args, pageSize), nil
+}
+
+// queryPosts runs query which selects post_id, user_id, body and username of
+// at most pageSize posts ordered by post_id descendingly
+func (s *sqlStore) queryPosts(ctx context.Context, query string, args []interface{}, pageSize int) *PostListOutput {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return &PostListOutput{
+			Success: false,
+			Message: fmt.Sprintf("SQL failed: %v", err),
+		}
+	}
+	defer rows.Close()
+
+	output := &PostListOutput{
+		Success: true,
+		Posts:   make([]interface{}, 0, pageSize),
+	}
+	var postId int64
+	for rows.Next() {
+		var userId int64
+		var body string
+		var username string
+		if err := rows.Scan(&postId, &userId, &body, &username); err != nil {
+			return &PostListOutput{
+				Success: false,
+				Message: fmt.Sprintf("SQL failed: %v", err),
+			}
+		}
+		output.Posts = append(output.Posts, map[string]string{
+			"id":     sqlPostIdToString(postId),
+			"userId": sqlUserIdToString(userId),
+			"body":   body,
+			"user":   username,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return &PostListOutput{
+			Success: false,
+			Message: fmt.Sprintf("SQL failed: %v", err),
+		}
+	}
+	if len(output.Posts) == pageSize {
+		output.NextCursor = encodePostListCursor(uint64(postId), "")
+	}
+	return output
+}
+
+func (s *sqlStore) TagTimeline(ctx context.Context, input *TagTimelineInput) (*PostListOutput, error) {
+	return s.readIndex(ctx,
+		`SELECT posts.post_id, posts.user_id, posts.body, posts.username FROM posts
+		 INNER JOIN post_tags ON posts.post_id = post_tags.post_id
+		 WHERE post_tags.tag = ? AND posts.post_id < ? ORDER BY posts.post_id DESC LIMIT ?`,
+		strings.ToLower(input.Tag), input.Cursor, input.PageSize)
+}
+
+func (s *sqlStore) Mentions(ctx context.Context, input *MentionsInput) (*PostListOutput, error) {
+	userId, err := sqlUserIdFromString(input.UserId)
+	if err != nil {
+		return &PostListOutput{
+			Success: false,
+			Message: fmt.Sprintf("Cannot find user with ID %s", input.UserId),
+		}, nil
+	}
+	return s.readIndex(ctx,
+		`SELECT posts.post_id, posts.user_id, posts.body, posts.username FROM posts
+		 INNER JOIN mentions ON posts.post_id = mentions.post_id
+		 WHERE mentions.user_id = ? AND posts.post_id < ? ORDER BY posts.post_id DESC LIMIT ?`,
+		userId, input.Cursor, input.PageSize)
+}
+
+// Search requires every keyword in boolean mode. Keywords are word
+// characters only, so they carry no boolean operators.
+func (s *sqlStore) Search(ctx context.Context, input *SearchInput) (*PostListOutput, error) {
+	keywords := parseKeywords(input.Query)
+	terms := make([]string, 0, len(keywords))
+	for _, keyword := range keywords {
+		terms = append(terms, "+"+keyword)
+	}
+	return s.readIndex(ctx,
+		`SELECT post_id, user_id, body, username FROM posts
+		 WHERE MATCH (body) AGAINST (? IN BOOLEAN MODE) AND post_id < ? ORDER BY post_id DESC LIMIT ?`,
+		strings.Join(terms, " "), input.Cursor, input.PageSize)
+}
+
+// readIndex runs query with key, the post_id bound from cursor, and page size
+func (s *sqlStore) readIndex(ctx context.Context, query string, key interface{}, cursor string, pageSize int) (*PostListOutput, error) {
+	parsedCursor, err := decodePostListCursor(cursor)
+	if err != nil {
+		return &PostListOutput{
+			Success: false,
+			Message: "Invalid cursor",
+		}, nil
+	}
+	before := uint64(math.MaxInt64)
+	if parsedCursor != nil {
+		before = parsedCursor.Seqnum
+	}
+	pageSize = clampPageSize(pageSize)
+	return s.queryPosts(ctx, query, []interface{}{key, before, pageSize}, pageSize), nil
+}
+
+// sqlLockPost locks the row of postId within tx, and checks it is authored
+// by userId unless userId is empty. On failure, the message tells the reason.
+func sqlLockPost(ctx context.Context, tx *sql.Tx, postId string, userId string) (int64, string, error) {
+	id, err := sqlPostIdFromString(postId)
+	if err != nil {
+		return 0, fmt.Sprintf("Cannot find post with ID %s", postId), nil
+	}
+	var authorId int64
+	row := tx.QueryRowContext(ctx, "SELECT user_id FROM posts WHERE post_id = ? FOR UPDATE", id)
+	if err := row.Scan(&authorId); err == sql.ErrNoRows {
+		return 0, fmt.Sprintf("Cannot find post with ID %s", postId), nil
+	} else if err != nil {
+		return 0, "", err
+	}
+	if userId != "" && sqlUserIdToString(authorId) != userId {
+		return 0, fmt.Sprintf("Post %s is not authored by user %s", postId, userId), nil
+	}
+	return id, "", nil
+}
+
+func (s *sqlStore) DeletePost(ctx context.Context, input *DeletePostInput) (*DeletePostOutput, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return &DeletePostOutput{
+			Success: false,
+			Message: fmt.Sprintf("SQL failed: %v", err),
+		}, nil
+	}
+	defer tx.Rollback()
+
+	userId, err := sqlUserIdFromString(input.UserId)
+	if err != nil {
+		return &DeletePostOutput{
+			Success: false,
+			Message: fmt.Sprintf("Cannot find user with ID %s", input.UserId),
+		}, nil
+	}
+	postId, message, err := sqlLockPost(ctx, tx, input.PostId, input.UserId)
+	if err != nil {
+		return &DeletePostOutput{
+			Success: false,
+			Message: fmt.Sprintf("SQL failed: %v", err),
+		}, nil
+	} else if message != "" {
+		return &DeletePostOutput{
+			Success: false,
+			Message: message,
+		}, nil
+	}
+
+	// Post lists are queried from the posts table, so deleting the row
+	// removes the post from all of them
+	queries := []string{
+		"DELETE FROM posts WHERE post_id = ?",
+		"DELETE FROM post_history WHERE post_id = ?",
+		"DELETE FROM likes WHERE post_id = ?",
+		"DELETE FROM post_tags WHERE post_id = ?",
+		"DELETE FROM mentions WHERE post_id = ?",
+	}
+	for _, query := range queries {
+		if _, err := tx.ExecContext(ctx, query, postId); err != nil {
+			return &DeletePostOutput{
+				Success: false,
+				Message: fmt.Sprintf("SQL failed: %v", err),
+			}, nil
+		}
+	}
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE users SET posts = posts - 1 WHERE user_id = ?", userId); err != nil {
+		return &DeletePostOutput{
+			Success: false,
+			Message: fmt.Sprintf("SQL failed: %v", err),
+		}, nil
+	}
+
+	if err := tx.Commit(); err != nil {
+		return &DeletePostOutput{
+			Success: false,
+			Message: fmt.Sprintf("SQL failed: %v", err),
+		}, nil
+	}
+	return &DeletePostOutput{Success: true}, nil
+}
+
+func (s *sqlStore) EditPost(ctx context.Context, input *EditPostInput) (*EditPostOutput, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return &EditPostOutput{
+			Success: false,
+			Message: fmt.Sprintf("SQL failed: %v", err),
+		}, nil
+	}
+	defer tx.Rollback()
+
+	postId, message, err := sqlLockPost(ctx, tx, input.PostId, input.UserId)
+	if err != nil {
+		return &EditPostOutput{
+			Success: false,
+			Message: fmt.Sprintf("SQL failed: %v", err),
+		}, nil
+	} else if message != "" {
+		return &EditPostOutput{
+			Success: false,
+			Message: message,
+		}, nil
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO post_history (post_id, version, body)
+		 SELECT post_id, version, body FROM posts WHERE post_id = ?`, postId); err != nil {
+		return &EditPostOutput{
+			Success: false,
+			Message: fmt.Sprintf("SQL failed: %v", err),
+		}, nil
+	}
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE posts SET body = ?, version = version + 1 WHERE post_id = ?", input.Body, postId); err != nil {
+		return &EditPostOutput{
+			Success: false,
+			Message: fmt.Sprintf("SQL failed: %v", err),
+		}, nil
+	}
+	output := &EditPostOutput{Success: true}
+	row := tx.QueryRowContext(ctx, "SELECT version FROM posts WHERE post_id = ?", postId)
+	if err := row.Scan(&output.Version); err != nil {
+		return &EditPostOutput{
+			Success: false,
+			Message: fmt.Sprintf("SQL failed: %v", err),
+		}, nil
+	}
+
+	if err := tx.Commit(); err != nil {
+		return &EditPostOutput{
+			Success: false,
+			Message: fmt.Sprintf("SQL failed: %v", err),
+		}, nil
+	}
+	return output, nil
+}
+
+func (s *sqlStore) LikePost(ctx context.Context, input *LikePostInput) (*LikePostOutput, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return &LikePostOutput{
+			Success: false,
+			Message: fmt.Sprintf("SQL failed: %v", err),
+		}, nil
+	}
+	defer tx.Rollback()
+
+	userId, userName, err := sqlLockUser(ctx, tx, input.UserId)
+	if err != nil {
+		return &LikePostOutput{
+			Success: false,
+			Message: fmt.Sprintf("SQL failed: %v", err),
+		}, nil
+	} else if userName == "" {
+		return &LikePostOutput{
+			Success: false,
+			Message: fmt.Sprintf("Cannot find user with ID %s", input.UserId),
+		}, nil
+	}
+	postId, message, err := sqlLockPost(ctx, tx, input.PostId, "")
+	if err != nil {
+		return &LikePostOutput{
+			Success: false,
+			Message: fmt.Sprintf("SQL failed: %v", err),
+		}, nil
+	} else if message != "" {
+		return &LikePostOutput{
+			Success: false,
+			Message: message,
+		}, nil
+	}
+
+	var res sql.Result
+	delta := 1
+	if input.Unlike {
+		res, err = tx.ExecContext(ctx,
+			"DELETE FROM likes WHERE post_id = ? AND user_id = ?", postId, userId)
+		delta = -1
+	} else {
+		res, err = tx.ExecContext(ctx,
+			"INSERT IGNORE INTO likes (post_id, user_id) VALUES (?, ?)", postId, userId)
+	}
+	if err != nil {
+		return &LikePostOutput{
+			Success: false,
+			Message: fmt.Sprintf("SQL failed: %v", err),
+		}, nil
+	}
+	// Counter only changes when the like actually changed
+	if rows, err := res.RowsAffected(); err == nil && rows > 0 {
+		if _, err := tx.ExecContext(ctx,
+			"UPDATE posts SET likes = likes + ? WHERE post_id = ?", delta, postId); err != nil {
+			return &LikePostOutput{
+				Success: false,
+				Message: fmt.Sprintf("SQL failed: %v", err),
+			}, nil
+		}
+	}
+	output := &LikePostOutput{Success: true}
+	row := tx.QueryRowContext(ctx, "SELECT likes FROM posts WHERE post_id = ?", postId)
+	if err := row.Scan(&output.NumLikes); err != nil {
+		return &LikePostOutput{
+			Success: false,
+			Message: fmt.Sprintf("SQL failed: %v", err),
+		}, nil
+	}
+
+	if err := tx.Commit(); err != nil {
+		return &LikePostOutput{
+			Success: false,
+			Message: fmt.Sprintf("SQL failed: %v", err),
+		}, nil
+	}
+	return output, nil
+}
+
+func (s *sqlStore) Profile(ctx context.Context, input *ProfileInput) (*ProfileOutput, error) {
+	userId, err := sqlUserIdFromString(input.UserId)
+	if err != nil {
+		return &ProfileOutput{
+			Success: false,
+			Message: fmt.Sprintf("Cannot find user with ID %s", input.UserId),
+		}, nil
+	}
+	output := &ProfileOutput{Success: true}
+	row := s.db.QueryRowContext(ctx,
+		"SELECT username, followers, followees, posts FROM users WHERE user_id = ?", userId)
+	err = row.Scan(&output.UserName, &output.NumFollowers, &output.NumFollowees, &output.NumPosts)
+	if err == sql.ErrNoRows {
+		return &ProfileOutput{
+			Success: false,
+			Message: fmt.Sprintf("Cannot find user with ID %s", input.UserId),
+		}, nil
+	} else if err != nil {
+		return &ProfileOutput{
+			Success: false,
+			Message: fmt.Sprintf("SQL failed: %v", err),
+		}, nil
+	}
+	return output, nil
+}
+
+// kSqlCheckQueries select one row per violation, with a single string
+// column describing it. Ids are formatted as in Retwis requests.
+var kSqlCheckQueries = []string{
+	`SELECT CONCAT('follow references missing user ', LOWER(LPAD(HEX(f.user_id - 1), 8, '0')))
+	 FROM follow f LEFT JOIN users u ON f.user_id = u.user_id WHERE u.user_id IS NULL`,
+	`SELECT CONCAT('follow references missing followee ', LOWER(LPAD(HEX(f.followee_id - 1), 8, '0')))
+	 FROM follow f LEFT JOIN users u ON f.followee_id = u.user_id WHERE u.user_id IS NULL`,
+	`SELECT CONCAT('user ', LOWER(LPAD(HEX(u.user_id - 1), 8, '0')), ' has followers counter ', u.followers, ' but ', COUNT(f.user_id), ' followers')
+	 FROM users u LEFT JOIN follow f ON f.followee_id = u.user_id
+	 GROUP BY u.user_id, u.followers HAVING u.followers <> COUNT(f.user_id)`,
+	`SELECT CONCAT('user ', LOWER(LPAD(HEX(u.user_id - 1), 8, '0')), ' has followees counter ', u.followees, ' but ', COUNT(f.followee_id), ' followees')
+	 FROM users u LEFT JOIN follow f ON f.user_id = u.user_id
+	 GROUP BY u.user_id, u.followees HAVING u.followees <> COUNT(f.followee_id)`,
+	`SELECT CONCAT('user ', LOWER(LPAD(HEX(u.user_id - 1), 8, '0')), ' has posts counter ', u.posts, ' but ', COUNT(p.post_id), ' posts')
+	 FROM users u LEFT JOIN posts p ON p.user_id = u.user_id
+	 GROUP BY u.user_id, u.posts HAVING u.posts <> COUNT(p.post_id)`,
+	`SELECT CONCAT('post ', LOWER(LPAD(HEX(p.post_id), 16, '0')), ' references missing user ', LOWER(LPAD(HEX(p.user_id - 1), 8, '0')))
+	 FROM posts p LEFT JOIN users u ON p.user_id = u.user_id WHERE u.user_id IS NULL`,
+	`SELECT CONCAT('post ', LOWER(LPAD(HEX(p.post_id), 16, '0')), ' has likes counter ', p.likes, ' but ', COUNT(l.user_id), ' likes')
+	 FROM posts p LEFT JOIN likes l ON l.post_id = p.post_id
+	 GROUP BY p.post_id, p.likes HAVING p.likes <> COUNT(l.user_id)`,
+	`SELECT CONCAT('likes references missing post ', LOWER(LPAD(HEX(l.post_id), 16, '0')))
+	 FROM likes l LEFT JOIN posts p ON l.post_id = p.post_id WHERE p.post_id IS NULL`,
+	`SELECT CONCAT('post_tags references missing post ', LOWER(LPAD(HEX(t.post_id), 16, '0')))
+	 FROM post_tags t LEFT JOIN posts p ON t.post_id = p.post_id WHERE p.post_id IS NULL`,
+	`SELECT CONCAT('mentions references missing post ', LOWER(LPAD(HEX(m.post_id), 16, '0')))
+	 FROM mentions m LEFT JOIN posts p ON m.post_id = p.post_id WHERE p.post_id IS NULL`,
+}
+
+// Check runs all queries within one read-only transaction, so violations
+// are not artifacts of concurrent updates.
+func (s *sqlStore) Check(ctx context.Context, input *CheckInput) (*CheckOutput, error) {
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return &CheckOutput{
+			Success: false,
+			Message: fmt.Sprintf("SQL failed: %v", err),
+		}, nil
+	}
+	defer tx.Rollback()
+
+	output := &CheckOutput{Success: true, Violations: make([]string, 0)}
+
+	// Every user takes an id up to next_user_id, like in the other stores,
+	// where failed registrations leave ids unused
+	var nextUserId, maxUserId int64
+	row := tx.QueryRowContext(ctx,
+		"SELECT (SELECT value FROM next_user_id), COUNT(*), COALESCE(MAX(user_id), 0) FROM users")
+	if err := row.Scan(&nextUserId, &output.NumUsers, &maxUserId); err != nil {
+		return &CheckOutput{
+			Success: false,
+			Message: fmt.Sprintf("SQL failed: %v", err),
+		}, nil
+	}
+	if int64(output.NumUsers) > nextUserId || maxUserId > nextUserId {
+		output.addViolation(input.MaxViolations,
+			"next_user_id is %d, but %d users exist, up to id %d", nextUserId, output.NumUsers, maxUserId)
+	}
+	row = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM posts")
+	if err := row.Scan(&output.NumPosts); err != nil {
+		return &CheckOutput{
+			Success: false,
+			Message: fmt.Sprintf("SQL failed: %v", err),
+		}, nil
+	}
+
+	for _, query := range kSqlCheckQueries {
+		rows, err := tx.QueryContext(ctx, query)
+		if err != nil {
+			return &CheckOutput{
+				Success: false,
+				Message: fmt.Sprintf("SQL failed: %v", err),
+			}, nil
+		}
+		for rows.Next() {
+			var violation string
+			if err := rows.Scan(&violation); err != nil {
+				rows.Close()
+				return &CheckOutput{
+					Success: false,
+					Message: fmt.Sprintf("SQL failed: %v", err),
+				}, nil
+			}
+			output.addViolation(input.MaxViolations, "%s", violation)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return &CheckOutput{
+				Success: false,
+				Message: fmt.Sprintf("SQL failed: %v", err),
+			}, nil
+		}
+	}
+
+	return output, nil
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+
+	"cs.utexas.edu/zjia/faas-retwis/utils"
+
+	"cs.utexas.edu/zjia/faas/types"
+)
+
+// RetwisStore is implemented by every storage backend of Retwis. Handlers
+// only parse requests and delegate to a RetwisStore, so adding a backend
+// means adding a driver here and registering its kind in NewRetwisStore.
+type RetwisStore interface {
+	Init(ctx context.Context) error
+	RegisterUser(ctx context.Context, input *RegisterInput) (*RegisterOutput, error)
+	Login(ctx context.Context, input *LoginInput) (*LoginOutput, error)
+	Follow(ctx context.Context, input *FollowInput) (*FollowOutput, error)
+	Followers(ctx context.Context, input *FollowListInput) (*FollowListOutput, error)
+	Followees(ctx context.Context, input *FollowListInput) (*FollowListOutput, error)
+	Block(ctx context.Context, input *BlockInput) (*BlockOutput, error)
+	Post(ctx context.Context, input *PostInput) (*PostOutput, error)
+	PostList(ctx context.Context, input *PostListInput) (*PostListOutput, error)
+	Profile(ctx context.Context, input *ProfileInput) (*ProfileOutput, error)
+}
+
+// PostUpdater is implemented by stores that can change a post after it is
+// created. Other stores reply to these functions with kNotSupportedMessage.
+type PostUpdater interface {
+	DeletePost(ctx context.Context, input *DeletePostInput) (*DeletePostOutput, error)
+	EditPost(ctx context.Context, input *EditPostInput) (*EditPostOutput, error)
+	LikePost(ctx context.Context, input *LikePostInput) (*LikePostOutput, error)
+}
+
+// PostIndex is implemented by stores that index posts by hashtags, mentioned
+// users and keywords.
+type PostIndex interface {
+	TagTimeline(ctx context.Context, input *TagTimelineInput) (*PostListOutput, error)
+	Mentions(ctx context.Context, input *MentionsInput) (*PostListOutput, error)
+	Search(ctx context.Context, input *SearchInput) (*PostListOutput, error)
+}
+
+// Checker is implemented by stores that can scan all state for violations of
+// Retwis invariants, e.g. after a benchmark run.
+type Checker interface {
+	Check(ctx context.Context, input *CheckInput) (*CheckOutput, error)
+}
+
+// Messenger is implemented by stores that support private conversations
+// between two users. Only the slib store does: Mongo, Redis and SQL stores
+// reply to these functions with kNotSupportedMessage.
+type Messenger interface {
+	SendMessage(ctx context.Context, input *SendMessageInput) (*SendMessageOutput, error)
+	ListConversations(ctx context.Context, input *ListConversationsInput) (*ListConversationsOutput, error)
+	ReadConversation(ctx context.Context, input *ReadConversationInput) (*ReadConversationOutput, error)
+}
+
+const kNotSupportedMessage = "Not supported by this store"
+
+const kMaxNotifyUsers = 4
+const kUserPostListLimit = 24
+const kTimeLinePostListLimit = 96
+const kMaxReturnPosts = 8
+const kMaxTagsPerPost = 8
+const kTagPostListLimit = 96
+const kMentionPostListLimit = 96
+const kMinKeywordLength = 3
+const kMaxKeywordsPerPost = 16
+const kKeywordPostListLimit = 96
+const kMaxPageSize = 64
+const kConversationMessageLimit = 96
+
+func clampPageSize(pageSize int) int {
+	if pageSize <= 0 {
+		return kMaxReturnPosts
+	} else if pageSize > kMaxPageSize {
+		return kMaxPageSize
+	} else {
+		return pageSize
+	}
+}
+
+// Posts evicted from a user post list are moved to archive chunks of this size
+const kArchiveChunkSize = kUserPostListLimit
+
+func NewRetwisStore(kind string, env types.Environment) RetwisStore {
+	switch kind {
+	case "slib":
+		return newSlibStore(env)
+	case "mongo":
+		return newMongoStore(utils.CreateMongoClientOrDie(context.TODO()))
+	case "sql":
+		return newSqlStore(utils.CreateSqlDbOrDie())
+	case "redis":
+		return newRedisStore(utils.CreateRedisClientOrDie(context.TODO()))
+	default:
+		panic(fmt.Sprintf("Unknown kind: %s", kind))
+	}
+}
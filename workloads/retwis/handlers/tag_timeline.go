@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+
+	"cs.utexas.edu/zjia/faas/types"
+)
+
+// Tag is matched without the leading '#', and case-insensitively
+type TagTimelineInput struct {
+	Tag          string `json:"tag"`
+	Cursor       string `json:"cursor,omitempty"`
+	PageSize     int    `json:"pageSize,omitempty"`
+	SessionToken string `json:"sessionToken,omitempty"`
+}
+
+type tagTimelineHandler struct {
+	store RetwisStore
+}
+
+func NewTagTimelineHandler(store RetwisStore) types.FuncHandler {
+	return &tagTimelineHandler{store: store}
+}
+
+func (h *tagTimelineHandler) onRequest(ctx context.Context, input *TagTimelineInput) (*PostListOutput, error) {
+	index, ok := h.store.(PostIndex)
+	if !ok {
+		return &PostListOutput{
+			Success: false,
+			Message: kNotSupportedMessage,
+		}, nil
+	}
+	if message, err := waitForSession(ctx, h.store, input.SessionToken); err != nil {
+		return nil, err
+	} else if message != "" {
+		return &PostListOutput{Success: false, Message: message}, nil
+	}
+	return index.TagTimeline(ctx, input)
+}
+
+func (h *tagTimelineHandler) Call(ctx context.Context, input []byte) ([]byte, error) {
+	parsedInput := &TagTimelineInput{}
+	err := json.Unmarshal(input, parsedInput)
+	if err != nil {
+		return nil, err
+	}
+	output, err := h.onRequest(ctx, parsedInput)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(output)
+}
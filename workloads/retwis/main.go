@@ -2,6 +2,8 @@ package main
 
 import (
 	"fmt"
+	"os"
+	"strings"
 
 	"cs.utexas.edu/zjia/faas-retwis/handlers"
 
@@ -12,38 +14,51 @@ import (
 type funcHandlerFactory struct {
 }
 
+var kHandlerConstructors = map[string]func(handlers.RetwisStore) types.FuncHandler{
+	"RetwisInit":              handlers.NewInitHandler,
+	"RetwisRegister":          handlers.NewRegisterHandler,
+	"RetwisLogin":             handlers.NewLoginHandler,
+	"RetwisProfile":           handlers.NewProfileHandler,
+	"RetwisFollow":            handlers.NewFollowHandler,
+	"RetwisFollowers":         handlers.NewFollowersHandler,
+	"RetwisFollowees":         handlers.NewFolloweesHandler,
+	"RetwisBlock":             handlers.NewBlockHandler,
+	"RetwisPost":              handlers.NewPostHandler,
+	"RetwisPostList":          handlers.NewPostListHandler,
+	"RetwisDeletePost":        handlers.NewDeletePostHandler,
+	"RetwisEditPost":          handlers.NewEditPostHandler,
+	"RetwisLikePost":          handlers.NewLikePostHandler,
+	"RetwisTagTimeline":       handlers.NewTagTimelineHandler,
+	"RetwisMentions":          handlers.NewMentionsHandler,
+	"RetwisSearch":            handlers.NewSearchHandler,
+	"RetwisCheck":             handlers.NewCheckHandler,
+	"RetwisSendMessage":       handlers.NewSendMessageHandler,
+	"RetwisListConversations": handlers.NewListConversationsHandler,
+	"RetwisReadConversation":  handlers.NewReadConversationHandler,
+}
+
+// Function names prefixed by a store kind (e.g. "mongoRetwisPost") select
+// that backend. Unprefixed names use RETWIS_STORE, which defaults to "slib".
+var kStorePrefixes = []string{"mongo", "sql", "redis"}
+
+func parseFuncName(funcName string) (string /* kind */, string /* name */) {
+	for _, prefix := range kStorePrefixes {
+		if strings.HasPrefix(funcName, prefix+"Retwis") {
+			return prefix, strings.TrimPrefix(funcName, prefix)
+		}
+	}
+	if kind, exists := os.LookupEnv("RETWIS_STORE"); exists {
+		return kind, funcName
+	} else {
+		return "slib", funcName
+	}
+}
+
 func (f *funcHandlerFactory) New(env types.Environment, funcName string) (types.FuncHandler, error) {
-	switch funcName {
-	case "RetwisInit":
-		return handlers.NewSlibInitHandler(env), nil
-	case "RetwisRegister":
-		return handlers.NewSlibRegisterHandler(env), nil
-	case "RetwisLogin":
-		return handlers.NewSlibLoginHandler(env), nil
-	case "RetwisProfile":
-		return handlers.NewSlibProfileHandler(env), nil
-	case "RetwisFollow":
-		return handlers.NewSlibFollowHandler(env), nil
-	case "RetwisPost":
-		return handlers.NewSlibPostHandler(env), nil
-	case "RetwisPostList":
-		return handlers.NewSlibPostListHandler(env), nil
-	case "mongoRetwisInit":
-		fmt.Println("jabulani")
-		return handlers.NewMongoInitHandler(env), nil
-	case "mongoRetwisRegister":
-		return handlers.NewMongoRegisterHandler(env), nil
-	case "mongoRetwisLogin":
-		return handlers.NewMongoLoginHandler(env), nil
-	case "mongoRetwisProfile":
-		return handlers.NewMongoProfileHandler(env), nil
-	case "mongoRetwisFollow":
-		return handlers.NewMongoFollowHandler(env), nil
-	case "mongoRetwisPost":
-		return handlers.NewMongoPostHandler(env), nil
-	case "mongoRetwisPostList":
-		return handlers.NewMongoPostListHandler(env), nil
-	default:
+	kind, name := parseFuncName(funcName)
+	if newHandler, exists := kHandlerConstructors[name]; exists {
+		return newHandler(handlers.NewRetwisStore(kind, env)), nil
+	} else {
 		return nil, fmt.Errorf("Unknown function name: %s", funcName)
 	}
 }
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"math/rand"
+	"net/http"
 	"strconv"
 	"strings"
 	"time"
@@ -22,6 +23,21 @@ var FLAGS_duration int
 var FLAGS_percentages string
 var FLAGS_bodylen int
 var FLAGS_rand_seed int
+var FLAGS_page_size int
+var FLAGS_deep_page_percentage int
+var FLAGS_max_page_depth int
+var FLAGS_num_seed_posts int
+var FLAGS_num_tags int
+var FLAGS_zipf_exponent float64
+var FLAGS_mention_percentage int
+var FLAGS_trace string
+var FLAGS_time_scale float64
+var FLAGS_record_trace string
+var FLAGS_target_rate float64
+var FLAGS_max_inflight int
+var FLAGS_num_contacts int
+var FLAGS_num_abusive_users int
+var FLAGS_abusive_percentage int
 
 func init() {
 	flag.StringVar(&FLAGS_faas_gateway, "faas_gateway", "127.0.0.1:8081", "")
@@ -29,19 +45,35 @@ func init() {
 	flag.IntVar(&FLAGS_num_users, "num_users", 1000, "")
 	flag.IntVar(&FLAGS_concurrency, "concurrency", 1, "")
 	flag.IntVar(&FLAGS_duration, "duration", 10, "")
-	flag.StringVar(&FLAGS_percentages, "percentages", "25,25,25,25", "login,profile,postlist,post")
+	flag.StringVar(&FLAGS_percentages, "percentages", "25,25,25,25", "login,profile,postlist,post[,follow,followers,followees,block,like,edit,delete,tagtimeline,mentions,message,conversations,readconversation,search]")
 	flag.IntVar(&FLAGS_bodylen, "bodylen", 64, "")
 	flag.IntVar(&FLAGS_rand_seed, "rand_seed", 23333, "")
+	flag.IntVar(&FLAGS_page_size, "page_size", 8, "Number of posts per postlist request")
+	flag.IntVar(&FLAGS_deep_page_percentage, "deep_page_percentage", 0, "Percentage of postlist requests reading a deep page")
+	flag.Float64Var(&FLAGS_zipf_exponent, "zipf_exponent", 0, "Skew of user popularity, 0 for uniform")
+	flag.IntVar(&FLAGS_num_tags, "num_tags", 0, "Posts carry one of this many hashtags, 0 for no hashtags")
+	flag.IntVar(&FLAGS_mention_percentage, "mention_percentage", 0, "Percentage of posts mentioning a random user")
+	flag.Float64Var(&FLAGS_target_rate, "target_rate", 0, "Requests per sec with Poisson arrivals (open loop), 0 for closed loop")
+	flag.IntVar(&FLAGS_max_inflight, "max_inflight", 0, "Caps requests in flight in open loop and trace replay, 0 for no cap")
+	flag.StringVar(&FLAGS_trace, "trace", "", "Replay requests from this trace file, instead of generating them")
+	flag.Float64Var(&FLAGS_time_scale, "time_scale", 1.0, "Multiplies gaps between replayed requests, e.g. 0.5 replays twice as fast")
+	flag.StringVar(&FLAGS_record_trace, "record_trace", "", "Record sent requests into this trace file")
+	flag.IntVar(&FLAGS_num_seed_posts, "num_seed_posts", 256, "Number of existing posts targeted by like, edit and delete requests")
+	flag.IntVar(&FLAGS_num_contacts, "num_contacts", 8, "Users only exchange messages with this many contacts")
+	flag.IntVar(&FLAGS_num_abusive_users, "num_abusive_users", 0, "Number of users, taken from the highest ids, that flood post and follow requests")
+	flag.IntVar(&FLAGS_abusive_percentage, "abusive_percentage", 50, "Percentage of post and follow requests issued by abusive users")
+	flag.IntVar(&FLAGS_max_page_depth, "max_page_depth", 16, "Deep pages are chosen uniformly from [1, max_page_depth]")
 
 	rand.Seed(int64(FLAGS_rand_seed))
 }
 
+// Trailing request types can be omitted from --percentages, and get zero
 func parsePercentages(s string) ([]int, error) {
 	parts := strings.Split(s, ",")
-	if len(parts) != 4 {
-		return nil, fmt.Errorf("Need exactly four parts splitted by comma")
+	if len(parts) < 4 || len(parts) > len(kRequestTypes) {
+		return nil, fmt.Errorf("Need four to %d parts splitted by comma", len(kRequestTypes))
 	}
-	results := make([]int, 4)
+	results := make([]int, len(kRequestTypes))
 	for i, part := range parts {
 		if parsed, err := strconv.Atoi(part); err != nil {
 			return nil, fmt.Errorf("Failed to parse %d-th part", i)
@@ -58,8 +90,46 @@ func parsePercentages(s string) ([]int, error) {
 	return results, nil
 }
 
+var userZipf *utils.ZipfGenerator
+
+// User popularity follows the rank of user id, consistent with celebrities
+// in tools/create_users.go
+func pickUser() int {
+	if userZipf == nil {
+		return rand.Intn(FLAGS_num_users)
+	}
+	return userZipf.Next()
+}
+
+// pickUserPair picks two distinct users, the second of which is popularity
+// weighted (e.g. a followee). With a single user, it picks that user twice.
+func pickUserPair() (int, int) {
+	userId := rand.Intn(FLAGS_num_users)
+	if FLAGS_num_users < 2 {
+		return userId, userId
+	}
+	if userZipf == nil {
+		return userId, (userId + 1 + rand.Intn(FLAGS_num_users-1)) % FLAGS_num_users
+	}
+	for {
+		if otherId := userZipf.Next(); otherId != userId {
+			return userId, otherId
+		}
+	}
+}
+
+// pickActor picks the user issuing a post or follow request. With abusive
+// users, a fixed share of these requests comes from a handful of them, which
+// should run into the rate limit of the store.
+func pickActor() int {
+	if FLAGS_num_abusive_users > 0 && rand.Intn(100) < FLAGS_abusive_percentage {
+		return FLAGS_num_users - 1 - rand.Intn(FLAGS_num_abusive_users)
+	}
+	return pickUser()
+}
+
 func buildLoginRequest() utils.JSONValue {
-	i := rand.Intn(FLAGS_num_users)
+	i := pickUser()
 	return utils.JSONValue{
 		"username": fmt.Sprintf("testuser_%d", i),
 		"password": fmt.Sprintf("password_%d", i),
@@ -67,38 +137,260 @@ func buildLoginRequest() utils.JSONValue {
 }
 
 func buildProfileRequest() utils.JSONValue {
-	userId := rand.Intn(FLAGS_num_users)
+	userId := pickUser()
 	return utils.JSONValue{
 		"userId": fmt.Sprintf("%08x", userId),
 	}
 }
 
 func buildPostListRequest() utils.JSONValue {
-	if rand.Intn(4) == 0 {
-		return utils.JSONValue{}
-	} else {
-		userId := rand.Intn(FLAGS_num_users)
-		return utils.JSONValue{
-			"userId": fmt.Sprintf("%08x", userId),
-		}
+	request := utils.JSONValue{
+		"pageSize": FLAGS_page_size,
+	}
+	if rand.Intn(4) != 0 {
+		userId := pickUser()
+		request["userId"] = fmt.Sprintf("%08x", userId)
 	}
+	if rand.Intn(100) < FLAGS_deep_page_percentage {
+		// Deep pages of user post lists reach into the archive
+		request["skip"] = (1 + rand.Intn(FLAGS_max_page_depth)) * FLAGS_page_size
+	}
+	return request
 }
 
 func buildPostRequest() utils.JSONValue {
 	body := utils.RandomString(FLAGS_bodylen)
-	userId := rand.Intn(FLAGS_num_users)
+	if FLAGS_num_tags > 0 {
+		body += fmt.Sprintf(" #tag%d", rand.Intn(FLAGS_num_tags))
+	}
+	if rand.Intn(100) < FLAGS_mention_percentage {
+		body += fmt.Sprintf(" @testuser_%d", pickUser())
+	}
+	userId := pickActor()
 	return utils.JSONValue{
 		"userId": fmt.Sprintf("%08x", userId),
 		"body":   body,
 	}
 }
 
+func buildTagTimelineRequest() utils.JSONValue {
+	tag := 0
+	if FLAGS_num_tags > 0 {
+		tag = rand.Intn(FLAGS_num_tags)
+	}
+	return utils.JSONValue{
+		"tag":      fmt.Sprintf("tag%d", tag),
+		"pageSize": FLAGS_page_size,
+	}
+}
+
+func buildMentionsRequest() utils.JSONValue {
+	userId := pickUser()
+	return utils.JSONValue{
+		"userId":   fmt.Sprintf("%08x", userId),
+		"pageSize": FLAGS_page_size,
+	}
+}
+
+// Search requests look for hashtag words if posts carry hashtags, as bodies
+// are otherwise random strings
+func buildSearchRequest() utils.JSONValue {
+	query := utils.RandomString(3)
+	if FLAGS_num_tags > 0 {
+		query = fmt.Sprintf("tag%d", rand.Intn(FLAGS_num_tags))
+	}
+	return utils.JSONValue{
+		"query":    query,
+		"pageSize": FLAGS_page_size,
+	}
+}
+
+func buildFollowRequest() utils.JSONValue {
+	userId, followeeId := pickUserPair()
+	if FLAGS_num_abusive_users > 0 {
+		if actorId := pickActor(); actorId != followeeId {
+			userId = actorId
+		}
+	}
+	return utils.JSONValue{
+		"userId":     fmt.Sprintf("%08x", userId),
+		"followeeId": fmt.Sprintf("%08x", followeeId),
+		"unfollow":   rand.Intn(4) == 0,
+	}
+}
+
+func buildFollowListRequest() utils.JSONValue {
+	userId := pickUser()
+	return utils.JSONValue{
+		"userId":   fmt.Sprintf("%08x", userId),
+		"pageSize": FLAGS_page_size,
+	}
+}
+
+func buildBlockRequest() utils.JSONValue {
+	userId, blockeeId := pickUserPair()
+	return utils.JSONValue{
+		"userId":    fmt.Sprintf("%08x", userId),
+		"blockeeId": fmt.Sprintf("%08x", blockeeId),
+		"unblock":   rand.Intn(2) == 0,
+	}
+}
+
+// pickContactPair picks a user and one of its contacts, which are the next
+// num_contacts users by id, so that conversations are revisited.
+func pickContactPair() (int, int) {
+	userId := pickUser()
+	numContacts := FLAGS_num_contacts
+	if numContacts >= FLAGS_num_users {
+		numContacts = FLAGS_num_users - 1
+	}
+	if numContacts <= 0 {
+		numContacts = 1
+	}
+	return userId, (userId + 1 + rand.Intn(numContacts)) % FLAGS_num_users
+}
+
+func buildSendMessageRequest() utils.JSONValue {
+	userId, recipientId := pickContactPair()
+	if rand.Intn(2) == 0 {
+		userId, recipientId = recipientId, userId
+	}
+	return utils.JSONValue{
+		"userId":      fmt.Sprintf("%08x", userId),
+		"recipientId": fmt.Sprintf("%08x", recipientId),
+		"body":        utils.RandomString(FLAGS_bodylen),
+	}
+}
+
+func buildListConversationsRequest() utils.JSONValue {
+	userId := pickUser()
+	return utils.JSONValue{
+		"userId":   fmt.Sprintf("%08x", userId),
+		"pageSize": FLAGS_page_size,
+	}
+}
+
+func buildReadConversationRequest() utils.JSONValue {
+	userId, peerId := pickContactPair()
+	if rand.Intn(2) == 0 {
+		userId, peerId = peerId, userId
+	}
+	return utils.JSONValue{
+		"userId":   fmt.Sprintf("%08x", userId),
+		"peerId":   fmt.Sprintf("%08x", peerId),
+		"pageSize": FLAGS_page_size,
+	}
+}
+
+type seedPost struct {
+	postId string
+	userId string
+}
+
+// Likes, edits and deletes target posts collected from the timeline before
+// the run starts
+var seedPosts []seedPost
+
+func collectSeedPosts() {
+	client := &http.Client{Timeout: 4 * time.Second}
+	url := utils.BuildFunctionUrl(FLAGS_faas_gateway, FLAGS_fn_prefix+"RetwisPostList")
+	request := utils.JSONValue{"pageSize": 64}
+	for len(seedPosts) < FLAGS_num_seed_posts {
+		result := utils.JsonPostRequest(client, url, request)
+		if !result.Success {
+			break
+		}
+		posts, _ := result.Output["posts"].([]interface{})
+		for _, post := range posts {
+			fields := post.(map[string]interface{})
+			postId, _ := fields["id"].(string)
+			userId, _ := fields["userId"].(string)
+			if postId != "" && userId != "" {
+				seedPosts = append(seedPosts, seedPost{postId: postId, userId: userId})
+			}
+		}
+		if cursor, ok := result.Output["nextCursor"].(string); ok {
+			request["cursor"] = cursor
+		} else {
+			break
+		}
+	}
+	log.Printf("[INFO] Collected %d posts for likes, edits and deletes", len(seedPosts))
+}
+
+func pickSeedPost() seedPost {
+	if len(seedPosts) == 0 {
+		return seedPost{postId: "0000000000000000", userId: "00000000"}
+	}
+	return seedPosts[rand.Intn(len(seedPosts))]
+}
+
+func buildLikePostRequest() utils.JSONValue {
+	userId := pickUser()
+	return utils.JSONValue{
+		"userId": fmt.Sprintf("%08x", userId),
+		"postId": pickSeedPost().postId,
+		"unlike": rand.Intn(4) == 0,
+	}
+}
+
+func buildEditPostRequest() utils.JSONValue {
+	post := pickSeedPost()
+	return utils.JSONValue{
+		"userId": post.userId,
+		"postId": post.postId,
+		"body":   utils.RandomString(FLAGS_bodylen),
+	}
+}
+
+func buildDeletePostRequest() utils.JSONValue {
+	if len(seedPosts) == 0 {
+		return utils.JSONValue{"userId": "00000000", "postId": "0000000000000000"}
+	}
+	// Each post can only be deleted once
+	i := rand.Intn(len(seedPosts))
+	post := seedPosts[i]
+	seedPosts[i] = seedPosts[len(seedPosts)-1]
+	seedPosts = seedPosts[:len(seedPosts)-1]
+	return utils.JSONValue{
+		"userId": post.userId,
+		"postId": post.postId,
+	}
+}
+
+// In the order of --percentages
+var kRequestTypes = []struct {
+	fnName       string
+	buildRequest func() utils.JSONValue
+	useSeedPosts bool
+}{
+	{"RetwisLogin", buildLoginRequest, false},
+	{"RetwisProfile", buildProfileRequest, false},
+	{"RetwisPostList", buildPostListRequest, false},
+	{"RetwisPost", buildPostRequest, false},
+	{"RetwisFollow", buildFollowRequest, false},
+	{"RetwisFollowers", buildFollowListRequest, false},
+	{"RetwisFollowees", buildFollowListRequest, false},
+	{"RetwisBlock", buildBlockRequest, false},
+	{"RetwisLikePost", buildLikePostRequest, true},
+	{"RetwisEditPost", buildEditPostRequest, true},
+	{"RetwisDeletePost", buildDeletePostRequest, true},
+	{"RetwisTagTimeline", buildTagTimelineRequest, false},
+	{"RetwisMentions", buildMentionsRequest, false},
+	{"RetwisSendMessage", buildSendMessageRequest, false},
+	{"RetwisListConversations", buildListConversationsRequest, false},
+	{"RetwisReadConversation", buildReadConversationRequest, false},
+	{"RetwisSearch", buildSearchRequest, false},
+}
+
 const kTxnConflitMsg = "Failed to commit transaction due to conflicts"
+const kRateLimitedMsg = "Rate limit exceeded"
 
 func printFnResult(fnName string, duration time.Duration, results []*utils.FaasCall) {
 	total := 0
 	succeeded := 0
 	txnConflit := 0
+	rateLimited := 0
 	latencies := make([]float64, 0, 128)
 	for _, result := range results {
 		if result.FnName == FLAGS_fn_prefix+fnName {
@@ -107,9 +399,11 @@ func printFnResult(fnName string, duration time.Duration, results []*utils.FaasC
 				succeeded++
 			} else if result.Result.Message == kTxnConflitMsg {
 				txnConflit++
+			} else if result.Result.Message == kRateLimitedMsg {
+				rateLimited++
 			}
 			if result.Result.StatusCode == 200 {
-				d := result.Result.Duration
+				d := result.Latency
 				latencies = append(latencies, float64(d.Microseconds()))
 			}
 		}
@@ -117,13 +411,17 @@ func printFnResult(fnName string, duration time.Duration, results []*utils.FaasC
 	if total == 0 {
 		return
 	}
-	failed := total - succeeded - txnConflit
+	failed := total - succeeded - txnConflit - rateLimited
 	fmt.Printf("[%s]\n", fnName)
 	fmt.Printf("Throughput: %.1f requests per sec\n", float64(total)/duration.Seconds())
 	if txnConflit > 0 {
 		ratio := float64(txnConflit) / float64(txnConflit+succeeded)
 		fmt.Printf("Transaction conflits: %d (%.2f%%)\n", txnConflit, ratio*100.0)
 	}
+	if rateLimited > 0 {
+		ratio := float64(rateLimited) / float64(total)
+		fmt.Printf("Rate limited: %d (%.2f%%)\n", rateLimited, ratio*100.0)
+	}
 	if failed > 0 {
 		ratio := float64(failed) / float64(total)
 		fmt.Printf("Transaction conflits: %d (%.2f%%)\n", failed, ratio*100.0)
@@ -135,39 +433,134 @@ func printFnResult(fnName string, duration time.Duration, results []*utils.FaasC
 	}
 }
 
-func main() {
-	flag.Parse()
-
+func prepareSynthetic() []int {
 	percentages, err := parsePercentages(FLAGS_percentages)
 	if err != nil {
 		log.Fatalf("[FATAL] Invalid \"percentages\" flag: %v", err)
 	}
 
-	log.Printf("[INFO] Start running for %d seconds with concurrency of %d", FLAGS_duration, FLAGS_concurrency)
+	if FLAGS_zipf_exponent > 0 {
+		userZipf = utils.NewZipfGenerator(FLAGS_num_users, FLAGS_zipf_exponent)
+	}
+
+	for i, requestType := range kRequestTypes {
+		if requestType.useSeedPosts && (i == 0 || percentages[i] > percentages[i-1]) {
+			collectSeedPosts()
+			break
+		}
+	}
+	return percentages
+}
+
+// In closed loop, a new request is sent once a worker becomes free. In open
+// loop, requests arrive at FLAGS_target_rate regardless of completions, each
+// sent on its own goroutine, and --max_inflight optionally bounds in-flight
+// requests.
+func runSynthetic(client *utils.FaasClient, percentages []int) []string {
+	if FLAGS_target_rate > 0 {
+		log.Printf("[INFO] Start running for %d seconds at %.1f requests per sec", FLAGS_duration, FLAGS_target_rate)
+	} else {
+		log.Printf("[INFO] Start running for %d seconds with concurrency of %d", FLAGS_duration, FLAGS_concurrency)
+	}
 
-	client := utils.NewFaasClient(FLAGS_faas_gateway, FLAGS_concurrency)
 	startTime := time.Now()
+	endTime := startTime.Add(time.Duration(FLAGS_duration) * time.Second)
+	scheduled := startTime
 	for {
-		if time.Since(startTime) > time.Duration(FLAGS_duration)*time.Second {
+		if FLAGS_target_rate > 0 {
+			interval := rand.ExpFloat64() / FLAGS_target_rate
+			scheduled = scheduled.Add(time.Duration(interval * float64(time.Second)))
+			if scheduled.After(endTime) {
+				break
+			}
+			if delay := time.Until(scheduled); delay > 0 {
+				time.Sleep(delay)
+			}
+		} else if time.Now().After(endTime) {
 			break
 		}
 		k := rand.Intn(100)
-		if k < percentages[0] {
-			client.AddJsonFnCall(FLAGS_fn_prefix+"RetwisLogin", buildLoginRequest())
-		} else if k < percentages[1] {
-			client.AddJsonFnCall(FLAGS_fn_prefix+"RetwisProfile", buildProfileRequest())
-		} else if k < percentages[2] {
-			client.AddJsonFnCall(FLAGS_fn_prefix+"RetwisPostList", buildPostListRequest())
-		} else {
-			client.AddJsonFnCall(FLAGS_fn_prefix+"RetwisPost", buildPostRequest())
+		for i, requestType := range kRequestTypes {
+			if k < percentages[i] {
+				fnName := FLAGS_fn_prefix + requestType.fnName
+				if FLAGS_target_rate > 0 {
+					client.DispatchJsonFnCall(fnName, requestType.buildRequest(), scheduled)
+				} else {
+					client.AddJsonFnCall(fnName, requestType.buildRequest())
+				}
+				break
+			}
+		}
+	}
+
+	fnNames := make([]string, 0, len(kRequestTypes))
+	for _, requestType := range kRequestTypes {
+		fnNames = append(fnNames, requestType.fnName)
+	}
+	return fnNames
+}
+
+// runTrace sends requests of the trace at their (scaled) timestamps. Requests
+// held back by --max_inflight are sent late rather than dropped, and latencies
+// count from the scheduled time.
+func runTrace(client *utils.FaasClient, entries []*utils.TraceEntry) []string {
+	log.Printf("[INFO] Start replaying %d requests", len(entries))
+
+	fnNames := make([]string, 0)
+	seen := make(map[string]bool)
+	startTime := time.Now()
+	for _, entry := range entries {
+		offset := time.Duration(entry.Timestamp * FLAGS_time_scale * float64(time.Second))
+		scheduled := startTime.Add(offset)
+		if delay := time.Until(scheduled); delay > 0 {
+			time.Sleep(delay)
 		}
+		client.DispatchJsonFnCall(FLAGS_fn_prefix+entry.FnName, entry.Input, scheduled)
+		if !seen[entry.FnName] {
+			seen[entry.FnName] = true
+			fnNames = append(fnNames, entry.FnName)
+		}
+	}
+	return fnNames
+}
+
+func main() {
+	flag.Parse()
+
+	client := utils.NewFaasClient(FLAGS_faas_gateway, FLAGS_concurrency)
+	client.SetMaxInflight(FLAGS_max_inflight)
+	if FLAGS_record_trace != "" {
+		recorder, err := utils.NewTraceRecorder(FLAGS_record_trace, FLAGS_fn_prefix)
+		if err != nil {
+			log.Fatalf("[FATAL] Failed to create trace %s: %v", FLAGS_record_trace, err)
+		}
+		defer recorder.Close()
+		client.SetRecorder(recorder)
+	}
+
+	var entries []*utils.TraceEntry
+	var percentages []int
+	if FLAGS_trace != "" {
+		var err error
+		if entries, err = utils.ReadTrace(FLAGS_trace); err != nil {
+			log.Fatalf("[FATAL] Failed to read trace %s: %v", FLAGS_trace, err)
+		}
+	} else {
+		percentages = prepareSynthetic()
+	}
+
+	startTime := time.Now()
+	var fnNames []string
+	if FLAGS_trace != "" {
+		fnNames = runTrace(client, entries)
+	} else {
+		fnNames = runSynthetic(client, percentages)
 	}
 	results := client.WaitForResults()
 	elapsed := time.Since(startTime)
 	fmt.Printf("Benchmark runs for %v, %.1f request per sec\n", elapsed, float64(len(results))/elapsed.Seconds())
 
-	printFnResult("RetwisLogin", elapsed, results)
-	printFnResult("RetwisProfile", elapsed, results)
-	printFnResult("RetwisPostList", elapsed, results)
-	printFnResult("RetwisPost", elapsed, results)
+	for _, fnName := range fnNames {
+		printFnResult(fnName, elapsed, results)
+	}
 }
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"cs.utexas.edu/zjia/faas-retwis/utils"
+)
+
+var FLAGS_faas_gateway string
+var FLAGS_fn_prefix string
+var FLAGS_max_violations int
+var FLAGS_timeout int
+
+func init() {
+	flag.StringVar(&FLAGS_faas_gateway, "faas_gateway", "127.0.0.1:8081", "")
+	flag.StringVar(&FLAGS_fn_prefix, "fn_prefix", "", "")
+	flag.IntVar(&FLAGS_max_violations, "max_violations", 100, "Maximum number of violations to print")
+	flag.IntVar(&FLAGS_timeout, "timeout", 300, "Timeout in seconds, as the check scans all state")
+}
+
+// Exits with 1 if any invariant is violated, and with 2 if the check fails
+func main() {
+	flag.Parse()
+
+	client := &http.Client{Timeout: time.Duration(FLAGS_timeout) * time.Second}
+	url := utils.BuildFunctionUrl(FLAGS_faas_gateway, FLAGS_fn_prefix+"RetwisCheck")
+	result := utils.JsonPostRequest(client, url, utils.JSONValue{
+		"maxViolations": FLAGS_max_violations,
+	})
+	if !result.Success {
+		log.Printf("[ERROR] RetwisCheck failed: %s", result.Message)
+		os.Exit(2)
+	}
+
+	output := result.Output
+	log.Printf("[INFO] Checked %v users and %v posts", output["numUsers"], output["numPosts"])
+	violations, _ := output["violations"].([]interface{})
+	for _, violation := range violations {
+		log.Printf("[WARN] %v", violation)
+	}
+	if numViolations, _ := output["numViolations"].(float64); numViolations > 0 {
+		log.Printf("[ERROR] Found %d invariant violations", int(numViolations))
+		os.Exit(1)
+	}
+	log.Printf("[INFO] No invariant violations found")
+}
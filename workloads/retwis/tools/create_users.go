@@ -13,6 +13,9 @@ var FLAGS_faas_gateway string
 var FLAGS_fn_prefix string
 var FLAGS_num_users int
 var FLAGS_followers_per_user int
+var FLAGS_follower_exponent float64
+var FLAGS_num_celebrities int
+var FLAGS_celebrity_follow_percentage int
 var FLAGS_concurrency int
 var FLAGS_rand_seed int
 
@@ -21,6 +24,9 @@ func init() {
 	flag.StringVar(&FLAGS_fn_prefix, "fn_prefix", "", "")
 	flag.IntVar(&FLAGS_num_users, "num_users", 1000, "")
 	flag.IntVar(&FLAGS_followers_per_user, "followers_per_user", 0, "")
+	flag.Float64Var(&FLAGS_follower_exponent, "follower_exponent", 0, "Followees are picked with Zipfian popularity of this exponent, 0 for uniform")
+	flag.IntVar(&FLAGS_num_celebrities, "num_celebrities", 0, "Number of celebrity accounts, which are users with the smallest ids")
+	flag.IntVar(&FLAGS_celebrity_follow_percentage, "celebrity_follow_percentage", 50, "Percentage of users following each celebrity")
 	flag.IntVar(&FLAGS_concurrency, "concurrency", 1, "")
 	flag.IntVar(&FLAGS_rand_seed, "rand_seed", 23333, "")
 
@@ -48,18 +54,40 @@ func createUsers() {
 	}
 }
 
+// With a positive follower_exponent, the number of followers follows a power
+// law over user ids, matching popularity used by tools/benchmark.go. On top
+// of that, celebrities are followed by a fixed percentage of all users.
 func createFollowers() {
+	var zipf *utils.ZipfGenerator
+	if FLAGS_follower_exponent > 0 {
+		zipf = utils.NewZipfGenerator(FLAGS_num_users, FLAGS_follower_exponent)
+	}
 	userIds1 := make([]int, 0, 1024)
 	userIds2 := make([]int, 0, 1024)
 	for i := 0; i < FLAGS_num_users; i++ {
-		for j := 0; j < FLAGS_followers_per_user; j++ {
+		followees := make(map[int]bool)
+		for j := 0; j < FLAGS_num_celebrities; j++ {
+			if j != i && rand.Intn(100) < FLAGS_celebrity_follow_percentage {
+				followees[j] = true
+				userIds1 = append(userIds1, i)
+				userIds2 = append(userIds2, j)
+			}
+		}
+		for j := 0; j < FLAGS_followers_per_user && len(followees) < FLAGS_num_users-1; j++ {
 			followeeId := 0
 			for {
-				followeeId = rand.Intn(FLAGS_num_users)
-				if followeeId != i {
+				if zipf != nil {
+					followeeId = zipf.Next()
+				} else {
+					followeeId = rand.Intn(FLAGS_num_users)
+				}
+				// Skewed picks repeat often, and duplicated follows would
+				// make popular users less popular than expected
+				if followeeId != i && (zipf == nil || !followees[followeeId]) {
 					break
 				}
 			}
+			followees[followeeId] = true
 			userIds1 = append(userIds1, i)
 			userIds2 = append(userIds2, followeeId)
 		}
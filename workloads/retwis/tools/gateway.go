@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"cs.utexas.edu/zjia/faas-retwis/utils"
+)
+
+var FLAGS_faas_gateway string
+var FLAGS_fn_prefix string
+var FLAGS_listen_addr string
+var FLAGS_timeout int
+
+func init() {
+	flag.StringVar(&FLAGS_faas_gateway, "faas_gateway", "127.0.0.1:8081", "")
+	flag.StringVar(&FLAGS_fn_prefix, "fn_prefix", "", "")
+	flag.StringVar(&FLAGS_listen_addr, "listen_addr", ":8080", "Address serving the REST API")
+	flag.IntVar(&FLAGS_timeout, "timeout", 10, "Timeout in seconds of each function call")
+}
+
+// Handlers report failures as Success=false with a message. Known messages
+// map to specific HTTP status codes, and the rest are bad requests.
+var kFailureStatusCodes = []struct {
+	substring  string
+	statusCode int
+}{
+	{"Cannot find user", http.StatusNotFound},
+	{"does not exists", http.StatusNotFound},
+	{"Incorrect password", http.StatusUnauthorized},
+	{"has blocked user", http.StatusForbidden},
+	{"already exists", http.StatusConflict},
+	{"Failed to commit transaction due to conflicts", http.StatusConflict},
+	{"Not supported by this store", http.StatusNotImplemented},
+	{"Timed out waiting for session", http.StatusServiceUnavailable},
+	{"Rate limit exceeded", http.StatusTooManyRequests},
+	{"SQL failed", http.StatusInternalServerError},
+	{"Mongo failed", http.StatusInternalServerError},
+	{"Redis failed", http.StatusInternalServerError},
+}
+
+func failureStatusCode(message string) int {
+	for _, entry := range kFailureStatusCodes {
+		if strings.Contains(message, entry.substring) {
+			return entry.statusCode
+		}
+	}
+	return http.StatusBadRequest
+}
+
+type gateway struct {
+	client *http.Client
+}
+
+func writeJson(w http.ResponseWriter, statusCode int, body utils.JSONValue) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("[ERROR] Failed to write response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, statusCode int, message string) {
+	writeJson(w, statusCode, utils.JSONValue{"success": false, "message": message})
+}
+
+// call invokes fnName with input, and replies with its output. The status
+// code is successCode if the function succeeds.
+func (g *gateway) call(w http.ResponseWriter, fnName string, input utils.JSONValue, successCode int) {
+	encoded, err := json.Marshal(input)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid request: %v", err))
+		return
+	}
+	url := utils.BuildFunctionUrl(FLAGS_faas_gateway, FLAGS_fn_prefix+fnName)
+	resp, err := g.client.Post(url, "application/json", bytes.NewReader(encoded))
+	if err != nil {
+		log.Printf("[ERROR] Failed to call %s: %v", fnName, err)
+		writeError(w, http.StatusBadGateway, fmt.Sprintf("Failed to call %s", fnName))
+		return
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		log.Printf("[ERROR] %s failed with status %d", fnName, resp.StatusCode)
+		writeError(w, http.StatusBadGateway, fmt.Sprintf("%s failed", fnName))
+		return
+	}
+	var output utils.JSONValue
+	if err := json.Unmarshal(body, &output); err != nil {
+		log.Printf("[ERROR] Invalid output from %s: %v", fnName, err)
+		writeError(w, http.StatusBadGateway, fmt.Sprintf("Invalid output from %s", fnName))
+		return
+	}
+	if success, _ := output["success"].(bool); success {
+		writeJson(w, successCode, output)
+	} else {
+		message, _ := output["message"].(string)
+		writeJson(w, failureStatusCode(message), output)
+	}
+}
+
+// readBody decodes the JSON request body into a map, and replies with an
+// error if it cannot. An empty body decodes to an empty map.
+func readBody(w http.ResponseWriter, r *http.Request) (utils.JSONValue, bool) {
+	body := make(utils.JSONValue)
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid JSON body: %v", err))
+		return nil, false
+	}
+	return body, true
+}
+
+// copyQuery copies the listed query parameters into input, converting those
+// named in intParams to numbers
+func copyQuery(input utils.JSONValue, r *http.Request, params []string, intParams []string) bool {
+	query := r.URL.Query()
+	for _, param := range params {
+		if value := query.Get(param); value != "" {
+			input[param] = value
+		}
+	}
+	for _, param := range intParams {
+		if value := query.Get(param); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				return false
+			}
+			input[param] = parsed
+		}
+	}
+	return true
+}
+
+// POST /users
+func (g *gateway) handleUsers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Only POST is allowed")
+		return
+	}
+	body, ok := readBody(w, r)
+	if !ok {
+		return
+	}
+	g.call(w, "RetwisRegister", utils.JSONValue{
+		"username": body["username"],
+		"password": body["password"],
+	}, http.StatusCreated)
+}
+
+// POST /login
+func (g *gateway) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Only POST is allowed")
+		return
+	}
+	body, ok := readBody(w, r)
+	if !ok {
+		return
+	}
+	g.call(w, "RetwisLogin", utils.JSONValue{
+		"username": body["username"],
+		"password": body["password"],
+	}, http.StatusOK)
+}
+
+// GET /users/{id} and POST /users/{id}/follow
+func (g *gateway) handleUser(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/users/"), "/")
+	userId := parts[0]
+	if userId == "" {
+		writeError(w, http.StatusNotFound, "Missing user ID")
+		return
+	}
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		input := utils.JSONValue{"userId": userId}
+		copyQuery(input, r, []string{"sessionToken"}, nil)
+		g.call(w, "RetwisProfile", input, http.StatusOK)
+	case len(parts) == 2 && parts[1] == "follow" && r.Method == http.MethodPost:
+		body, ok := readBody(w, r)
+		if !ok {
+			return
+		}
+		g.call(w, "RetwisFollow", utils.JSONValue{
+			"userId":     userId,
+			"followeeId": body["followeeId"],
+			"unfollow":   body["unfollow"] == true,
+		}, http.StatusOK)
+	case len(parts) == 1 || (len(parts) == 2 && parts[1] == "follow"):
+		writeError(w, http.StatusMethodNotAllowed, fmt.Sprintf("%s is not allowed", r.Method))
+	default:
+		writeError(w, http.StatusNotFound, fmt.Sprintf("Unknown path %s", r.URL.Path))
+	}
+}
+
+// GET /timeline, with optional userId, cursor, pageSize and sessionToken
+// query parameters. Without userId, it reads the global timeline.
+func (g *gateway) handleTimeline(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Only GET is allowed")
+		return
+	}
+	input := make(utils.JSONValue)
+	if !copyQuery(input, r, []string{"userId", "cursor", "sessionToken"}, []string{"pageSize"}) {
+		writeError(w, http.StatusBadRequest, "pageSize must be a number")
+		return
+	}
+	g.call(w, "RetwisPostList", input, http.StatusOK)
+}
+
+func main() {
+	flag.Parse()
+
+	g := &gateway{
+		client: &http.Client{Timeout: time.Duration(FLAGS_timeout) * time.Second},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/users", g.handleUsers)
+	mux.HandleFunc("/users/", g.handleUser)
+	mux.HandleFunc("/login", g.handleLogin)
+	mux.HandleFunc("/timeline", g.handleTimeline)
+
+	log.Printf("[INFO] Serving Retwis REST API at %s", FLAGS_listen_addr)
+	if err := http.ListenAndServe(FLAGS_listen_addr, mux); err != nil {
+		log.Fatalf("[FATAL] Failed to serve: %v", err)
+	}
+}
@@ -16,6 +16,7 @@ type HttpResult struct {
 	StatusCode int
 	Message    string
 	Duration   time.Duration
+	Output     JSONValue
 }
 
 type JSONValue = map[string]interface{}
@@ -57,6 +58,7 @@ func JsonPostRequest(client *http.Client, url string, request JSONValue) *HttpRe
 		Success:    true,
 		StatusCode: 200,
 		Duration:   elapsed,
+		Output:     response,
 	}
 }
 
@@ -64,14 +66,37 @@ func BuildFunctionUrl(gatewayAddr string, fnName string) string {
 	return fmt.Sprintf("http://%s/function/%s", gatewayAddr, fnName)
 }
 
+// Latency of a call counts from Scheduled if set, so that it includes time
+// queued inside the client. Otherwise it is the duration of the HTTP request.
 type FaasCall struct {
-	FnName string
-	Input  JSONValue
-	Result *HttpResult
+	FnName    string
+	Input     JSONValue
+	Result    *HttpResult
+	Scheduled time.Time
+	Latency   time.Duration
+}
+
+// send sends call, and records it into the trace of c when it is sent
+func (c *FaasClient) send(client *http.Client, call *FaasCall) {
+	if c.recorder != nil {
+		if err := c.recorder.Record(call.FnName, call.Input, time.Now()); err != nil {
+			log.Fatalf("[FATAL] Failed to record trace: %v", err)
+		}
+	}
+	url := BuildFunctionUrl(c.gateway, call.FnName)
+	call.Result = JsonPostRequest(client, url, call.Input)
+	if call.Scheduled.IsZero() {
+		call.Latency = call.Result.Duration
+	} else {
+		call.Latency = time.Since(call.Scheduled)
+	}
+	// Keep memory bounded for long runs, only counters and latencies are used
+	call.Input = nil
+	call.Result.Output = nil
 }
 
 type faasWorker struct {
-	gateway string
+	owner   *FaasClient
 	client  *http.Client
 	reqChan chan *FaasCall
 	wg      *sync.WaitGroup
@@ -85,27 +110,47 @@ func (w *faasWorker) start() {
 		if !more {
 			break
 		}
-		url := BuildFunctionUrl(w.gateway, call.FnName)
-		call.Result = JsonPostRequest(w.client, url, call.Input)
-		call.Input = nil
+		w.owner.send(w.client, call)
 		w.results = append(w.results, call)
 	}
 }
 
+// FaasClient sends calls added by AddJsonFnCall from a fixed pool of
+// workers, i.e. in closed loop. Calls added by DispatchJsonFnCall are sent
+// right away on their own goroutines instead, for open-loop clients.
 type FaasClient struct {
-	reqChan chan *FaasCall
-	workers []*faasWorker
-	wg      *sync.WaitGroup
+	gateway  string
+	reqChan  chan *FaasCall
+	workers  []*faasWorker
+	wg       *sync.WaitGroup
+	recorder *TraceRecorder
+
+	dispatchClient *http.Client
+	dispatchWg     sync.WaitGroup
+	inflight       chan struct{}
+	mu             sync.Mutex
+	dispatched     []*FaasCall
 }
 
 func NewFaasClient(faasGateway string, concurrency int) *FaasClient {
-	reqChan := make(chan *FaasCall, concurrency)
-	workers := make([]*faasWorker, concurrency)
-	wg := &sync.WaitGroup{}
-	wg.Add(concurrency)
+	c := &FaasClient{
+		gateway: faasGateway,
+		reqChan: make(chan *FaasCall, concurrency),
+		workers: make([]*faasWorker, concurrency),
+		wg:      &sync.WaitGroup{},
+		dispatchClient: &http.Client{
+			Transport: &http.Transport{
+				MaxIdleConnsPerHost: 1024,
+				IdleConnTimeout:     30 * time.Second,
+			},
+			Timeout: 4 * time.Second,
+		},
+		dispatched: make([]*FaasCall, 0, 128),
+	}
+	c.wg.Add(concurrency)
 	for i := 0; i < concurrency; i++ {
 		worker := &faasWorker{
-			gateway: faasGateway,
+			owner: c,
 			client: &http.Client{
 				Transport: &http.Transport{
 					MaxConnsPerHost: 1,
@@ -114,35 +159,72 @@ func NewFaasClient(faasGateway string, concurrency int) *FaasClient {
 				},
 				Timeout: 4 * time.Second,
 			},
-			reqChan: reqChan,
-			wg:      wg,
+			reqChan: c.reqChan,
+			wg:      c.wg,
 			results: make([]*FaasCall, 0, 128),
 		}
 		go worker.start()
-		workers[i] = worker
+		c.workers[i] = worker
 	}
-	return &FaasClient{
-		reqChan: reqChan,
-		workers: workers,
-		wg:      wg,
+	return c
+}
+
+// SetMaxInflight caps calls of DispatchJsonFnCall in flight at once, 0 for
+// no cap. Calls over the cap wait without delaying later arrivals, and the
+// wait counts into their latency.
+func (c *FaasClient) SetMaxInflight(maxInflight int) {
+	if maxInflight > 0 {
+		c.inflight = make(chan struct{}, maxInflight)
+	} else {
+		c.inflight = nil
 	}
 }
 
+// SetRecorder makes the client record all following calls into recorder
+func (c *FaasClient) SetRecorder(recorder *TraceRecorder) {
+	c.recorder = recorder
+}
+
+// AddJsonFnCall blocks until a worker is free to send the call
 func (c *FaasClient) AddJsonFnCall(fnName string, input JSONValue) {
-	call := &FaasCall{
+	c.reqChan <- &FaasCall{
 		FnName: fnName,
 		Input:  input,
 		Result: nil,
 	}
-	c.reqChan <- call
+}
+
+// DispatchJsonFnCall is for open-loop clients, where scheduled is when the
+// call is supposed to be sent. It sends the call on a new goroutine and
+// returns at once, so arrivals never wait for earlier calls to complete.
+func (c *FaasClient) DispatchJsonFnCall(fnName string, input JSONValue, scheduled time.Time) {
+	call := &FaasCall{
+		FnName:    fnName,
+		Input:     input,
+		Result:    nil,
+		Scheduled: scheduled,
+	}
+	c.dispatchWg.Add(1)
+	go func() {
+		defer c.dispatchWg.Done()
+		if c.inflight != nil {
+			c.inflight <- struct{}{}
+			defer func() { <-c.inflight }()
+		}
+		c.send(c.dispatchClient, call)
+		c.mu.Lock()
+		c.dispatched = append(c.dispatched, call)
+		c.mu.Unlock()
+	}()
 }
 
 func (c *FaasClient) WaitForResults() []*FaasCall {
 	close(c.reqChan)
 	c.wg.Wait()
+	c.dispatchWg.Wait()
 	results := make([]*FaasCall, 0)
 	for _, worker := range c.workers {
 		results = append(results, worker.results...)
 	}
-	return results
+	return append(results, c.dispatched...)
 }
@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const kLocalhostRedisAddr = "localhost:6379"
+
+func getRedisAddr() string {
+	if addr, exists := os.LookupEnv("REDIS_ADDR"); exists {
+		return addr
+	} else {
+		return kLocalhostRedisAddr
+	}
+}
+
+func CreateRedisClientOrDie(ctx context.Context) *redis.Client {
+	addr := getRedisAddr()
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	newCtx, cancel := context.WithTimeout(ctx, 300*time.Second)
+	defer cancel()
+	if err := client.Ping(newCtx).Err(); err != nil {
+		log.Fatalf("[FATAL] Failed to connect to redis %s: %v", addr, err)
+		return nil
+	}
+	return client
+}
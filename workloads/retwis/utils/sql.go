@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"database/sql"
+	"log"
+	"os"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+const kLocalhostSqlDsn = "boki:retwisboki@tcp(localhost:3306)/retwis"
+
+func getSqlDsn() string {
+	if dsn, exists := os.LookupEnv("SQL_DSN"); exists {
+		return dsn
+	} else {
+		return kLocalhostSqlDsn
+	}
+}
+
+func CreateSqlDbOrDie() *sql.DB {
+	dsn := getSqlDsn()
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		log.Fatalf("[FATAL] Failed to open SQL database: %v", err)
+		return nil
+	}
+	db.SetConnMaxLifetime(300 * time.Second)
+	return db
+}
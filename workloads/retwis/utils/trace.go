@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceEntry is one line of a trace file. Timestamp is in seconds, relative
+// to the first request of the trace.
+type TraceEntry struct {
+	FnName    string    `json:"fnName"`
+	Input     JSONValue `json:"input"`
+	Timestamp float64   `json:"timestamp"`
+}
+
+// TraceRecorder writes requests as JSON lines. Function names are recorded
+// without fnPrefix, so a trace can be replayed against any backend.
+type TraceRecorder struct {
+	mu        sync.Mutex
+	file      *os.File
+	writer    *bufio.Writer
+	encoder   *json.Encoder
+	fnPrefix  string
+	startTime time.Time
+}
+
+func NewTraceRecorder(path string, fnPrefix string) (*TraceRecorder, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	writer := bufio.NewWriter(file)
+	return &TraceRecorder{
+		file:     file,
+		writer:   writer,
+		encoder:  json.NewEncoder(writer),
+		fnPrefix: fnPrefix,
+	}, nil
+}
+
+// Record writes a request sent at sendTime
+func (r *TraceRecorder) Record(fnName string, input JSONValue, sendTime time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.startTime.IsZero() {
+		r.startTime = sendTime
+	}
+	return r.encoder.Encode(&TraceEntry{
+		FnName:    strings.TrimPrefix(fnName, r.fnPrefix),
+		Input:     input,
+		Timestamp: sendTime.Sub(r.startTime).Seconds(),
+	})
+}
+
+func (r *TraceRecorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.writer.Flush(); err != nil {
+		r.file.Close()
+		return err
+	}
+	return r.file.Close()
+}
+
+func ReadTrace(path string) ([]*TraceEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	entries := make([]*TraceEntry, 0, 1024)
+	decoder := json.NewDecoder(bufio.NewReader(file))
+	for decoder.More() {
+		entry := &TraceEntry{}
+		if err := decoder.Decode(entry); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
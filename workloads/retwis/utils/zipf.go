@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// ZipfGenerator draws integers in [0, n), where the probability of k is
+// proportional to 1 / (k+1)^exponent. So 0 is the most popular one, and
+// exponent of 0 gives the uniform distribution. Unlike rand.Zipf, exponents
+// below 1 (e.g. 0.99 as in YCSB) are allowed.
+type ZipfGenerator struct {
+	cdf []float64
+}
+
+func NewZipfGenerator(n int, exponent float64) *ZipfGenerator {
+	cdf := make([]float64, n)
+	sum := 0.0
+	for k := 0; k < n; k++ {
+		sum += 1.0 / math.Pow(float64(k+1), exponent)
+		cdf[k] = sum
+	}
+	for k := 0; k < n; k++ {
+		cdf[k] /= sum
+	}
+	return &ZipfGenerator{cdf: cdf}
+}
+
+func (z *ZipfGenerator) Next() int {
+	k := sort.SearchFloat64s(z.cdf, rand.Float64())
+	if k >= len(z.cdf) {
+		k = len(z.cdf) - 1
+	}
+	return k
+}
@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestZipfGeneratorCdf(t *testing.T) {
+	tests := []struct {
+		n        int
+		exponent float64
+	}{
+		{1, 0.99},
+		{10, 0},
+		{10, 0.99},
+		{1000, 1.2},
+	}
+	for _, test := range tests {
+		z := NewZipfGenerator(test.n, test.exponent)
+		if len(z.cdf) != test.n {
+			t.Errorf("n=%d, exponent=%g: cdf has %d entries", test.n, test.exponent, len(z.cdf))
+			continue
+		}
+		for k := 1; k < test.n; k++ {
+			if z.cdf[k] < z.cdf[k-1] {
+				t.Errorf("n=%d, exponent=%g: cdf decreases at %d", test.n, test.exponent, k)
+			}
+		}
+		if last := z.cdf[test.n-1]; math.Abs(last-1) > 1e-9 {
+			t.Errorf("n=%d, exponent=%g: cdf ends at %g", test.n, test.exponent, last)
+		}
+	}
+}
+
+func sampleZipf(n int, exponent float64, draws int) []int {
+	rand.Seed(1)
+	z := NewZipfGenerator(n, exponent)
+	counts := make([]int, n)
+	for i := 0; i < draws; i++ {
+		counts[z.Next()]++
+	}
+	return counts
+}
+
+func TestZipfGeneratorUniform(t *testing.T) {
+	const n, draws = 10, 100000
+	for k, count := range sampleZipf(n, 0, draws) {
+		if math.Abs(float64(count)-draws/n) > 0.05*draws/n {
+			t.Errorf("%d drawn %d times, want about %d", k, count, draws/n)
+		}
+	}
+}
+
+func TestZipfGeneratorSkewed(t *testing.T) {
+	const n, draws = 10, 100000
+	counts := sampleZipf(n, 0.99, draws)
+	for k := 1; k < n; k++ {
+		if counts[k] > counts[k-1] {
+			t.Errorf("%d drawn more often than %d: %v", k, k-1, counts)
+		}
+	}
+	// The probability of 0 is 1 / H(10, 0.99), about 0.34
+	if p := float64(counts[0]) / draws; math.Abs(p-0.34) > 0.01 {
+		t.Errorf("0 drawn with probability %g, want about 0.34", p)
+	}
+}
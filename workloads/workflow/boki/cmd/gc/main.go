@@ -0,0 +1,13 @@
+package main
+
+import (
+	"github.com/eniac/Beldi/pkg/cayonlib"
+
+	"cs.utexas.edu/zjia/faas"
+)
+
+// gc trims shared log records of finished cayonlib instances. Each call runs
+// one pass, so it is meant to be invoked periodically.
+func main() {
+	faas.Serve(cayonlib.CreateGCHandlerFactory())
+}
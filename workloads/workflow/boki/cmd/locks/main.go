@@ -0,0 +1,13 @@
+package main
+
+import (
+	"github.com/eniac/Beldi/pkg/cayonlib"
+
+	"cs.utexas.edu/zjia/faas"
+)
+
+// locks lists the cayonlib locks currently held, along with their holders
+// and lease expiry.
+func main() {
+	faas.Serve(cayonlib.CreateLocksHandlerFactory())
+}
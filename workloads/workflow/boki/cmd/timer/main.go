@@ -0,0 +1,13 @@
+package main
+
+import (
+	"github.com/eniac/Beldi/pkg/cayonlib"
+
+	"cs.utexas.edu/zjia/faas"
+)
+
+// timer wakes up cayonlib instances sleeping in cayonlib.Sleep. Each call
+// fires the timers due, so it is meant to be invoked periodically.
+func main() {
+	faas.Serve(cayonlib.CreateTimerHandlerFactory())
+}
@@ -351,12 +351,16 @@ func user(baseline bool) {
 	}
 }
 
+// Reservations decrement Cap in every mode, so hotels and flights start with
+// enough room for a benchmark run not to sell out
+const kCap = 1000000
+
 func addHotels(baseline bool) {
 	for i := 0; i < 100; i++ {
 		hotelId := strconv.Itoa(i)
 		cayonlib.Populate("hotel", hotelId, hotel.Hotel{
 			HotelId:   hotelId,
-			Cap:       10,
+			Cap:       kCap,
 			Customers: []string{},
 		}, baseline)
 	}
@@ -367,7 +371,7 @@ func addFlights(baseline bool) {
 		flightId := strconv.Itoa(i)
 		cayonlib.Populate("flight", flightId, flight.Flight{
 			FlightId:  flightId,
-			Cap:       10,
+			Cap:       kCap,
 			Customers: []string{},
 		}, baseline)
 	}
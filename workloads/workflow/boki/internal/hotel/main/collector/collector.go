@@ -1,14 +1,11 @@
 package main
 
 import (
-	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/eniac/Beldi/pkg/cayonlib"
-)
 
-func Handler() {
-	cayonlib.RestartAll("gateway")
-}
+	"cs.utexas.edu/zjia/faas"
+)
 
 func main() {
-	lambda.Start(Handler)
+	faas.Serve(cayonlib.CreateCollectorHandlerFactory("gateway"))
 }
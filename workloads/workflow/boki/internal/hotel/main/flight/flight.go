@@ -5,7 +5,7 @@ import (
 	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
 	"github.com/eniac/Beldi/internal/hotel/main/data"
 	"github.com/eniac/Beldi/pkg/cayonlib"
-	"github.com/mitchellh/mapstructure"
+	"github.com/eniac/Beldi/pkg/cayonlib/typed"
 )
 
 type Flight struct {
@@ -14,36 +14,50 @@ type Flight struct {
 	Customers []string
 }
 
-func BaseReserveFlight(env *cayonlib.Env, flightId string, userId string) bool {
-	item := cayonlib.Read(env, data.Tflight(), flightId)
-	var flight Flight
-	cayonlib.CHECK(mapstructure.Decode(item, &flight))
+func BaseReserveFlight(env *cayonlib.Env, flightId string, userId string) (bool, error) {
+	flight, _, err := typed.Read[Flight](env, data.Tflight(), flightId)
+	if err != nil {
+		return false, err
+	}
 	if flight.Cap == 0 {
-		return false
+		return false, nil
 	}
-	cayonlib.Write(env, data.Tflight(), flightId, map[expression.NameBuilder]expression.OperandBuilder{
-		expression.Name("V.cap"): expression.Value(flight.Cap),
+	err = cayonlib.Write(env, data.Tflight(), flightId, map[expression.NameBuilder]expression.OperandBuilder{
+		expression.Name("V.Cap"): expression.Value(flight.Cap - 1),
 	})
-	return true
+	return err == nil, err
 }
 
-func ReserveFlight(env *cayonlib.Env, flightId string, userId string) bool {
-	ok, item := cayonlib.TPLRead(env, data.Tflight(), flightId)
-	if !ok {
-		return false
+func ReserveFlight(env *cayonlib.Env, flightId string, userId string) (bool, error) {
+	flight, ok, err := typed.TxnRead[Flight](env, data.Tflight(), flightId)
+	if err != nil || !ok {
+		return false, err
 	}
-	var flight Flight
-	cayonlib.CHECK(mapstructure.Decode(item, &flight))
 	if flight.Cap == 0 {
-		return false
+		return false, nil
 	}
-	ok = cayonlib.TPLWrite(env, data.Tflight(), flightId,
-		aws.JSONValue{"V.Cap": flight.Cap})
-	return ok
+	return cayonlib.TxnWrite(env, data.Tflight(), flightId,
+		aws.JSONValue{"V.Cap": flight.Cap - 1})
+}
+
+// SagaReserveFlight reserves flightId without a transaction, to be undone by
+// CancelFlight if a later step of the saga fails. Without locks, the check and
+// the decrement of Cap are one conditional write, so that concurrent sagas
+// cannot oversell.
+func SagaReserveFlight(env *cayonlib.Env, flightId string, userId string) (bool, error) {
+	return cayonlib.CondWriteApplied(env, data.Tflight(), flightId, map[expression.NameBuilder]expression.OperandBuilder{
+		expression.Name("V.Cap"): expression.Name("V.Cap").Minus(expression.Value(1)),
+	}, expression.Name("V.Cap").GreaterThan(expression.Value(0)))
+}
+
+func CancelFlight(env *cayonlib.Env, flightId string, userId string) error {
+	return cayonlib.Write(env, data.Tflight(), flightId, map[expression.NameBuilder]expression.OperandBuilder{
+		expression.Name("V.Cap"): expression.Name("V.Cap").Plus(expression.Value(1)),
+	})
 }
 
-func AddFlight(env *cayonlib.Env, flightId string, cap int32) {
-	cayonlib.Write(env, data.Tflight(), flightId, map[expression.NameBuilder]expression.OperandBuilder{
+func AddFlight(env *cayonlib.Env, flightId string, cap int32) error {
+	return cayonlib.Write(env, data.Tflight(), flightId, map[expression.NameBuilder]expression.OperandBuilder{
 		expression.Name("V"): expression.Value(Flight{
 			FlightId:  flightId,
 			Cap:       cap,
@@ -1,73 +1,173 @@
 package frontend
 
 import (
+	"os"
+
 	"github.com/eniac/Beldi/internal/hotel/main/data"
 	"github.com/eniac/Beldi/pkg/cayonlib"
 )
 
-func SendRequest(env *cayonlib.Env, userId string, flightId string, hotelId string) string {
+// SAGA makes SendRequest reserve the hotel and the flight in a saga instead
+// of a transaction, read from the HOTEL_SAGA environment variable
+var SAGA = os.Getenv("HOTEL_SAGA") != ""
+
+// reserveStep returns a saga action invoking function of callee
+func reserveStep(env *cayonlib.Env, callee string, function string, input map[string]string) func() (bool, error) {
+	return func() (bool, error) {
+		res, _, err := cayonlib.SyncInvoke(env, callee, data.RPCInput{
+			Function: function,
+			Input:    input,
+		})
+		if err != nil {
+			return false, err
+		}
+		return res.(bool), nil
+	}
+}
+
+// sendRequestSaga reserves the hotel, then the flight. If the flight is full,
+// the saga cancels the hotel reservation. A replay during compensation does
+// not cancel twice, as the cancelling invocation is logged like any other.
+func sendRequestSaga(env *cayonlib.Env, userId string, flightId string, hotelId string) (string, error) {
+	saga := cayonlib.BeginSaga(env)
+	hotelInput := map[string]string{
+		"hotelId": hotelId,
+		"userId":  userId,
+	}
+	ok, err := saga.Step("ReserveHotel",
+		reserveStep(env, data.Thotel(), "SagaReserveHotel", hotelInput),
+		func() error {
+			_, _, err := cayonlib.SyncInvoke(env, data.Thotel(), data.RPCInput{
+				Function: "CancelHotel",
+				Input:    hotelInput,
+			})
+			return err
+		})
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "Place Order Fails", nil
+	}
+	flightInput := map[string]string{
+		"flightId": flightId,
+		"userId":   userId,
+	}
+	// The last step has nothing to undo
+	ok, err = saga.Step("ReserveFlight",
+		reserveStep(env, data.Tflight(), "SagaReserveFlight", flightInput), nil)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "Place Order Fails", nil
+	}
+	_, err = cayonlib.AsyncInvoke(env, data.Torder(), data.RPCInput{
+		Function: "PlaceOrder",
+		Input: map[string]string{
+			"flightId": flightId,
+			"hotelId":  hotelId,
+			"userId":   userId,
+		},
+	})
+	return "Place Order Success", err
+}
+
+// abortOnError aborts the transaction of env before a callee's application
+// error is returned, as the callee may hold locks. Step errors leave the
+// transaction to the replay of the instance.
+func abortOnError(env *cayonlib.Env, err error) error {
+	if cayonlib.IsStepError(err) {
+		return err
+	}
+	if abortErr := cayonlib.AbortTxn(env); abortErr != nil {
+		return abortErr
+	}
+	return err
+}
+
+func SendRequest(env *cayonlib.Env, userId string, flightId string, hotelId string) (string, error) {
+	if SAGA && cayonlib.TYPE != "BASELINE" {
+		return sendRequestSaga(env, userId, flightId, hotelId)
+	}
 	if cayonlib.TYPE == "BASELINE" {
 		input := map[string]string{
 			"hotelId": hotelId,
 			"userId":  userId,
 		}
-		cayonlib.SyncInvoke(env, data.Thotel(), data.RPCInput{
+		if _, _, err := cayonlib.SyncInvoke(env, data.Thotel(), data.RPCInput{
 			Function: "BaseReserveHotel",
 			Input:    input,
-		})
+		}); err != nil {
+			return "", err
+		}
 		input = map[string]string{
 			"flightId": flightId,
 			"userId":   userId,
 		}
-		cayonlib.SyncInvoke(env, data.Tflight(), data.RPCInput{
+		if _, _, err := cayonlib.SyncInvoke(env, data.Tflight(), data.RPCInput{
 			Function: "BaseReserveFlight",
 			Input:    input,
-		})
+		}); err != nil {
+			return "", err
+		}
 		input = map[string]string{
 			"flightId": flightId,
 			"hotelId":  hotelId,
 			"userId":   userId,
 		}
-		cayonlib.AsyncInvoke(env, data.Torder(), data.RPCInput{
+		_, err := cayonlib.AsyncInvoke(env, data.Torder(), data.RPCInput{
 			Function: "PlaceOrder",
 			Input:    input,
 		})
-		return ""
+		return "", err
+	}
+	if err := cayonlib.BeginTxn(env); err != nil {
+		return "", err
 	}
-	cayonlib.BeginTxn(env)
 	input := map[string]string{
 		"hotelId": hotelId,
 		"userId":  userId,
 	}
-	res, _ := cayonlib.SyncInvoke(env, data.Thotel(), data.RPCInput{
+	res, _, err := cayonlib.SyncInvoke(env, data.Thotel(), data.RPCInput{
 		Function: "ReserveHotel",
 		Input:    input,
 	})
+	if err != nil {
+		return "", abortOnError(env, err)
+	}
 	if !res.(bool) {
-		cayonlib.AbortTxn(env)
-		return "Place Order Fails"
+		return "Place Order Fails", cayonlib.AbortTxn(env)
 	}
 	input = map[string]string{
 		"flightId": flightId,
 		"userId":   userId,
 	}
-	res, _ = cayonlib.SyncInvoke(env, data.Tflight(), data.RPCInput{
+	res, _, err = cayonlib.SyncInvoke(env, data.Tflight(), data.RPCInput{
 		Function: "ReserveFlight",
 		Input:    input,
 	})
+	if err != nil {
+		return "", abortOnError(env, err)
+	}
 	if !res.(bool) {
-		cayonlib.AbortTxn(env)
-		return "Place Order Fails"
+		return "Place Order Fails", cayonlib.AbortTxn(env)
 	}
 	input = map[string]string{
 		"flightId": flightId,
 		"hotelId":  hotelId,
 		"userId":   userId,
 	}
-	cayonlib.CommitTxn(env)
-	cayonlib.AsyncInvoke(env, data.Torder(), data.RPCInput{
+	committed, err := cayonlib.CommitTxn(env)
+	if err != nil {
+		return "", err
+	}
+	if !committed {
+		return "Place Order Fails", nil
+	}
+	_, err = cayonlib.AsyncInvoke(env, data.Torder(), data.RPCInput{
 		Function: "PlaceOrder",
 		Input:    input,
 	})
-	return "Place Order Success"
+	return "Place Order Success", err
 }
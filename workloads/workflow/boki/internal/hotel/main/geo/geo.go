@@ -7,25 +7,33 @@ import (
 	"github.com/mitchellh/mapstructure"
 )
 
-func newGeoIndex(env *cayonlib.Env) *geoindex.ClusteringIndex {
+func newGeoIndex(env *cayonlib.Env) (*geoindex.ClusteringIndex, error) {
 	var ps []data.Point
-	res := cayonlib.Scan(env, data.Tgeo())
-	err := mapstructure.Decode(res, &ps)
-	cayonlib.CHECK(err)
+	res, err := cayonlib.Scan(env, data.Tgeo())
+	if err != nil {
+		return nil, err
+	}
+	err = mapstructure.Decode(res, &ps)
+	if err != nil {
+		return nil, err
+	}
 	index := geoindex.NewClusteringIndex()
 	for _, e := range ps {
 		index.Add(e)
 	}
-	return index
+	return index, nil
 }
 
-func getNearbyPoints(env *cayonlib.Env, lat float64, lon float64) []geoindex.Point {
+func getNearbyPoints(env *cayonlib.Env, lat float64, lon float64) ([]geoindex.Point, error) {
 	center := &geoindex.GeoPoint{
 		Pid:  "",
 		Plat: lat,
 		Plon: lon,
 	}
-	index := newGeoIndex(env)
+	index, err := newGeoIndex(env)
+	if err != nil {
+		return nil, err
+	}
 	res := index.KNearest(
 		center,
 		5,
@@ -33,16 +41,17 @@ func getNearbyPoints(env *cayonlib.Env, lat float64, lon float64) []geoindex.Poi
 			return true
 		},
 	)
-	return res
+	return res, nil
 }
 
-func Nearby(env *cayonlib.Env, req Request) Result {
-	var (
-		points = getNearbyPoints(env, req.Lat, req.Lon)
-	)
+func Nearby(env *cayonlib.Env, req Request) (Result, error) {
+	points, err := getNearbyPoints(env, req.Lat, req.Lon)
+	if err != nil {
+		return Result{}, err
+	}
 	res := Result{HotelIds: []string{}}
 	for _, p := range points {
 		res.HotelIds = append(res.HotelIds, p.Id())
 	}
-	return res
+	return res, nil
 }
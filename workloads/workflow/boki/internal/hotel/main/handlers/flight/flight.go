@@ -10,20 +10,25 @@ import (
 	"cs.utexas.edu/zjia/faas"
 )
 
-func Handler(env *cayonlib.Env) interface{} {
+func Handler(env *cayonlib.Env) (interface{}, error) {
 	var rpcInput data.RPCInput
-	cayonlib.CHECK(mapstructure.Decode(env.Input, &rpcInput))
+	if err := mapstructure.Decode(env.Input, &rpcInput); err != nil {
+		return nil, err
+	}
 	req := rpcInput.Input.(map[string]interface{})
 	switch rpcInput.Function {
 	case "ReserveFlight":
 		return flight.ReserveFlight(env, req["flightId"].(string), req["userId"].(string))
 	case "BaseReserveFlight":
 		return flight.BaseReserveFlight(env, req["flightId"].(string), req["userId"].(string))
+	case "SagaReserveFlight":
+		return flight.SagaReserveFlight(env, req["flightId"].(string), req["userId"].(string))
+	case "CancelFlight":
+		return 0, flight.CancelFlight(env, req["flightId"].(string), req["userId"].(string))
 	case "AddFlight":
-		flight.AddFlight(env, req["flightId"].(string), int32(req["cap"].(float64)))
-		return 0
+		return 0, flight.AddFlight(env, req["flightId"].(string), int32(req["cap"].(float64)))
 	}
-	panic("no such function")
+	return nil, cayonlib.NewError("NoSuchFunction", rpcInput.Function)
 }
 
 func main() {
@@ -8,7 +8,7 @@ import (
 	"cs.utexas.edu/zjia/faas"
 )
 
-func Handler(env *cayonlib.Env) interface{} {
+func Handler(env *cayonlib.Env) (interface{}, error) {
 	req := env.Input.(map[string]interface{})
 	return frontend.SendRequest(env, req["userId"].(string), req["flightId"].(string), req["hotelId"].(string))
 }
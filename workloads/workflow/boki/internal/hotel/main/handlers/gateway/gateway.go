@@ -9,25 +9,27 @@ import (
 	"cs.utexas.edu/zjia/faas"
 )
 
-func Handler(env *cayonlib.Env) interface{} {
+func Handler(env *cayonlib.Env) (interface{}, error) {
 	var rpcInput data.RPCInput
-	cayonlib.CHECK(mapstructure.Decode(env.Input, &rpcInput))
+	if err := mapstructure.Decode(env.Input, &rpcInput); err != nil {
+		return nil, err
+	}
 	//req := rpcInput.Input.(map[string]interface{})
 	switch rpcInput.Function {
 	case "search":
-		res, _ := cayonlib.SyncInvoke(env, data.Tsearch(), rpcInput.Input)
-		return res
+		res, _, err := cayonlib.SyncInvoke(env, data.Tsearch(), rpcInput.Input)
+		return res, err
 	case "recommend":
-		res, _ := cayonlib.SyncInvoke(env, data.Trecommendation(), rpcInput.Input)
-		return res
+		res, _, err := cayonlib.SyncInvoke(env, data.Trecommendation(), rpcInput.Input)
+		return res, err
 	case "user":
-		res, _ := cayonlib.SyncInvoke(env, data.Tuser(), rpcInput.Input)
-		return res
+		res, _, err := cayonlib.SyncInvoke(env, data.Tuser(), rpcInput.Input)
+		return res, err
 	case "reserve":
-		res, _ := cayonlib.SyncInvoke(env, data.Tfrontend(), rpcInput.Input)
-		return res
+		res, _, err := cayonlib.SyncInvoke(env, data.Tfrontend(), rpcInput.Input)
+		return res, err
 	}
-	return 0
+	return 0, nil
 }
 
 func main() {
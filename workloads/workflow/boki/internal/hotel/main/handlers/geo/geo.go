@@ -9,10 +9,12 @@ import (
 	"cs.utexas.edu/zjia/faas"
 )
 
-func Handler(env *cayonlib.Env) interface{} {
+func Handler(env *cayonlib.Env) (interface{}, error) {
 	req := geo.Request{}
 	err := mapstructure.Decode(env.Input, &req)
-	cayonlib.CHECK(err)
+	if err != nil {
+		return nil, err
+	}
 	return geo.Nearby(env, req)
 }
 
@@ -10,20 +10,25 @@ import (
 	"cs.utexas.edu/zjia/faas"
 )
 
-func Handler(env *cayonlib.Env) interface{} {
+func Handler(env *cayonlib.Env) (interface{}, error) {
 	var rpcInput data.RPCInput
-	cayonlib.CHECK(mapstructure.Decode(env.Input, &rpcInput))
+	if err := mapstructure.Decode(env.Input, &rpcInput); err != nil {
+		return nil, err
+	}
 	req := rpcInput.Input.(map[string]interface{})
 	switch rpcInput.Function {
 	case "ReserveHotel":
 		return hotel.ReserveHotel(env, req["hotelId"].(string), req["userId"].(string))
 	case "BaseReserveHotel":
 		return hotel.BaseReserveHotel(env, req["hotelId"].(string), req["userId"].(string))
+	case "SagaReserveHotel":
+		return hotel.SagaReserveHotel(env, req["hotelId"].(string), req["userId"].(string))
+	case "CancelHotel":
+		return 0, hotel.CancelHotel(env, req["hotelId"].(string), req["userId"].(string))
 	case "AddHotel":
-		hotel.AddHotel(env, req["hotelId"].(string), int32(req["cap"].(float64)))
-		return 0
+		return 0, hotel.AddHotel(env, req["hotelId"].(string), int32(req["cap"].(float64)))
 	}
-	panic("no such function")
+	return nil, cayonlib.NewError("NoSuchFunction", rpcInput.Function)
 }
 func main() {
 	// lambda.Start(cayonlib.Wrapper(Handler))
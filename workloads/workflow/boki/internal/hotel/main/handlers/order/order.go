@@ -10,12 +10,13 @@ import (
 	"cs.utexas.edu/zjia/faas"
 )
 
-func Handler(env *cayonlib.Env) interface{} {
+func Handler(env *cayonlib.Env) (interface{}, error) {
 	var rpcInput data.RPCInput
-	cayonlib.CHECK(mapstructure.Decode(env.Input, &rpcInput))
+	if err := mapstructure.Decode(env.Input, &rpcInput); err != nil {
+		return nil, err
+	}
 	req := rpcInput.Input.(map[string]interface{})
-	order.PlaceOrder(env, req["userId"].(string), req["flightId"].(string), req["hotelId"].(string))
-	return 0
+	return 0, order.PlaceOrder(env, req["userId"].(string), req["flightId"].(string), req["hotelId"].(string))
 }
 
 func main() {
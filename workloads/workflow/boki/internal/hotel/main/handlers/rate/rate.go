@@ -9,10 +9,12 @@ import (
 	"cs.utexas.edu/zjia/faas"
 )
 
-func Handler(env *cayonlib.Env) interface{} {
+func Handler(env *cayonlib.Env) (interface{}, error) {
 	req := rate.Request{}
 	err := mapstructure.Decode(env.Input, &req)
-	cayonlib.CHECK(err)
+	if err != nil {
+		return nil, err
+	}
 	return rate.GetRates(env, req)
 }
 
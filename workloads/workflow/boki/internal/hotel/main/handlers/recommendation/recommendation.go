@@ -10,12 +10,17 @@ import (
 	"cs.utexas.edu/zjia/faas"
 )
 
-func Handler(env *cayonlib.Env) interface{} {
+func Handler(env *cayonlib.Env) (interface{}, error) {
 	req := recommendation.Request{}
 	err := mapstructure.Decode(env.Input, &req)
-	cayonlib.CHECK(err)
-	res := recommendation.GetRecommendations(env, req)
-	return aws.JSONValue{"recommend": res}
+	if err != nil {
+		return nil, err
+	}
+	res, err := recommendation.GetRecommendations(env, req)
+	if err != nil {
+		return nil, err
+	}
+	return aws.JSONValue{"recommend": res}, nil
 }
 
 func main() {
@@ -10,11 +10,17 @@ import (
 	"cs.utexas.edu/zjia/faas"
 )
 
-func Handler(env *cayonlib.Env) interface{} {
+func Handler(env *cayonlib.Env) (interface{}, error) {
 	req := search.Request{}
 	err := mapstructure.Decode(env.Input, &req)
-	cayonlib.CHECK(err)
-	return aws.JSONValue{"search": search.Nearby(env, req)}
+	if err != nil {
+		return nil, err
+	}
+	res, err := search.Nearby(env, req)
+	if err != nil {
+		return nil, err
+	}
+	return aws.JSONValue{"search": res}, nil
 }
 
 func main() {
@@ -5,7 +5,7 @@ import (
 	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
 	"github.com/eniac/Beldi/internal/hotel/main/data"
 	"github.com/eniac/Beldi/pkg/cayonlib"
-	"github.com/mitchellh/mapstructure"
+	"github.com/eniac/Beldi/pkg/cayonlib/typed"
 )
 
 type Hotel struct {
@@ -14,36 +14,50 @@ type Hotel struct {
 	Customers []string
 }
 
-func BaseReserveHotel(env *cayonlib.Env, hotelId string, userId string) bool {
-	item := cayonlib.Read(env, data.Thotel(), hotelId)
-	var hotel Hotel
-	cayonlib.CHECK(mapstructure.Decode(item, &hotel))
+func BaseReserveHotel(env *cayonlib.Env, hotelId string, userId string) (bool, error) {
+	hotel, _, err := typed.Read[Hotel](env, data.Thotel(), hotelId)
+	if err != nil {
+		return false, err
+	}
 	if hotel.Cap == 0 {
-		return false
+		return false, nil
 	}
-	cayonlib.Write(env, data.Thotel(), hotelId, map[expression.NameBuilder]expression.OperandBuilder{
-		expression.Name("V.Cap"): expression.Value(hotel.Cap),
+	err = cayonlib.Write(env, data.Thotel(), hotelId, map[expression.NameBuilder]expression.OperandBuilder{
+		expression.Name("V.Cap"): expression.Value(hotel.Cap - 1),
 	})
-	return true
+	return err == nil, err
 }
 
-func ReserveHotel(env *cayonlib.Env, hotelId string, userId string) bool {
-	ok, item := cayonlib.TPLRead(env, data.Thotel(), hotelId)
-	if !ok {
-		return false
+func ReserveHotel(env *cayonlib.Env, hotelId string, userId string) (bool, error) {
+	hotel, ok, err := typed.TxnRead[Hotel](env, data.Thotel(), hotelId)
+	if err != nil || !ok {
+		return false, err
 	}
-	var hotel Hotel
-	cayonlib.CHECK(mapstructure.Decode(item, &hotel))
 	if hotel.Cap == 0 {
-		return false
+		return false, nil
 	}
-	ok = cayonlib.TPLWrite(env, data.Thotel(), hotelId,
-		aws.JSONValue{"V.Cap": hotel.Cap})
-	return ok
+	return cayonlib.TxnWrite(env, data.Thotel(), hotelId,
+		aws.JSONValue{"V.Cap": hotel.Cap - 1})
+}
+
+// SagaReserveHotel reserves hotelId without a transaction, to be undone by
+// CancelHotel if a later step of the saga fails. Without locks, the check and
+// the decrement of Cap are one conditional write, so that concurrent sagas
+// cannot oversell.
+func SagaReserveHotel(env *cayonlib.Env, hotelId string, userId string) (bool, error) {
+	return cayonlib.CondWriteApplied(env, data.Thotel(), hotelId, map[expression.NameBuilder]expression.OperandBuilder{
+		expression.Name("V.Cap"): expression.Name("V.Cap").Minus(expression.Value(1)),
+	}, expression.Name("V.Cap").GreaterThan(expression.Value(0)))
+}
+
+func CancelHotel(env *cayonlib.Env, hotelId string, userId string) error {
+	return cayonlib.Write(env, data.Thotel(), hotelId, map[expression.NameBuilder]expression.OperandBuilder{
+		expression.Name("V.Cap"): expression.Name("V.Cap").Plus(expression.Value(1)),
+	})
 }
 
-func AddHotel(env *cayonlib.Env, hotelId string, cap int32) {
-	cayonlib.Write(env, data.Thotel(), hotelId, map[expression.NameBuilder]expression.OperandBuilder{
+func AddHotel(env *cayonlib.Env, hotelId string, cap int32) error {
+	return cayonlib.Write(env, data.Thotel(), hotelId, map[expression.NameBuilder]expression.OperandBuilder{
 		expression.Name("V"): expression.Value(Hotel{
 			HotelId:   hotelId,
 			Cap:       cap,
@@ -14,9 +14,9 @@ type Order struct {
 	UserId   string
 }
 
-func PlaceOrder(env *cayonlib.Env, userId string, flightId string, hotelId string) {
+func PlaceOrder(env *cayonlib.Env, userId string, flightId string, hotelId string) error {
 	orderId := shortuuid.New()
-	cayonlib.Write(env, data.Torder(), orderId,
+	return cayonlib.Write(env, data.Torder(), orderId,
 		map[expression.NameBuilder]expression.OperandBuilder{expression.Name("V"): expression.Value(Order{
 			OrderId: orderId, FlightId: flightId, HotelId: hotelId, UserId: userId,
 		})})
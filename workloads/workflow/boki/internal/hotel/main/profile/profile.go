@@ -3,17 +3,17 @@ package profile
 import (
 	"github.com/eniac/Beldi/internal/hotel/main/data"
 	"github.com/eniac/Beldi/pkg/cayonlib"
-	"github.com/mitchellh/mapstructure"
+	"github.com/eniac/Beldi/pkg/cayonlib/typed"
 )
 
-func GetProfiles(env *cayonlib.Env, req Request) Result {
+func GetProfiles(env *cayonlib.Env, req Request) (Result, error) {
 	var hotels []data.Hotel
 	for _, i := range req.HotelIds {
-		hotel := data.Hotel{}
-		res := cayonlib.Read(env, data.Tprofile(), i)
-		err := mapstructure.Decode(res, &hotel)
-		cayonlib.CHECK(err)
+		hotel, _, err := typed.Read[data.Hotel](env, data.Tprofile(), i)
+		if err != nil {
+			return Result{}, err
+		}
 		hotels = append(hotels, hotel)
 	}
-	return Result{Hotels: hotels}
+	return Result{Hotels: hotels}, nil
 }
@@ -3,21 +3,21 @@ package rate
 import (
 	"github.com/eniac/Beldi/internal/hotel/main/data"
 	"github.com/eniac/Beldi/pkg/cayonlib"
-	"github.com/mitchellh/mapstructure"
+	"github.com/eniac/Beldi/pkg/cayonlib/typed"
 	"sort"
 )
 
-func GetRates(env *cayonlib.Env, req Request) Result {
+func GetRates(env *cayonlib.Env, req Request) (Result, error) {
 	var plans RatePlans
 	for _, i := range req.HotelIds {
-		plan := data.RatePlan{}
-		res := cayonlib.Read(env, data.Trate(), i)
-		err := mapstructure.Decode(res, &plan)
-		cayonlib.CHECK(err)
+		plan, _, err := typed.Read[data.RatePlan](env, data.Trate(), i)
+		if err != nil {
+			return Result{}, err
+		}
 		if plan.HotelId != "" {
 			plans = append(plans, plan)
 		}
 	}
 	sort.Sort(plans)
-	return Result{RatePlans: plans}
+	return Result{RatePlans: plans}, nil
 }
@@ -8,16 +8,21 @@ import (
 	"math"
 )
 
-func LoadRecommendations(env *cayonlib.Env) []data.Recommend {
+func LoadRecommendations(env *cayonlib.Env) ([]data.Recommend, error) {
 	var recommends []data.Recommend
-	res := cayonlib.Scan(env, data.Trecommendation())
-	err := mapstructure.Decode(res, &recommends)
-	cayonlib.CHECK(err)
-	return recommends
+	res, err := cayonlib.Scan(env, data.Trecommendation())
+	if err != nil {
+		return nil, err
+	}
+	err = mapstructure.Decode(res, &recommends)
+	return recommends, err
 }
 
-func GetRecommendations(env *cayonlib.Env, req Request) Result {
-	hotels := LoadRecommendations(env)
+func GetRecommendations(env *cayonlib.Env, req Request) (Result, error) {
+	hotels, err := LoadRecommendations(env)
+	if err != nil {
+		return Result{}, err
+	}
 	res := Result{HotelIds: []string{}}
 	switch req.Require {
 	case "dis":
@@ -72,7 +77,7 @@ func GetRecommendations(env *cayonlib.Env, req Request) Result {
 			}
 		}
 	default:
-		panic("no such requirement")
+		return Result{}, cayonlib.NewError("NoSuchRequirement", req.Require)
 	}
-	return res
+	return res, nil
 }
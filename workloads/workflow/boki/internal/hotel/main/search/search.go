@@ -8,20 +8,30 @@ import (
 	"github.com/mitchellh/mapstructure"
 )
 
-func Nearby(env *cayonlib.Env, req Request) Result {
-	res, _ := cayonlib.SyncInvoke(env, data.Tgeo(), geo.Request{Lat: req.Lat, Lon: req.Lon})
+func Nearby(env *cayonlib.Env, req Request) (Result, error) {
+	res, _, err := cayonlib.SyncInvoke(env, data.Tgeo(), geo.Request{Lat: req.Lat, Lon: req.Lon})
+	if err != nil {
+		return Result{}, err
+	}
 	var geoRes geo.Result
-	cayonlib.CHECK(mapstructure.Decode(res, &geoRes))
-	res, _ = cayonlib.SyncInvoke(env, data.Trate(), rate.Request{
+	if err := mapstructure.Decode(res, &geoRes); err != nil {
+		return Result{}, err
+	}
+	res, _, err = cayonlib.SyncInvoke(env, data.Trate(), rate.Request{
 		HotelIds: geoRes.HotelIds,
 		Indate:   req.InDate,
 		Outdate:  req.OutDate,
 	})
+	if err != nil {
+		return Result{}, err
+	}
 	var rateRes rate.Result
-	cayonlib.CHECK(mapstructure.Decode(res, &rateRes))
+	if err := mapstructure.Decode(res, &rateRes); err != nil {
+		return Result{}, err
+	}
 	var hts []string
 	for _, r := range rateRes.RatePlans {
 		hts = append(hts, r.HotelId)
 	}
-	return Result{HotelIds: hts}
+	return Result{HotelIds: hts}, nil
 }
@@ -3,13 +3,13 @@ package user
 import (
 	"github.com/eniac/Beldi/internal/hotel/main/data"
 	"github.com/eniac/Beldi/pkg/cayonlib"
-	"github.com/mitchellh/mapstructure"
+	"github.com/eniac/Beldi/pkg/cayonlib/typed"
 )
 
-func CheckUser(env *cayonlib.Env, req Request) Result {
-	var user data.User
-	item := cayonlib.Read(env, data.Tuser(), req.Username)
-	err := mapstructure.Decode(item, &user)
-	cayonlib.CHECK(err)
-	return Result{Correct: req.Password == user.Password}
+func CheckUser(env *cayonlib.Env, req Request) (Result, error) {
+	user, _, err := typed.Read[data.User](env, data.Tuser(), req.Username)
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{Correct: req.Password == user.Password}, nil
 }
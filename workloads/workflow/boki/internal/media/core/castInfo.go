@@ -6,19 +6,24 @@ import (
 	"github.com/mitchellh/mapstructure"
 )
 
-func WriteCastInfo(env *cayonlib.Env, info CastInfo) {
-	cayonlib.Write(env, TCastInfo(), info.CastInfoId, map[expression.NameBuilder]expression.OperandBuilder{
+func WriteCastInfo(env *cayonlib.Env, info CastInfo) error {
+	return cayonlib.Write(env, TCastInfo(), info.CastInfoId, map[expression.NameBuilder]expression.OperandBuilder{
 		expression.Name("V"): expression.Value(info),
 	})
 }
 
-func ReadCastInfo(env *cayonlib.Env, castIds []string) []CastInfo {
+func ReadCastInfo(env *cayonlib.Env, castIds []string) ([]CastInfo, error) {
 	var res []CastInfo
 	for _, id := range castIds {
 		var castInfo CastInfo
-		item := cayonlib.Read(env, TCastInfo(), id)
-		cayonlib.CHECK(mapstructure.Decode(item, &castInfo))
+		item, err := cayonlib.Read(env, TCastInfo(), id)
+		if err != nil {
+			return nil, err
+		}
+		if err := mapstructure.Decode(item, &castInfo); err != nil {
+			return nil, err
+		}
 		res = append(res, castInfo)
 	}
-	return res
+	return res, nil
 }
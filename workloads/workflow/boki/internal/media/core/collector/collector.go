@@ -1,25 +1,11 @@
 package main
 
 import (
-	"github.com/aws/aws-lambda-go/lambda"
-	"github.com/eniac/Beldi/pkg/beldilib"
-	"sync"
-)
+	"github.com/eniac/Beldi/pkg/cayonlib"
 
-func Handler() {
-	var wg sync.WaitGroup
-	wg.Add(2)
-	go func() {
-		defer wg.Done()
-		beldilib.RestartAll("Frontend")
-	}()
-	go func() {
-		defer wg.Done()
-		beldilib.RestartAll("ComposeReview")
-	}()
-	wg.Wait()
-}
+	"cs.utexas.edu/zjia/faas"
+)
 
 func main() {
-	lambda.Start(Handler)
+	faas.Serve(cayonlib.CreateCollectorHandlerFactory("Frontend", "ComposeReview"))
 }
@@ -8,50 +8,65 @@ import (
 	"sync"
 )
 
-func UploadReq(env *cayonlib.Env, reqId string) {
-	cayonlib.Write(env, TComposeReview(), reqId, map[expression.NameBuilder]expression.OperandBuilder{
+func UploadReq(env *cayonlib.Env, reqId string) error {
+	return cayonlib.Write(env, TComposeReview(), reqId, map[expression.NameBuilder]expression.OperandBuilder{
 		expression.Name("V"): expression.Value(aws.JSONValue{"reqId": reqId, "counter": 0}),
 	})
 }
 
-func UploadUniqueId(env *cayonlib.Env, reqId string, reviewId string) {
-	cayonlib.Write(env, TComposeReview(), reqId, map[expression.NameBuilder]expression.OperandBuilder{
+func UploadUniqueId(env *cayonlib.Env, reqId string, reviewId string) error {
+	err := cayonlib.Write(env, TComposeReview(), reqId, map[expression.NameBuilder]expression.OperandBuilder{
 		expression.Name("V.reviewId"): expression.Value(reviewId),
 		expression.Name("V.counter"):  expression.Name("V.counter").Plus(expression.Value(1)),
 	})
-	TryComposeAndUpload(env, reqId)
+	if err != nil {
+		return err
+	}
+	return TryComposeAndUpload(env, reqId)
 }
 
-func UploadText(env *cayonlib.Env, reqId string, text string) {
-	cayonlib.Write(env, TComposeReview(), reqId, map[expression.NameBuilder]expression.OperandBuilder{
+func UploadText(env *cayonlib.Env, reqId string, text string) error {
+	err := cayonlib.Write(env, TComposeReview(), reqId, map[expression.NameBuilder]expression.OperandBuilder{
 		expression.Name("V.text"):    expression.Value(text),
 		expression.Name("V.counter"): expression.Name("V.counter").Plus(expression.Value(1)),
 	})
-	TryComposeAndUpload(env, reqId)
+	if err != nil {
+		return err
+	}
+	return TryComposeAndUpload(env, reqId)
 }
 
-func UploadRating(env *cayonlib.Env, reqId string, rating int32) {
-	cayonlib.Write(env, TComposeReview(), reqId, map[expression.NameBuilder]expression.OperandBuilder{
+func UploadRating(env *cayonlib.Env, reqId string, rating int32) error {
+	err := cayonlib.Write(env, TComposeReview(), reqId, map[expression.NameBuilder]expression.OperandBuilder{
 		expression.Name("V.rating"):  expression.Value(rating),
 		expression.Name("V.counter"): expression.Name("V.counter").Plus(expression.Value(1)),
 	})
-	TryComposeAndUpload(env, reqId)
+	if err != nil {
+		return err
+	}
+	return TryComposeAndUpload(env, reqId)
 }
 
-func UploadUserId(env *cayonlib.Env, reqId string, userId string) {
-	cayonlib.Write(env, TComposeReview(), reqId, map[expression.NameBuilder]expression.OperandBuilder{
+func UploadUserId(env *cayonlib.Env, reqId string, userId string) error {
+	err := cayonlib.Write(env, TComposeReview(), reqId, map[expression.NameBuilder]expression.OperandBuilder{
 		expression.Name("V.userId"):  expression.Value(userId),
 		expression.Name("V.counter"): expression.Name("V.counter").Plus(expression.Value(1)),
 	})
-	TryComposeAndUpload(env, reqId)
+	if err != nil {
+		return err
+	}
+	return TryComposeAndUpload(env, reqId)
 }
 
-func UploadMovieId(env *cayonlib.Env, reqId string, movieId string) {
-	cayonlib.Write(env, TComposeReview(), reqId, map[expression.NameBuilder]expression.OperandBuilder{
+func UploadMovieId(env *cayonlib.Env, reqId string, movieId string) error {
+	err := cayonlib.Write(env, TComposeReview(), reqId, map[expression.NameBuilder]expression.OperandBuilder{
 		expression.Name("V.movieId"): expression.Value(movieId),
 		expression.Name("V.counter"): expression.Name("V.counter").Plus(expression.Value(1)),
 	})
-	TryComposeAndUpload(env, reqId)
+	if err != nil {
+		return err
+	}
+	return TryComposeAndUpload(env, reqId)
 }
 
 func Cleanup(reqId string) {
@@ -88,10 +103,13 @@ func Cleanup(reqId string) {
 	//}
 }
 
-func TryComposeAndUpload(env *cayonlib.Env, reqId string) {
-	item := cayonlib.Read(env, TComposeReview(), reqId)
+func TryComposeAndUpload(env *cayonlib.Env, reqId string) error {
+	item, err := cayonlib.Read(env, TComposeReview(), reqId)
+	if err != nil {
+		return err
+	}
 	if item == nil {
-		return
+		return nil
 	}
 	res := item.(map[string]interface{})
 	if counter, ok := res["counter"].(float64); ok {
@@ -102,21 +120,28 @@ func TryComposeAndUpload(env *cayonlib.Env, reqId string) {
 				defer wg.Done()
 				Cleanup(reqId)
 			}()
+			defer wg.Wait()
 			var review Review
-			cayonlib.CHECK(mapstructure.Decode(res, &review))
-			cayonlib.AsyncInvoke(env, TReviewStorage(), RPCInput{
+			if err := mapstructure.Decode(res, &review); err != nil {
+				return err
+			}
+			if _, err := cayonlib.AsyncInvoke(env, TReviewStorage(), RPCInput{
 				Function: "StoreReview",
 				Input:    review,
-			})
-			cayonlib.AsyncInvoke(env, TUserReview(), RPCInput{
+			}); err != nil {
+				return err
+			}
+			if _, err := cayonlib.AsyncInvoke(env, TUserReview(), RPCInput{
 				Function: "UploadUserReview",
 				Input: aws.JSONValue{
 					"userId":    review.UserId,
 					"reviewId":  review.ReviewId,
 					"timestamp": review.Timestamp,
 				},
-			})
-			cayonlib.AsyncInvoke(env, TMovieReview(), RPCInput{
+			}); err != nil {
+				return err
+			}
+			_, err = cayonlib.AsyncInvoke(env, TMovieReview(), RPCInput{
 				Function: "UploadMovieReview",
 				Input: aws.JSONValue{
 					"movieId":   review.MovieId,
@@ -124,9 +149,10 @@ func TryComposeAndUpload(env *cayonlib.Env, reqId string) {
 					"timestamp": review.Timestamp,
 				},
 			})
-			wg.Wait()
+			return err
 		}
 	} else {
-		panic("counter not found")
+		return cayonlib.NewError("NotFound", "counter not found")
 	}
+	return nil
 }
@@ -51,6 +51,11 @@ type ReviewInfo struct {
 	Timestamp string
 }
 
+// ReviewList is the value of movie and user review tables
+type ReviewList struct {
+	Reviews []ReviewInfo `json:"reviews"`
+}
+
 type Page struct {
 	MovieInfo MovieInfo
 	Reviews   []Review
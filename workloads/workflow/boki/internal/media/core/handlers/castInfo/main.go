@@ -9,21 +9,26 @@ import (
 	"cs.utexas.edu/zjia/faas"
 )
 
-func Handler(env *cayonlib.Env) interface{} {
+func Handler(env *cayonlib.Env) (interface{}, error) {
 	var rpcInput core.RPCInput
-	cayonlib.CHECK(mapstructure.Decode(env.Input, &rpcInput))
+	if err := mapstructure.Decode(env.Input, &rpcInput); err != nil {
+		return nil, err
+	}
 	switch rpcInput.Function {
 	case "WriteCastInfo":
 		var info core.CastInfo
-		cayonlib.CHECK(mapstructure.Decode(rpcInput.Input, &info))
-		core.WriteCastInfo(env, info)
-		return 0
+		if err := mapstructure.Decode(rpcInput.Input, &info); err != nil {
+			return nil, err
+		}
+		return 0, core.WriteCastInfo(env, info)
 	case "ReadCastInfo":
 		var castInfos []string
-		cayonlib.CHECK(mapstructure.Decode(rpcInput.Input, &castInfos))
+		if err := mapstructure.Decode(rpcInput.Input, &castInfos); err != nil {
+			return nil, err
+		}
 		return core.ReadCastInfo(env, castInfos)
 	}
-	panic("no such function")
+	return nil, cayonlib.NewError("NoSuchFunction", rpcInput.Function)
 }
 
 func main() {
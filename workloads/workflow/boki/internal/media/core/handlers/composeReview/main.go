@@ -9,31 +9,27 @@ import (
 	"cs.utexas.edu/zjia/faas"
 )
 
-func Handler(env *cayonlib.Env) interface{} {
+func Handler(env *cayonlib.Env) (interface{}, error) {
 	var rpcInput core.RPCInput
-	cayonlib.CHECK(mapstructure.Decode(env.Input, &rpcInput))
+	if err := mapstructure.Decode(env.Input, &rpcInput); err != nil {
+		return nil, err
+	}
 	req := rpcInput.Input.(map[string]interface{})
 	switch rpcInput.Function {
 	case "UploadReq":
-		core.UploadReq(env, req["reqId"].(string))
-		return 0
+		return 0, core.UploadReq(env, req["reqId"].(string))
 	case "UploadUniqueId":
-		core.UploadUniqueId(env, req["reqId"].(string), req["reviewId"].(string))
-		return 0
+		return 0, core.UploadUniqueId(env, req["reqId"].(string), req["reviewId"].(string))
 	case "UploadText":
-		core.UploadText(env, req["reqId"].(string), req["text"].(string))
-		return 0
+		return 0, core.UploadText(env, req["reqId"].(string), req["text"].(string))
 	case "UploadRating":
-		core.UploadRating(env, req["reqId"].(string), int32(req["rating"].(float64)))
-		return 0
+		return 0, core.UploadRating(env, req["reqId"].(string), int32(req["rating"].(float64)))
 	case "UploadUserId":
-		core.UploadUserId(env, req["reqId"].(string), req["userId"].(string))
-		return 0
+		return 0, core.UploadUserId(env, req["reqId"].(string), req["userId"].(string))
 	case "UploadMovieId":
-		core.UploadMovieId(env, req["reqId"].(string), req["movieId"].(string))
-		return 0
+		return 0, core.UploadMovieId(env, req["reqId"].(string), req["movieId"].(string))
 	}
-	panic("no such function")
+	return nil, cayonlib.NewError("NoSuchFunction", rpcInput.Function)
 }
 
 func main() {
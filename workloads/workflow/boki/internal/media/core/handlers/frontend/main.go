@@ -1,7 +1,6 @@
 package main
 
 import (
-	"fmt"
 	// "github.com/aws/aws-lambda-go/lambda"
 	"github.com/eniac/Beldi/internal/media/core"
 	"github.com/eniac/Beldi/pkg/cayonlib"
@@ -10,18 +9,20 @@ import (
 	"cs.utexas.edu/zjia/faas"
 )
 
-func Handler(env *cayonlib.Env) interface{} {
+func Handler(env *cayonlib.Env) (interface{}, error) {
 	var rpcInput core.RPCInput
-	cayonlib.CHECK(mapstructure.Decode(env.Input, &rpcInput))
+	if err := mapstructure.Decode(env.Input, &rpcInput); err != nil {
+		return nil, err
+	}
 	switch rpcInput.Function {
 	case "Compose":
 		var input core.ComposeInput
-		cayonlib.CHECK(mapstructure.Decode(rpcInput.Input, &input))
-		core.Compose(env, input)
-		return 0
+		if err := mapstructure.Decode(rpcInput.Input, &input); err != nil {
+			return nil, err
+		}
+		return 0, core.Compose(env, input)
 	}
-	fmt.Println("ERROR: no such function")
-	panic(rpcInput)
+	return nil, cayonlib.NewError("NoSuchFunction", rpcInput.Function)
 }
 
 func main() {
@@ -9,19 +9,19 @@ import (
 	"cs.utexas.edu/zjia/faas"
 )
 
-func Handler(env *cayonlib.Env) interface{} {
+func Handler(env *cayonlib.Env) (interface{}, error) {
 	var rpcInput core.RPCInput
-	cayonlib.CHECK(mapstructure.Decode(env.Input, &rpcInput))
+	if err := mapstructure.Decode(env.Input, &rpcInput); err != nil {
+		return nil, err
+	}
 	req := rpcInput.Input.(map[string]interface{})
 	switch rpcInput.Function {
 	case "UploadMovie":
-		core.UploadMovie(env, req["reqId"].(string), req["title"].(string), int32(req["rating"].(float64)))
-		return 0
+		return 0, core.UploadMovie(env, req["reqId"].(string), req["title"].(string), int32(req["rating"].(float64)))
 	case "RegisterMovieId":
-		core.RegisterMovieId(env, req["title"].(string), req["movieId"].(string))
-		return 0
+		return 0, core.RegisterMovieId(env, req["title"].(string), req["movieId"].(string))
 	}
-	panic("no such function")
+	return nil, cayonlib.NewError("NoSuchFunction", rpcInput.Function)
 }
 
 func main() {
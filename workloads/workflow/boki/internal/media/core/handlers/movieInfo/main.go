@@ -9,24 +9,26 @@ import (
 	"cs.utexas.edu/zjia/faas"
 )
 
-func Handler(env *cayonlib.Env) interface{} {
+func Handler(env *cayonlib.Env) (interface{}, error) {
 	var rpcInput core.RPCInput
-	cayonlib.CHECK(mapstructure.Decode(env.Input, &rpcInput))
+	if err := mapstructure.Decode(env.Input, &rpcInput); err != nil {
+		return nil, err
+	}
 	req := rpcInput.Input.(map[string]interface{})
 	switch rpcInput.Function {
 	case "WriteMovieInfo":
 		var info core.MovieInfo
-		cayonlib.CHECK(mapstructure.Decode(req["info"], &info))
-		core.WriteMovieInfo(env, info)
-		return 0
+		if err := mapstructure.Decode(req["info"], &info); err != nil {
+			return nil, err
+		}
+		return 0, core.WriteMovieInfo(env, info)
 	case "ReadMovieInfo":
 		return core.ReadMovieInfo(env, req["movieId"].(string))
 	case "UpdateRating":
-		core.UpdateRating(env, req["movieId"].(string), int32(req["sumUncommittedRating"].(float64)),
+		return 0, core.UpdateRating(env, req["movieId"].(string), int32(req["sumUncommittedRating"].(float64)),
 			int32(req["numUncommittedRating"].(float64)))
-		return 0
 	}
-	panic("no such function")
+	return nil, cayonlib.NewError("NoSuchFunction", rpcInput.Function)
 }
 
 func main() {
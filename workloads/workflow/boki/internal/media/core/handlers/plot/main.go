@@ -9,18 +9,19 @@ import (
 	"cs.utexas.edu/zjia/faas"
 )
 
-func Handler(env *cayonlib.Env) interface{} {
+func Handler(env *cayonlib.Env) (interface{}, error) {
 	var rpcInput core.RPCInput
-	cayonlib.CHECK(mapstructure.Decode(env.Input, &rpcInput))
+	if err := mapstructure.Decode(env.Input, &rpcInput); err != nil {
+		return nil, err
+	}
 	req := rpcInput.Input.(map[string]interface{})
 	switch rpcInput.Function {
 	case "WritePlot":
-		core.WritePlot(env, req["plotId"].(string), req["plot"].(string))
-		return 0
+		return 0, core.WritePlot(env, req["plotId"].(string), req["plot"].(string))
 	case "ReadPlot":
 		return core.ReadPlot(env, req["plotId"].(string))
 	}
-	panic("no such function")
+	return nil, cayonlib.NewError("NoSuchFunction", rpcInput.Function)
 }
 
 func main() {
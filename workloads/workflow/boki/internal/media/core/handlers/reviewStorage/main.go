@@ -9,21 +9,26 @@ import (
 	"cs.utexas.edu/zjia/faas"
 )
 
-func Handler(env *cayonlib.Env) interface{} {
+func Handler(env *cayonlib.Env) (interface{}, error) {
 	var rpcInput core.RPCInput
-	cayonlib.CHECK(mapstructure.Decode(env.Input, &rpcInput))
+	if err := mapstructure.Decode(env.Input, &rpcInput); err != nil {
+		return nil, err
+	}
 	switch rpcInput.Function {
 	case "StoreReview":
 		var review core.Review
-		cayonlib.CHECK(mapstructure.Decode(rpcInput.Input, &review))
-		core.StoreReview(env, review)
-		return 0
+		if err := mapstructure.Decode(rpcInput.Input, &review); err != nil {
+			return nil, err
+		}
+		return 0, core.StoreReview(env, review)
 	case "ReadReviews":
 		var reviewIds []string
-		cayonlib.CHECK(mapstructure.Decode(rpcInput.Input, &reviewIds))
+		if err := mapstructure.Decode(rpcInput.Input, &reviewIds); err != nil {
+			return nil, err
+		}
 		return core.ReadReviews(env, reviewIds)
 	}
-	panic("no such function")
+	return nil, cayonlib.NewError("NoSuchFunction", rpcInput.Function)
 }
 
 func main() {
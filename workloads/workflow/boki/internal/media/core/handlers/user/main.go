@@ -9,22 +9,22 @@ import (
 	"cs.utexas.edu/zjia/faas"
 )
 
-func Handler(env *cayonlib.Env) interface{} {
+func Handler(env *cayonlib.Env) (interface{}, error) {
 	var rpcInput core.RPCInput
-	cayonlib.CHECK(mapstructure.Decode(env.Input, &rpcInput))
+	if err := mapstructure.Decode(env.Input, &rpcInput); err != nil {
+		return nil, err
+	}
 	req := rpcInput.Input.(map[string]interface{})
 	switch rpcInput.Function {
 	case "RegisterUser":
-		core.RegisterUser(env, req["firstName"].(string), req["lastName"].(string),
+		return 0, core.RegisterUser(env, req["firstName"].(string), req["lastName"].(string),
 			req["username"].(string), req["password"].(string))
-		return 0
 	case "Login":
 		return core.Login(env, req["username"].(string), req["password"].(string))
 	case "UploadUser":
-		core.UploadUser(env, req["reqId"].(string), req["username"].(string))
-		return 0
+		return 0, core.UploadUser(env, req["reqId"].(string), req["username"].(string))
 	}
-	panic("no such function")
+	return nil, cayonlib.NewError("NoSuchFunction", rpcInput.Function)
 }
 
 func main() {
@@ -9,19 +9,20 @@ import (
 	"cs.utexas.edu/zjia/faas"
 )
 
-func Handler(env *cayonlib.Env) interface{} {
+func Handler(env *cayonlib.Env) (interface{}, error) {
 	var rpcInput core.RPCInput
-	cayonlib.CHECK(mapstructure.Decode(env.Input, &rpcInput))
+	if err := mapstructure.Decode(env.Input, &rpcInput); err != nil {
+		return nil, err
+	}
 	req := rpcInput.Input.(map[string]interface{})
 	switch rpcInput.Function {
 	case "UploadUserReview":
-		core.UploadUserReview(env, req["userId"].(string),
+		return 0, core.UploadUserReview(env, req["userId"].(string),
 			req["reviewId"].(string), req["timestamp"].(string))
-		return 0
 	case "ReadUserReviews":
 		return core.ReadUserReviews(env, req["userId"].(string))
 	}
-	panic("no such function")
+	return nil, cayonlib.NewError("NoSuchFunction", rpcInput.Function)
 }
 
 func main() {
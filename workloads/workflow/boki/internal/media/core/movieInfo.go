@@ -6,26 +6,34 @@ import (
 	"github.com/mitchellh/mapstructure"
 )
 
-func WriteMovieInfo(env *cayonlib.Env, info MovieInfo) {
-	cayonlib.Write(env, TMovieInfo(), info.MovieId, map[expression.NameBuilder]expression.OperandBuilder{
+func WriteMovieInfo(env *cayonlib.Env, info MovieInfo) error {
+	return cayonlib.Write(env, TMovieInfo(), info.MovieId, map[expression.NameBuilder]expression.OperandBuilder{
 		expression.Name("V"): expression.Value(info),
 	})
 }
 
-func ReadMovieInfo(env *cayonlib.Env, movieId string) MovieInfo {
+func ReadMovieInfo(env *cayonlib.Env, movieId string) (MovieInfo, error) {
 	var movieInfo MovieInfo
-	item := cayonlib.Read(env, TMovieId(), movieId)
-	cayonlib.CHECK(mapstructure.Decode(item, &movieInfo))
-	return movieInfo
+	item, err := cayonlib.Read(env, TMovieId(), movieId)
+	if err != nil {
+		return movieInfo, err
+	}
+	err = mapstructure.Decode(item, &movieInfo)
+	return movieInfo, err
 }
 
-func UpdateRating(env *cayonlib.Env, movieId string, sumUncommittedRating int32, numUncommittedRating int32) {
+func UpdateRating(env *cayonlib.Env, movieId string, sumUncommittedRating int32, numUncommittedRating int32) error {
 	var movieInfo MovieInfo
-	item := cayonlib.Read(env, TMovieId(), movieId)
-	cayonlib.CHECK(mapstructure.Decode(item, &movieInfo))
+	item, err := cayonlib.Read(env, TMovieId(), movieId)
+	if err != nil {
+		return err
+	}
+	if err := mapstructure.Decode(item, &movieInfo); err != nil {
+		return err
+	}
 	movieInfo.AvgRating = (movieInfo.AvgRating*float64(movieInfo.NumRating) + float64(sumUncommittedRating)) / float64(movieInfo.NumRating+numUncommittedRating)
 	movieInfo.NumRating += numUncommittedRating
-	cayonlib.Write(env, TMovieId(), movieId, map[expression.NameBuilder]expression.OperandBuilder{
+	return cayonlib.Write(env, TMovieId(), movieId, map[expression.NameBuilder]expression.OperandBuilder{
 		expression.Name("V"): expression.Value(movieInfo),
 	})
 }
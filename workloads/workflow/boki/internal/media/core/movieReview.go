@@ -4,40 +4,39 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
 	"github.com/eniac/Beldi/pkg/cayonlib"
-	"github.com/mitchellh/mapstructure"
+	"github.com/eniac/Beldi/pkg/cayonlib/typed"
 )
 
-func UploadMovieReview(env *cayonlib.Env, movieId string, reviewId string, timestamp string) {
+func UploadMovieReview(env *cayonlib.Env, movieId string, reviewId string, timestamp string) error {
 	reviewInfo := ReviewInfo{ReviewId: reviewId, Timestamp: timestamp}
-	item := cayonlib.Read(env, TMovieReview(), movieId)
+	item, err := cayonlib.Read(env, TMovieReview(), movieId)
+	if err != nil {
+		return err
+	}
 	if item == nil {
-		cayonlib.Write(env, TMovieReview(), movieId, map[expression.NameBuilder]expression.OperandBuilder{
+		return cayonlib.Write(env, TMovieReview(), movieId, map[expression.NameBuilder]expression.OperandBuilder{
 			expression.Name("V"): expression.Value(aws.JSONValue{"reviews": []ReviewInfo{reviewInfo}}),
 		})
 	} else {
-		cayonlib.Write(env, TMovieReview(), movieId, map[expression.NameBuilder]expression.OperandBuilder{
+		return cayonlib.Write(env, TMovieReview(), movieId, map[expression.NameBuilder]expression.OperandBuilder{
 			//expression.Name("V.reviews"): expression.Name("V.reviews").ListAppend(expression.Value([]ReviewInfo{reviewInfo})),
 			expression.Name("V.reviews"): expression.Name("V.reviews"),
 		})
 	}
 }
 
-func ReadMovieReviews(env *cayonlib.Env, movieId string) []Review {
-	item := cayonlib.Read(env, TMovieReview(), movieId)
-	if item == nil {
-		return []Review{}
+func ReadMovieReviews(env *cayonlib.Env, movieId string) ([]Review, error) {
+	item, exists, err := typed.Read[ReviewList](env, TMovieReview(), movieId)
+	if err != nil || !exists {
+		return []Review{}, err
 	}
-	var reviewInfos []ReviewInfo
-	cayonlib.CHECK(mapstructure.Decode(item.(map[string]interface{})["reviews"], &reviewInfos))
 	var reviewIds []string
-	for _, review := range reviewInfos {
+	for _, review := range item.Reviews {
 		reviewIds = append(reviewIds, review.ReviewId)
 	}
-	var res []Review
-	output, _ := cayonlib.SyncInvoke(env, TReviewStorage(), RPCInput{
+	res, _, err := typed.SyncInvoke[RPCInput, []Review](env, TReviewStorage(), RPCInput{
 		Function: "ReadReviews",
 		Input:    reviewIds,
 	})
-	cayonlib.CHECK(mapstructure.Decode(output, &res))
-	return res
+	return res, err
 }
@@ -6,13 +6,16 @@ import (
 	"github.com/eniac/Beldi/pkg/cayonlib"
 )
 
-func WritePlot(env *cayonlib.Env, plotId string, plot string) {
-	cayonlib.Write(env, TPlot(), plotId, map[expression.NameBuilder]expression.OperandBuilder{
+func WritePlot(env *cayonlib.Env, plotId string, plot string) error {
+	return cayonlib.Write(env, TPlot(), plotId, map[expression.NameBuilder]expression.OperandBuilder{
 		expression.Name("V"): expression.Value(aws.JSONValue{"plotId": plotId, "plot": plot}),
 	})
 }
 
-func ReadPlot(env *cayonlib.Env, plotId string) string {
-	item := cayonlib.Read(env, TPlot(), plotId)
-	return item.(map[string]interface{})["plot"].(string)
+func ReadPlot(env *cayonlib.Env, plotId string) (string, error) {
+	item, err := cayonlib.Read(env, TPlot(), plotId)
+	if err != nil {
+		return "", err
+	}
+	return item.(map[string]interface{})["plot"].(string), nil
 }
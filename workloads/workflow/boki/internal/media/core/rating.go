@@ -5,12 +5,13 @@ import (
 	"github.com/eniac/Beldi/pkg/cayonlib"
 )
 
-func UploadRating2(env *cayonlib.Env, reqId string, rating int32) {
-	cayonlib.AsyncInvoke(env, TComposeReview(), RPCInput{
+func UploadRating2(env *cayonlib.Env, reqId string, rating int32) error {
+	_, err := cayonlib.AsyncInvoke(env, TComposeReview(), RPCInput{
 		Function: "UploadRating",
 		Input: aws.JSONValue{
 			"reqId":  reqId,
 			"rating": rating,
 		},
 	})
+	return err
 }
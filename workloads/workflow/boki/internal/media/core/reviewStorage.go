@@ -3,22 +3,23 @@ package core
 import (
 	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
 	"github.com/eniac/Beldi/pkg/cayonlib"
-	"github.com/mitchellh/mapstructure"
+	"github.com/eniac/Beldi/pkg/cayonlib/typed"
 )
 
-func StoreReview(env *cayonlib.Env, review Review) {
-	cayonlib.Write(env, TReviewStorage(), review.ReviewId, map[expression.NameBuilder]expression.OperandBuilder{
+func StoreReview(env *cayonlib.Env, review Review) error {
+	return cayonlib.Write(env, TReviewStorage(), review.ReviewId, map[expression.NameBuilder]expression.OperandBuilder{
 		expression.Name("V"): expression.Value(review),
 	})
 }
 
-func ReadReviews(env *cayonlib.Env, ids []string) []Review {
+func ReadReviews(env *cayonlib.Env, ids []string) ([]Review, error) {
 	var reviews []Review
 	for _, id := range ids {
-		var review Review
-		res := cayonlib.Read(env, TReviewStorage(), id)
-		cayonlib.CHECK(mapstructure.Decode(res, &review))
+		review, _, err := typed.Read[Review](env, TReviewStorage(), id)
+		if err != nil {
+			return nil, err
+		}
 		reviews = append(reviews, review)
 	}
-	return reviews
+	return reviews, nil
 }
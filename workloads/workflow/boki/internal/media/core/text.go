@@ -5,9 +5,10 @@ import (
 	"github.com/eniac/Beldi/pkg/cayonlib"
 )
 
-func UploadText2(env *cayonlib.Env, reqId string, text string) {
-	cayonlib.AsyncInvoke(env, TComposeReview(), RPCInput{
+func UploadText2(env *cayonlib.Env, reqId string, text string) error {
+	_, err := cayonlib.AsyncInvoke(env, TComposeReview(), RPCInput{
 		Function: "UploadText",
 		Input:    aws.JSONValue{"reqId": reqId, "text": text},
 	})
+	return err
 }
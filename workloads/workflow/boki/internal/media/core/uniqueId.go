@@ -6,10 +6,11 @@ import (
 	"github.com/lithammer/shortuuid"
 )
 
-func UploadUniqueId2(env *cayonlib.Env, reqId string) {
+func UploadUniqueId2(env *cayonlib.Env, reqId string) error {
 	reviewId := shortuuid.New()
-	cayonlib.AsyncInvoke(env, TComposeReview(), RPCInput{
+	_, err := cayonlib.AsyncInvoke(env, TComposeReview(), RPCInput{
 		Function: "UploadUniqueId",
 		Input:    aws.JSONValue{"reqId": reqId, "reviewId": reviewId},
 	})
+	return err
 }
@@ -7,13 +7,13 @@ import (
 	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
 	"github.com/dgrijalva/jwt-go"
 	"github.com/eniac/Beldi/pkg/cayonlib"
+	"github.com/eniac/Beldi/pkg/cayonlib/typed"
 	"github.com/lithammer/shortuuid"
-	"github.com/mitchellh/mapstructure"
 	"time"
 )
 
 func RegisterUserWithUserId(env *cayonlib.Env, firstName string, lastName string, username string, password string,
-	userId string) {
+	userId string) error {
 	hasher := sha512.New()
 	salt := shortuuid.New()
 	hasher.Write([]byte(password + salt))
@@ -26,19 +26,20 @@ func RegisterUserWithUserId(env *cayonlib.Env, firstName string, lastName string
 		Password:  passwordHash,
 		Salt:      salt,
 	}
-	cayonlib.Write(env, TUser(), username, map[expression.NameBuilder]expression.OperandBuilder{
+	return cayonlib.Write(env, TUser(), username, map[expression.NameBuilder]expression.OperandBuilder{
 		expression.Name("V"): expression.Value(user),
 	})
 }
 
-func RegisterUser(env *cayonlib.Env, firstName string, lastName string, username string, password string) {
-	RegisterUserWithUserId(env, firstName, lastName, username, password, shortuuid.New())
+func RegisterUser(env *cayonlib.Env, firstName string, lastName string, username string, password string) error {
+	return RegisterUserWithUserId(env, firstName, lastName, username, password, shortuuid.New())
 }
 
-func Login(env *cayonlib.Env, username string, password string) string {
-	item := cayonlib.Read(env, TUser(), username)
-	var user User
-	cayonlib.CHECK(mapstructure.Decode(item, &user))
+func Login(env *cayonlib.Env, username string, password string) (string, error) {
+	user, _, err := typed.Read[User](env, TUser(), username)
+	if err != nil {
+		return "", err
+	}
 	hasher := sha512.New()
 	hasher.Write([]byte(password + user.Salt))
 	passwordHash := hex.EncodeToString(hasher.Sum(nil))
@@ -48,23 +49,23 @@ func Login(env *cayonlib.Env, username string, password string) string {
 			"timestamp": time.Now().Format("20060102150405"),
 			"TTL":       "60000",
 		})
-		tokenString, err := token.SignedString("secret")
-		cayonlib.CHECK(err)
-		return tokenString
+		return token.SignedString("secret")
 	} else {
-		panic("Password not correct")
+		return "", cayonlib.NewError("Unauthorized", "Password not correct")
 	}
 }
 
-func UploadUser(env *cayonlib.Env, reqId string, username string) {
-	item := cayonlib.Read(env, TUser(), username)
-	var user User
-	cayonlib.CHECK(mapstructure.Decode(item, &user))
-	cayonlib.AsyncInvoke(env, TComposeReview(), RPCInput{
+func UploadUser(env *cayonlib.Env, reqId string, username string) error {
+	user, _, err := typed.Read[User](env, TUser(), username)
+	if err != nil {
+		return err
+	}
+	_, err = cayonlib.AsyncInvoke(env, TComposeReview(), RPCInput{
 		Function: "UploadUserId",
 		Input: aws.JSONValue{
 			"reqId":  reqId,
 			"userId": user.UserId,
 		},
 	})
+	return err
 }
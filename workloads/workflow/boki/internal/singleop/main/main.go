@@ -13,7 +13,7 @@ import (
 
 var TXN = "DISABLE"
 
-func Handler(env *cayonlib.Env) interface{} {
+func Handler(env *cayonlib.Env) (interface{}, error) {
 	results := map[string]int64{}
 
 	if TXN == "ENABLE" {
@@ -22,37 +22,47 @@ func Handler(env *cayonlib.Env) interface{} {
 	if cayonlib.TYPE == "BELDI" {
 		a := shortuuid.New()
 		start := time.Now()
-		cayonlib.Write(env, "singleop", "K", map[expression.NameBuilder]expression.OperandBuilder{
+		if err := cayonlib.Write(env, "singleop", "K", map[expression.NameBuilder]expression.OperandBuilder{
 			expression.Name("V"): expression.Value(a),
-		})
+		}); err != nil {
+			return nil, err
+		}
 		results["latencyDWrite"] = time.Since(start).Microseconds()
 		// fmt.Printf("DURATION DWrite %s\n", time.Since(start))
 
 		start = time.Now()
-		cayonlib.CondWrite(env, "singleop", "K", map[expression.NameBuilder]expression.OperandBuilder{
+		if err := cayonlib.CondWrite(env, "singleop", "K", map[expression.NameBuilder]expression.OperandBuilder{
 			expression.Name("V2"): expression.Value(1),
-		}, expression.Name("V").Equal(expression.Value(a)))
+		}, expression.Name("V").Equal(expression.Value(a))); err != nil {
+			return nil, err
+		}
 		results["latencyCWriteT"] = time.Since(start).Microseconds()
 		// fmt.Printf("DURATION CWriteT %s\n", time.Since(start))
 
 		start = time.Now()
-		cayonlib.CondWrite(env, "singleop", "K", map[expression.NameBuilder]expression.OperandBuilder{
+		if err := cayonlib.CondWrite(env, "singleop", "K", map[expression.NameBuilder]expression.OperandBuilder{
 			expression.Name("V2"): expression.Value(a),
-		}, expression.Name("V").Equal(expression.Value(2)))
+		}, expression.Name("V").Equal(expression.Value(2))); err != nil {
+			return nil, err
+		}
 		results["latencyCWriteF"] = time.Since(start).Microseconds()
 		// fmt.Printf("DURATION CWriteF %s\n", time.Since(start))
 
 		start = time.Now()
-		cayonlib.Read(env, "singleop", "K")
+		if _, err := cayonlib.Read(env, "singleop", "K"); err != nil {
+			return nil, err
+		}
 		results["latencyRead"] = time.Since(start).Microseconds()
 		// fmt.Printf("DURATION Read %s\n", time.Since(start))
 
 		start = time.Now()
-		cayonlib.SyncInvoke(env, "nop", "")
+		if _, _, err := cayonlib.SyncInvoke(env, "nop", ""); err != nil {
+			return nil, err
+		}
 		results["latencyCall"] = time.Since(start).Microseconds()
 		// fmt.Printf("DURATION Call %s\n", time.Since(start))
 	}
-	return results
+	return results, nil
 }
 
 func main() {
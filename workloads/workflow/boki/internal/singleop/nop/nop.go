@@ -7,8 +7,8 @@ import (
 	"cs.utexas.edu/zjia/faas"
 )
 
-func Handler(env *cayonlib.Env) interface{} {
-	return 0
+func Handler(env *cayonlib.Env) (interface{}, error) {
+	return 0, nil
 }
 
 func main() {
@@ -0,0 +1,105 @@
+package cayonlib
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"cs.utexas.edu/zjia/faas/types"
+)
+
+// RestartAll re-invokes asynchronous and client-invoked instances of lambdaId
+// that have not finished T seconds after they (re-)started, e.g. because
+// their function crashed or failed with a StepError. They run again with the
+// same InstanceId and input, so IntentFsm replays their finished steps.
+// Client-invoked instances run again asynchronously, as nobody waits for
+// them anymore. Synchronous callees are left to their callers, which
+// re-invoke them when replayed themselves. Sleeping instances are left to
+// the timer service, which wakes them up once their timer fires. It returns
+// the number of restarted instances.
+func RestartAll(env *Env, lambdaId string) int {
+	intents, _ := scanIntents(env)
+	pending, _ := pendingTimers(getTimerLogs(env))
+	sleeping := make(map[string]bool)
+	for _, timerLog := range pending {
+		sleeping[timerLog.InstanceId] = true
+	}
+	deadline := time.Now().Unix() - T
+	restarted := 0
+	for _, intent := range intents {
+		if intent.Done || intent.LambdaId != lambdaId || intent.StartTime >= deadline {
+			continue
+		}
+		if !intent.Async && intent.CallerName != "" {
+			continue
+		}
+		if sleeping[intent.InstanceId] {
+			continue
+		}
+		log.Printf("[INFO] Restart instance %s of %s", intent.InstanceId, lambdaId)
+		restartInstance(env, intent)
+		restarted++
+	}
+	return restarted
+}
+
+// restartInstance invokes intent.LambdaId again with the input of intent,
+// without waiting for it. Client-invoked instances have no caller to report to.
+// Callees keep the TxnTs of their transaction, which orders their locks under
+// wait-die and wound-wait.
+func restartInstance(env *Env, intent *intentRecord) {
+	iw := InputWrapper{
+		CallerName: intent.CallerName,
+		CallerId:   intent.CallerId,
+		CallerStep: intent.CallerStep,
+		InstanceId: intent.InstanceId,
+		Input:      intent.Input,
+		TxnId:      intent.TxnId,
+		TxnTs:      intent.TxnTs,
+		TxnMode:    intent.TxnMode,
+		Async:      true,
+	}
+	err := env.FaasEnv.InvokeFuncAsync(env.FaasCtx, intent.LambdaId, iw.Serialize())
+	checkStep(err)
+}
+
+type collectorHandler struct {
+	env       types.Environment
+	lambdaIds []string
+}
+
+// Call runs RestartAll for every lambdaId, ignoring its input
+func (h *collectorHandler) Call(ctx context.Context, input []byte) (output []byte, err error) {
+	defer recoverStep(&err)
+	env := &Env{
+		LambdaId: "collector",
+		FaasCtx:  ctx,
+		FaasEnv:  h.env,
+	}
+	results := make(map[string]int)
+	for _, lambdaId := range h.lambdaIds {
+		results[lambdaId] = RestartAll(env, lambdaId)
+	}
+	return json.Marshal(results)
+}
+
+type collectorHandlerFactory struct {
+	lambdaIds []string
+}
+
+func (f *collectorHandlerFactory) New(env types.Environment, funcName string) (types.FuncHandler, error) {
+	return &collectorHandler{env: env, lambdaIds: f.lambdaIds}, nil
+}
+
+func (f *collectorHandlerFactory) GrpcNew(env types.Environment, service string) (types.GrpcFuncHandler, error) {
+	return nil, fmt.Errorf("Not implemented")
+}
+
+// CreateCollectorHandlerFactory serves a function that restarts unfinished
+// instances of lambdaIds on every call. Like the GC function, it appends no
+// intent records, and is meant to be invoked periodically.
+func CreateCollectorHandlerFactory(lambdaIds ...string) types.FuncHandlerFactory {
+	return &collectorHandlerFactory{lambdaIds: lambdaIds}
+}
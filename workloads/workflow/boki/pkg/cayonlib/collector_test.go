@@ -0,0 +1,97 @@
+package cayonlib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func appendCalleeStart(env *Env, instanceId string, async bool, txnTs int64, start int64) {
+	LibAppendLog(env, IntentLogTag, aws.JSONValue{
+		"InstanceId": instanceId,
+		"LambdaId":   "hotel",
+		"TxnId":      "txn",
+		"TxnTs":      txnTs,
+		"TxnMode":    TxnMode2PL,
+		"CallerName": "frontend",
+		"CallerId":   "caller",
+		"CallerStep": 3,
+		"DONE":       false,
+		"ASYNC":      async,
+		"INPUT":      instanceId,
+		"ST":         start,
+	})
+}
+
+func TestRestartAll(t *testing.T) {
+	fake := newFakeEnv()
+	env := newTestEnv(fake)
+	old := time.Now().Unix() - 2*T
+	recent := time.Now().Unix()
+
+	appendCalleeStart(env, "async", true, 42, old)
+	appendIntent(env, "client", "hotel", "", old)
+	appendCalleeStart(env, "sync", false, 42, old)
+	appendCalleeStart(env, "recent", true, 42, recent)
+	appendIntent(env, "finished", "hotel", "", old)
+	appendDone(env, "finished", "", old)
+	appendIntent(env, "other", "flight", "", old)
+	// Re-executed recently, so it is not restarted yet
+	appendIntent(env, "restarted", "hotel", "", old)
+	appendIntent(env, "restarted", "hotel", "", recent)
+	// Left to the timer service while its timer is pending
+	appendIntent(env, "sleeping", "hotel", "", old)
+	appendTimer(env, "sleeping", 1, nowMillis()+60000, false)
+	appendIntent(env, "woken", "hotel", "", old)
+	appendTimer(env, "woken", 1, nowMillis()-1000, false)
+	appendTimer(env, "woken", 1, nowMillis()-1000, true)
+
+	if restarted := RestartAll(env, "hotel"); restarted != 3 {
+		t.Errorf("RestartAll restarted %d instances, want 3", restarted)
+	}
+	restarts := make(map[string]InputWrapper)
+	for i, input := range fake.inputs {
+		if fake.invoked[i] != "hotel" {
+			t.Errorf("RestartAll invoked %s", fake.invoked[i])
+		}
+		var iw InputWrapper
+		iw.Deserialize(input)
+		restarts[iw.InstanceId] = iw
+	}
+
+	async, ok := restarts["async"]
+	if !ok {
+		t.Fatal("async callee was not restarted")
+	}
+	want := InputWrapper{
+		CallerName: "frontend",
+		CallerId:   "caller",
+		CallerStep: 3,
+		InstanceId: "async",
+		Input:      "async",
+		TxnId:      "txn",
+		TxnTs:      42,
+		TxnMode:    TxnMode2PL,
+		Async:      true,
+	}
+	if async != want {
+		t.Errorf("async callee restarted with %+v, want %+v", async, want)
+	}
+
+	client, ok := restarts["client"]
+	if !ok {
+		t.Fatal("client-invoked instance was not restarted")
+	}
+	if client.CallerName != "" || !client.Async {
+		t.Errorf("client-invoked instance restarted with %+v, want no caller and async", client)
+	}
+	if _, ok := restarts["woken"]; !ok {
+		t.Error("instance woken up was not restarted")
+	}
+	for _, instanceId := range []string{"sync", "recent", "finished", "other", "restarted", "sleeping"} {
+		if _, ok := restarts[instanceId]; ok {
+			t.Errorf("%s was restarted", instanceId)
+		}
+	}
+}
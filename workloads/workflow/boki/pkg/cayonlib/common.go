@@ -22,4 +22,12 @@ func CHECK(err error) {
 	}
 }
 
+// checkStep is CHECK for calls to the shared log, DynamoDB or other
+// functions, whose errors are step errors
+func checkStep(err error) {
+	if err != nil {
+		panic(&StepError{Err: err})
+	}
+}
+
 var kTablePrefix = os.Getenv("TABLE_PREFIX")
@@ -27,8 +27,11 @@ type InputWrapper struct {
 	InstanceId  string      `mapstructure:"InstanceId"`
 	Input       interface{} `mapstructure:"Input"`
 	TxnId       string      `mapstructure:"TxnId"`
+	TxnTs       int64       `mapstructure:"TxnTs"`
+	TxnMode     string      `mapstructure:"TxnMode"`
 	Instruction string      `mapstructure:"Instruction"`
 	Async       bool        `mapstructure:"Async"`
+	Poll        bool        `mapstructure:"Poll"`
 }
 
 func (iw *InputWrapper) Serialize() []byte {
@@ -62,9 +65,58 @@ type InvokeError struct {
 	StackTrace   []StackTraceCall `json:"stackTrace"`
 }
 
+func (ie InvokeError) Error() string {
+	return fmt.Sprintf("%s: %s", ie.ErrorType, ie.ErrorMessage)
+}
+
+// OutputWrapper has Status "Success" with the output of the handler,
+// "Failure" with the type and message of its error, or "Sleeping" with the
+// InstanceId of an instance nobody waits on that went to sleep. Its output is
+// not delivered anywhere once it wakes up: clients invoke the function again
+// with that InstanceId and Poll set in their InputWrapper, which replays the
+// instance and returns its output, or "Sleeping" again while the timer is
+// pending. GC trims the steps of finished instances after T seconds, so
+// clients must poll within T seconds of the wake-up. Polls of an instance
+// without steps, e.g. because GC trimmed them, fail with an InstanceNotFound
+// error instead of running the instance again from scratch.
 type OutputWrapper struct {
-	Status string
-	Output interface{}
+	Status       string
+	Output       interface{}
+	ErrorType    string `json:",omitempty"`
+	ErrorMessage string `json:",omitempty"`
+	InstanceId   string `json:",omitempty"`
+}
+
+// errorFields returns the type and message reported for err
+func errorFields(err error) (string, string) {
+	var appErr *Error
+	if IsStepError(err) {
+		return kStepErrorType, err.Error()
+	} else if errors.As(err, &appErr) {
+		return appErr.Type, appErr.Message
+	} else {
+		return kApplicationErrorType, err.Error()
+	}
+}
+
+func failureOutput(err error) OutputWrapper {
+	errType, message := errorFields(err)
+	return OutputWrapper{
+		Status:       "Failure",
+		Output:       nil,
+		ErrorType:    errType,
+		ErrorMessage: message,
+	}
+}
+
+// outputError returns the error of a failed callee. Step errors of the callee
+// are step errors of the caller too, so that it runs the callee again.
+func outputError(ow *OutputWrapper) error {
+	err := NewError(ow.ErrorType, ow.ErrorMessage)
+	if ow.ErrorType == kStepErrorType {
+		return &StepError{Err: err}
+	}
+	return err
 }
 
 func (ow *OutputWrapper) Serialize() []byte {
@@ -76,10 +128,10 @@ func (ow *OutputWrapper) Serialize() []byte {
 func (ow *OutputWrapper) Deserialize(stream []byte) {
 	err := json.Unmarshal(stream, ow)
 	CHECK(err)
-	if ow.Status != "Success" && ow.Status != "Failure" {
+	if ow.Status != "Success" && ow.Status != "Failure" && ow.Status != "Sleeping" {
 		ie := InvokeError{}
 		ie.Deserialize(stream)
-		panic(ie)
+		panic(&StepError{Err: ie})
 	}
 }
 
@@ -105,18 +157,33 @@ func PrepareEnv(iw *InputWrapper, lambdaId string) *Env {
 		StepNumber:  0,
 		Input:       iw.Input,
 		TxnId:       iw.TxnId,
+		TxnTs:       iw.TxnTs,
+		TxnMode:     iw.TxnMode,
 		Instruction: iw.Instruction,
+		Detached:    iw.Async || iw.CallerName == "",
+	}
+}
+
+// invokeResult returns the output or the error of a callee logged as the
+// result of a PreInvoke step
+func invokeResult(resultLog *IntentLogEntry) (interface{}, error) {
+	if errData, ok := resultLog.Data["error"].(map[string]interface{}); ok {
+		errType, _ := errData["type"].(string)
+		message, _ := errData["message"].(string)
+		return nil, NewError(errType, message)
 	}
+	return resultLog.Data["output"], nil
 }
 
-func SyncInvoke(env *Env, callee string, input interface{}) (interface{}, string) {
+func SyncInvoke(env *Env, callee string, input interface{}) (output interface{}, instanceId string, err error) {
+	defer recoverStep(&err)
 	newLog, preInvokeLog := ProposeNextStep(env, aws.JSONValue{
 		"type":       "PreInvoke",
 		"instanceId": shortuuid.New(),
 		"callee":     callee,
 		"input":      input,
 	})
-	instanceId := preInvokeLog.Data["instanceId"].(string)
+	instanceId = preInvokeLog.Data["instanceId"].(string)
 	if !newLog {
 		CheckLogDataField(preInvokeLog, "type", "PreInvoke")
 		log.Printf("[INFO] Seen PreInvoke log for step %d", preInvokeLog.StepNumber)
@@ -124,18 +191,28 @@ func SyncInvoke(env *Env, callee string, input interface{}) (interface{}, string
 		if resultLog != nil {
 			CheckLogDataField(resultLog, "type", "InvokeResult")
 			log.Printf("[INFO] Seen InvokeResult log for step %d", preInvokeLog.StepNumber)
-			return resultLog.Data["output"], instanceId
+			output, err = invokeResult(resultLog)
+			return output, instanceId, err
 		}
 	}
 
+	output, err = invokeFunc(env, callee, input, preInvokeLog.StepNumber, instanceId)
+	return output, instanceId, err
+}
+
+// prepareInvoke builds the input of a synchronous invocation for the step
+// preInvokeStep, and records callee in the transaction of env if any
+func prepareInvoke(env *Env, callee string, input interface{}, preInvokeStep int32, instanceId string) []byte {
 	iw := InputWrapper{
 		CallerName:  env.LambdaId,
 		CallerId:    env.InstanceId,
-		CallerStep:  preInvokeLog.StepNumber,
+		CallerStep:  preInvokeStep,
 		Async:       false,
 		InstanceId:  instanceId,
 		Input:       input,
 		TxnId:       env.TxnId,
+		TxnTs:       env.TxnTs,
+		TxnMode:     env.TxnMode,
 		Instruction: env.Instruction,
 	}
 	if iw.Instruction == "EXECUTE" {
@@ -146,20 +223,40 @@ func SyncInvoke(env *Env, callee string, input interface{}) (interface{}, string
 			WriteOp:  aws.JSONValue{},
 		})
 	}
-	payload := iw.Serialize()
+	return iw.Serialize()
+}
+
+// callFunc invokes callee with a payload from prepareInvoke, and returns its
+// output or its error
+func callFunc(env *Env, callee string, payload []byte) (output interface{}, err error) {
+	defer recoverStep(&err)
 	res, err := env.FaasEnv.InvokeFunc(env.FaasCtx, callee, payload)
-	CHECK(err)
+	if err != nil {
+		return nil, &StepError{Err: err}
+	}
 	ow := OutputWrapper{}
 	ow.Deserialize(res)
 	switch ow.Status {
 	case "Success":
-		return ow.Output, iw.InstanceId
+		return ow.Output, nil
+	case "Failure":
+		return nil, outputError(&ow)
+	case "Sleeping":
+		// Synchronous callees sleep in place, so this is a callee invoked with
+		// the InstanceId of a detached one. It is invoked again on replay.
+		return nil, &StepError{Err: fmt.Errorf("Instance %s of %s is sleeping", ow.InstanceId, callee)}
 	default:
 		panic("never happens")
 	}
 }
 
-func ProposeInvoke(env *Env, callee string) *IntentLogEntry {
+func invokeFunc(env *Env, callee string, input interface{}, preInvokeStep int32, instanceId string) (interface{}, error) {
+	payload := prepareInvoke(env, callee, input, preInvokeStep, instanceId)
+	return callFunc(env, callee, payload)
+}
+
+func ProposeInvoke(env *Env, callee string) (preInvokeLog *IntentLogEntry, err error) {
+	defer recoverStep(&err)
 	newLog, preInvokeLog := ProposeNextStep(env, aws.JSONValue{
 		"type":       "PreInvoke",
 		"instanceId": shortuuid.New(),
@@ -170,61 +267,39 @@ func ProposeInvoke(env *Env, callee string) *IntentLogEntry {
 		CheckLogDataField(preInvokeLog, "callee", callee)
 		log.Printf("[INFO] Seen PreInvoke log for step %d", preInvokeLog.StepNumber)
 	}
-	return preInvokeLog
+	return preInvokeLog, nil
 }
 
-func AssignedSyncInvoke(env *Env, callee string, input interface{}, preInvokeLog *IntentLogEntry) (interface{}, string) {
+func AssignedSyncInvoke(env *Env, callee string, input interface{}, preInvokeLog *IntentLogEntry) (output interface{}, instanceId string, err error) {
+	defer recoverStep(&err)
 	CheckLogDataField(preInvokeLog, "type", "PreInvoke")
 	CheckLogDataField(preInvokeLog, "callee", callee)
 
-	instanceId := preInvokeLog.Data["instanceId"].(string)
+	instanceId = preInvokeLog.Data["instanceId"].(string)
 
 	resultLog := FetchStepResultLog(env, preInvokeLog.StepNumber, /* catch= */ false)
 	if resultLog != nil {
 		CheckLogDataField(resultLog, "type", "InvokeResult")
 		log.Printf("[INFO] Seen InvokeResult log for step %d", preInvokeLog.StepNumber)
-		return resultLog.Data["output"], instanceId
+		output, err = invokeResult(resultLog)
+		return output, instanceId, err
 	}
 
-	iw := InputWrapper{
-		CallerName:  env.LambdaId,
-		CallerId:    env.InstanceId,
-		CallerStep:  preInvokeLog.StepNumber,
-		Async:       false,
-		InstanceId:  instanceId,
-		Input:       input,
-		TxnId:       env.TxnId,
-		Instruction: env.Instruction,
-	}
-	if iw.Instruction == "EXECUTE" {
-		LibAppendLog(env, TransactionStreamTag(env.LambdaId, env.TxnId), &TxnLogEntry{
-			LambdaId: env.LambdaId,
-			TxnId:    env.TxnId,
-			Callee:   callee,
-			WriteOp:  aws.JSONValue{},
-		})
-	}
-	payload := iw.Serialize()
-	res, err := env.FaasEnv.InvokeFunc(env.FaasCtx, callee, payload)
-	CHECK(err)
-	ow := OutputWrapper{}
-	ow.Deserialize(res)
-	switch ow.Status {
-	case "Success":
-		return ow.Output, iw.InstanceId
-	default:
-		panic("never happens")
-	}
+	output, err = invokeFunc(env, callee, input, preInvokeLog.StepNumber, instanceId)
+	return output, instanceId, err
 }
 
-func AsyncInvoke(env *Env, callee string, input interface{}) string {
+// AsyncInvoke starts callee without waiting for it. Failures of the callee
+// are not reported to the caller.
+func AsyncInvoke(env *Env, callee string, input interface{}) (instanceId string, err error) {
+	defer recoverStep(&err)
 	newLog, preInvokeLog := ProposeNextStep(env, aws.JSONValue{
 		"type":       "PreInvoke",
 		"instanceId": shortuuid.New(),
 		"callee":     callee,
 		"input":      input,
 	})
-	instanceId := preInvokeLog.Data["instanceId"].(string)
+	instanceId = preInvokeLog.Data["instanceId"].(string)
 	if !newLog {
 		CheckLogDataField(preInvokeLog, "type", "PreInvoke")
 		log.Printf("[INFO] Seen PreInvoke log for step %d", preInvokeLog.StepNumber)
@@ -232,7 +307,7 @@ func AsyncInvoke(env *Env, callee string, input interface{}) string {
 		if resultLog != nil {
 			CheckLogDataField(resultLog, "type", "InvokeResult")
 			log.Printf("[INFO] Seen InvokeResult log for step %d", preInvokeLog.StepNumber)
-			return instanceId
+			return instanceId, nil
 		}
 	}
 
@@ -253,9 +328,9 @@ func AsyncInvoke(env *Env, callee string, input interface{}) string {
 */
 
 	payload := iw.Serialize()
-	err := env.FaasEnv.InvokeFuncAsync(env.FaasCtx, callee, payload)
-	CHECK(err)
-	return iw.InstanceId
+	err = env.FaasEnv.InvokeFuncAsync(env.FaasCtx, callee, payload)
+	checkStep(err)
+	return iw.InstanceId, nil
 }
 
 func getAllTxnLogs(env *Env) []*TxnLogEntry {
@@ -264,7 +339,7 @@ func getAllTxnLogs(env *Env) []*TxnLogEntry {
 	results := make([]*TxnLogEntry, 0)
 	for {
 		logEntry, err := env.FaasEnv.SharedLogReadNext(env.FaasCtx, tag, seqNum)
-		CHECK(err)
+		checkStep(err)
 		if logEntry == nil {
 			break
 		}
@@ -282,10 +357,37 @@ func getAllTxnLogs(env *Env) []*TxnLogEntry {
 	return results
 }
 
-func TPLCommit(env *Env) {
+// readOnlyOps returns the reads of keys that txnLogs do not write, whose
+// locks are released apart from the locks of writes
+func readOnlyOps(txnLogs []*TxnLogEntry) []aws.JSONValue {
+	written := make(map[string]bool)
+	for _, txnLog := range txnLogs {
+		if txnLog.Callee == "" && txnLog.ReadOp == nil {
+			written[fmt.Sprintf("%s-%s", txnLog.WriteOp["tablename"], txnLog.WriteOp["key"])] = true
+		}
+	}
+	readOps := make([]aws.JSONValue, 0)
+	for _, txnLog := range txnLogs {
+		if txnLog.ReadOp == nil {
+			continue
+		}
+		lockId := fmt.Sprintf("%s-%s", txnLog.ReadOp["tablename"], txnLog.ReadOp["key"])
+		if !written[lockId] {
+			written[lockId] = true
+			readOps = append(readOps, txnLog.ReadOp)
+		}
+	}
+	return readOps
+}
+
+// TPLCommit applies the writes of the transaction decided to commit, and
+// commits its callees. Once decided, the transaction must finish, so any
+// error is a step error, which leaves the instance to be run again.
+func TPLCommit(env *Env) (err error) {
+	defer recoverStep(&err)
 	txnLogs := getAllTxnLogs(env)
 	for _, txnLog := range txnLogs {
-		if txnLog.Callee != "" {
+		if txnLog.Callee != "" || txnLog.ReadOp != nil {
 			continue
 		}
 		tablename := txnLog.WriteOp["tablename"].(string)
@@ -294,51 +396,103 @@ func TPLCommit(env *Env) {
 		for kk, vv := range txnLog.WriteOp["value"].(map[string]interface{}) {
 			update[expression.Name(kk)] = expression.Value(vv)
 		}
-		Write(env, tablename, key, update)
-		Unlock(env, tablename, key)
+		CHECK(Write(env, tablename, key, update))
+		CHECK(Unlock(env, tablename, key))
+	}
+	for _, readOp := range readOnlyOps(txnLogs) {
+		CHECK(Unlock(env, readOp["tablename"].(string), readOp["key"].(string)))
 	}
 	for _, txnLog := range txnLogs {
 		if txnLog.Callee != "" {
 			log.Printf("[INFO] Commit transaction %s for callee %s", env.TxnId, txnLog.Callee)
-			SyncInvoke(env, txnLog.Callee, aws.JSONValue{})
+			_, _, err := SyncInvoke(env, txnLog.Callee, aws.JSONValue{})
+			CHECK(asStepError(err))
 		}
 	}
+	return nil
 }
 
-func TPLAbort(env *Env) {
+// TPLAbort releases the locks of the transaction decided to abort, and
+// aborts its callees. Like TPLCommit, it only fails with step errors.
+func TPLAbort(env *Env) (err error) {
+	defer recoverStep(&err)
 	txnLogs := getAllTxnLogs(env)
 	for _, txnLog := range txnLogs {
-		if txnLog.Callee != "" {
+		if txnLog.Callee != "" || txnLog.ReadOp != nil {
 			continue
 		}
 		tablename := txnLog.WriteOp["tablename"].(string)
 		key := txnLog.WriteOp["key"].(string)
-		Unlock(env, tablename, key)
+		CHECK(Unlock(env, tablename, key))
+	}
+	for _, readOp := range readOnlyOps(txnLogs) {
+		CHECK(Unlock(env, readOp["tablename"].(string), readOp["key"].(string)))
 	}
 	for _, txnLog := range txnLogs {
 		if txnLog.Callee != "" {
 			log.Printf("[INFO] Abort transaction %s for callee %s", env.TxnId, txnLog.Callee)
-			SyncInvoke(env, txnLog.Callee, aws.JSONValue{})
+			_, _, err := SyncInvoke(env, txnLog.Callee, aws.JSONValue{})
+			CHECK(asStepError(err))
 		}
 	}
+	return nil
 }
 
-func wrapperInternal(f func(*Env) interface{}, iw *InputWrapper, env *Env) (OutputWrapper, error) {
+func wrapperInternal(f func(*Env) (interface{}, error), iw *InputWrapper, env *Env) (ow OutputWrapper, err error) {
+	defer func() {
+		// Step errors outside the handler, e.g. when appending intent records,
+		// fail the instance like step errors returned by the handler
+		if r := recover(); r != nil {
+			recovered, ok := asError(r)
+			if !ok {
+				panic(r)
+			}
+			log.Printf("[WARN] Instance %s of %s failed: %v", env.InstanceId, env.LambdaId, recovered)
+			ow, err = failureOutput(recovered), nil
+		}
+	}()
+
 	if TYPE == "BASELINE" {
 		panic("Baseline type not supported")
 	}
 
+	env.Fsm.Catch(env)
+
+	// A sleeping instance logged at least its Sleep step
+	if iw.Poll && env.Fsm.GetStepLog(0) == nil {
+		return failureOutput(NewError("InstanceNotFound",
+			fmt.Sprintf("Instance %s of %s has no steps to replay", env.InstanceId, env.LambdaId))), nil
+	}
+
 	if iw.Async == false || iw.CallerName == "" {
+		// CallerName is empty for instances invoked by clients, which the
+		// collector restarts like async callees
 		LibAppendLog(env, IntentLogTag, aws.JSONValue{
 			"InstanceId": env.InstanceId,
+			"LambdaId": env.LambdaId,
+			"TxnId": env.TxnId,
+			"TxnTs": env.TxnTs,
+			"TxnMode": env.TxnMode,
+			"CallerName": iw.CallerName,
 			"DONE": false,
 			"ASYNC": iw.Async,
 			"INPUT": iw.Input,
 			"ST": time.Now().Unix(),
 		})
 	} else {
+		// Async callees keep their caller, so that the collector can restart
+		// them with the same InputWrapper
 		LibAppendLog(env, IntentLogTag, aws.JSONValue{
 			"InstanceId": env.InstanceId,
+			"LambdaId": env.LambdaId,
+			"TxnId": env.TxnId,
+			"TxnTs": env.TxnTs,
+			"TxnMode": env.TxnMode,
+			"ASYNC": true,
+			"INPUT": iw.Input,
+			"CallerName": iw.CallerName,
+			"CallerId": iw.CallerId,
+			"CallerStep": iw.CallerStep,
 			"ST": time.Now().Unix(),
 		})
 	}
@@ -356,28 +510,58 @@ func wrapperInternal(f func(*Env) interface{}, iw *InputWrapper, env *Env) (Outp
 	//}
 
 	var output interface{}
+	var handlerErr error
 	if env.Instruction == "COMMIT" {
-		TPLCommit(env)
+		handlerErr = TPLCommit(env)
 		output = 0
 	} else if env.Instruction == "ABORT" {
-		TPLAbort(env)
+		handlerErr = TPLAbort(env)
 		output = 0
 	} else {
-		output = f(env)
+		var asleep bool
+		output, handlerErr, asleep = runHandler(f, env)
+		if asleep {
+			return OutputWrapper{
+				Status:     "Sleeping",
+				Output:     nil,
+				InstanceId: env.InstanceId,
+			}, nil
+		}
 	}
 
+	// The instance is left unfinished, to be run again
+	if handlerErr != nil && IsStepError(handlerErr) {
+		log.Printf("[WARN] Instance %s of %s failed: %v", env.InstanceId, env.LambdaId, handlerErr)
+		return failureOutput(handlerErr), nil
+	}
+
+	result := aws.JSONValue{
+		"type":   "InvokeResult",
+		"output": output,
+	}
+	if handlerErr != nil {
+		errType, message := errorFields(handlerErr)
+		result["output"] = nil
+		result["error"] = aws.JSONValue{"type": errType, "message": message}
+	}
 	if iw.CallerName != "" {
-		LogStepResult(env, iw.CallerId, iw.CallerStep, aws.JSONValue{
-			"type":   "InvokeResult",
-			"output": output,
-		})
+		LogStepResult(env, iw.CallerId, iw.CallerStep, result)
 	}
-	LibAppendLog(env, IntentLogTag, aws.JSONValue{
+	done := aws.JSONValue{
 		"InstanceId": env.InstanceId,
 		"DONE":       true,
 		"TS":         time.Now().Unix(),
-	})
+	}
+	// The start record of an instance beginning its own transaction has no
+	// TxnId, so GC learns it from here
+	if env.OwnsTxn {
+		done["TxnId"] = env.InstanceId
+	}
+	LibAppendLog(env, IntentLogTag, done)
 
+	if handlerErr != nil {
+		return failureOutput(handlerErr), nil
+	}
 	return OutputWrapper{
 		Status: "Success",
 		Output: output,
@@ -386,7 +570,7 @@ func wrapperInternal(f func(*Env) interface{}, iw *InputWrapper, env *Env) (Outp
 
 type funcHandlerWrapper struct {
 	fnName  string
-	handler func(env *Env) interface{}
+	handler func(env *Env) (interface{}, error)
 	env     types.Environment
 }
 
@@ -401,7 +585,6 @@ func (w *funcHandlerWrapper) Call(ctx context.Context, input []byte) ([]byte, er
 	env.FaasCtx = ctx
 	env.FaasEnv = w.env
 	env.Fsm = NewIntentFsm(env.InstanceId)
-	env.Fsm.Catch(env)
 	ow, err := wrapperInternal(w.handler, iw, env)
 	if err != nil {
 		return nil, err
@@ -410,7 +593,7 @@ func (w *funcHandlerWrapper) Call(ctx context.Context, input []byte) ([]byte, er
 }
 
 type funcHandlerFactory struct {
-	handler func(env *Env) interface{}
+	handler func(env *Env) (interface{}, error)
 }
 
 func (f *funcHandlerFactory) New(env types.Environment, funcName string) (types.FuncHandler, error) {
@@ -425,6 +608,8 @@ func (f *funcHandlerFactory) GrpcNew(env types.Environment, service string) (typ
 	return nil, fmt.Errorf("Not implemented")
 }
 
-func CreateFuncHandlerFactory(f func(env *Env) interface{}) types.FuncHandlerFactory {
+// CreateFuncHandlerFactory serves f as a cayonlib function. An error returned
+// by f fails the invocation with a "Failure" status, see Error and StepError.
+func CreateFuncHandlerFactory(f func(env *Env) (interface{}, error)) types.FuncHandlerFactory {
 	return &funcHandlerFactory{handler: f}
 }
@@ -2,6 +2,7 @@ package cayonlib
 
 import (
 	"log"
+	"strconv"
 	// "fmt"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	// "github.com/mitchellh/mapstructure"
@@ -35,7 +36,7 @@ func LibRead(tablename string, key aws.JSONValue, projection []string) aws.JSONV
 			ConsistentRead:           aws.Bool(true),
 		})
 	}
-	CHECK(err)
+	checkStep(err)
 	item := aws.JSONValue{}
 	err = dynamodbattribute.UnmarshalMap(res.Item, &item)
 	CHECK(err)
@@ -63,7 +64,7 @@ func LibWrite(tablename string, key aws.JSONValue,
 		ExpressionAttributeValues: expr.Values(),
 		UpdateExpression:          expr.Update(),
 	})
-	CHECK(err)
+	checkStep(err)
 }
 
 func LibScanWithLast(tablename string, projection []string, last map[string]*dynamodb.AttributeValue) []aws.JSONValue {
@@ -118,7 +119,7 @@ func LibScanWithLast(tablename string, projection []string, last map[string]*dyn
 			})
 		}
 	}
-	CHECK(err)
+	checkStep(err)
 	var item []aws.JSONValue
 	err = dynamodbattribute.UnmarshalListOfMaps(res.Items, &item)
 	CHECK(err)
@@ -136,7 +137,19 @@ func LibScan(tablename string, projection []string) []aws.JSONValue {
 
 func CondWrite(env *Env, tablename string, key string,
 		update map[expression.NameBuilder]expression.OperandBuilder,
-		cond expression.ConditionBuilder) {
+		cond expression.ConditionBuilder) error {
+	_, err := CondWriteApplied(env, tablename, key, update, cond)
+	return err
+}
+
+// CondWriteApplied is CondWrite, but also returns whether the write was
+// applied. It is not if cond fails, or if a write of a later step already
+// updated the item. The outcome is logged with the step result, so replay
+// returns the same.
+func CondWriteApplied(env *Env, tablename string, key string,
+		update map[expression.NameBuilder]expression.OperandBuilder,
+		cond expression.ConditionBuilder) (applied bool, err error) {
+	defer recoverStep(&err)
 	newLog, preWriteLog := ProposeNextStep(env, aws.JSONValue{
 		"type":  "PreWrite",
 		"key":   key,
@@ -153,7 +166,9 @@ func CondWrite(env *Env, tablename string, key string,
 			CheckLogDataField(resultLog, "table", tablename)
 			CheckLogDataField(resultLog, "key", key)
 			log.Printf("[INFO] Seen PostWrite log for step %d", preWriteLog.StepNumber)
-			return
+			// Writes logged before the outcome was recorded were applied
+			applied, ok := resultLog.Data["applied"].(bool)
+			return applied || !ok, nil
 		}
 	}
 
@@ -182,22 +197,30 @@ func CondWrite(env *Env, tablename string, key string,
 		ExpressionAttributeValues: expr.Values(),
 		UpdateExpression:          expr.Update(),
 	})
+	applied = true
 	if err != nil {
 		AssertConditionFailure(err)
+		// The condition on VERSION also fails if an attempt of this step
+		// applied the write before crashing
+		_, version := libReadVersioned(tablename, key)
+		applied = version == strconv.FormatUint(preWriteLog.SeqNum, 10)
 	}
 
 	LogStepResult(env, env.InstanceId, preWriteLog.StepNumber, aws.JSONValue{
 		"type":    "PostWrite",
 		"key":     key,
 		"table":   tablename,
+		"applied": applied,
 	})
+	return applied, nil
 }
 
-func Write(env *Env, tablename string, key string, update map[expression.NameBuilder]expression.OperandBuilder) {
-	CondWrite(env, tablename, key, update, expression.ConditionBuilder{})
+func Write(env *Env, tablename string, key string, update map[expression.NameBuilder]expression.OperandBuilder) error {
+	return CondWrite(env, tablename, key, update, expression.ConditionBuilder{})
 }
 
-func Read(env *Env, tablename string, key string) interface{} {
+func Read(env *Env, tablename string, key string) (result interface{}, err error) {
+	defer recoverStep(&err)
 	step := env.StepNumber
 	newLog := false
 	intentLog := env.Fsm.GetStepLog(step)
@@ -225,10 +248,11 @@ func Read(env *Env, tablename string, key string) interface{} {
 		CheckLogDataField(intentLog, "table", tablename)
 		log.Printf("[INFO] Seen Read log for step %d", intentLog.StepNumber)
 	}
-	return intentLog.Data["result"]
+	return intentLog.Data["result"], nil
 }
 
-func Scan(env *Env, tablename string) interface{} {
+func Scan(env *Env, tablename string) (result interface{}, err error) {
+	defer recoverStep(&err)
 	step := env.StepNumber
 	newLog := false
 	intentLog := env.Fsm.GetStepLog(step)
@@ -252,7 +276,7 @@ func Scan(env *Env, tablename string) interface{} {
 		CheckLogDataField(intentLog, "table", tablename)
 		log.Printf("[INFO] Seen Scan log for step %d", intentLog.StepNumber)
 	}
-	return intentLog.Data["result"]
+	return intentLog.Data["result"], nil
 }
 
 func BuildProjection(names []string) expression.ProjectionBuilder {
@@ -276,10 +300,10 @@ func AssertConditionFailure(err error) {
 			return
 		default:
 			log.Printf("ERROR: %s", aerr)
-			panic("ERROR detected")
+			panic(&StepError{Err: aerr})
 		}
 	} else {
 		log.Printf("ERROR: %s", err)
-		panic("ERROR detected")
+		panic(&StepError{Err: err})
 	}
 }
@@ -16,7 +16,13 @@ type Env struct {
 	StepNumber  int32
 	Input       interface{}
 	TxnId       string
+	TxnTs       int64
+	TxnMode     string
 	Instruction string
+	Detached    bool
+	// OwnsTxn is set once the instance begins its own transaction, whose id
+	// is its InstanceId
+	OwnsTxn     bool
 	Baseline    bool
 	FaasCtx     context.Context
 	FaasEnv     types.Environment
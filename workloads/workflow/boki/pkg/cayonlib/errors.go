@@ -0,0 +1,90 @@
+package cayonlib
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+)
+
+// Error is a failure reported in OutputWrapper. Handlers return one, or any
+// other error, to fail an instance deterministically: the failure is logged
+// like an output, and a replayed caller sees it again.
+type Error struct {
+	Type    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Type, e.Message)
+}
+
+func NewError(errType string, message string) *Error {
+	return &Error{Type: errType, Message: message}
+}
+
+// Error types set by cayonlib. Application errors not created by NewError
+// have kApplicationErrorType.
+const (
+	kApplicationErrorType = "ApplicationError"
+	kStepErrorType        = "StepError"
+)
+
+// StepError is returned by steps that failed to reach the shared log,
+// DynamoDB or a callee, e.g. due to throttling. Unlike application errors,
+// step errors are not logged, so handlers must return them instead of
+// handling them. The instance then fails without finishing, and runs again
+// when its caller is replayed or the collector restarts it.
+type StepError struct {
+	Err error
+}
+
+func (e *StepError) Error() string {
+	return fmt.Sprintf("step failed: %v", e.Err)
+}
+
+func (e *StepError) Unwrap() error {
+	return e.Err
+}
+
+func IsStepError(err error) bool {
+	var stepErr *StepError
+	return errors.As(err, &stepErr)
+}
+
+// asStepError turns err into a step error, for code that must run to the
+// end once started, so that the instance stays unfinished and is run again
+// even if err is an application error
+func asStepError(err error) error {
+	if err == nil || IsStepError(err) {
+		return err
+	}
+	return &StepError{Err: err}
+}
+
+// asError converts a value recovered from CHECK into an error. Only calls
+// to the shared log, DynamoDB and other functions raise step errors, through
+// checkStep. Other errors, e.g. of decoding, fail the instance the same way
+// every time, so they are application errors. Runtime errors are bugs, and
+// are not recovered.
+func asError(r interface{}) (error, bool) {
+	if _, ok := r.(runtime.Error); ok {
+		return nil, false
+	}
+	err, ok := r.(error)
+	if !ok {
+		return nil, false
+	}
+	return err, true
+}
+
+// recoverStep is deferred by steps, which use CHECK internally, to return
+// the error CHECK panics with instead
+func recoverStep(err *error) {
+	if r := recover(); r != nil {
+		recovered, ok := asError(r)
+		if !ok {
+			panic(r)
+		}
+		*err = recovered
+	}
+}
@@ -0,0 +1,168 @@
+package cayonlib
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"cs.utexas.edu/zjia/faas/types"
+)
+
+// fakeEnv is an in-memory shared log, recording async invocations instead of
+// running them. Sync invocations run the functions served by serve.
+type fakeEnv struct {
+	mu      sync.Mutex
+	entries []*types.LogEntry
+	trimmed map[uint64]uint64
+	invoked []string
+	inputs  [][]byte
+	nextId  uint64
+	funcs   map[string]types.FuncHandler
+	calls   map[string]int
+}
+
+func newFakeEnv() *fakeEnv {
+	return &fakeEnv{
+		trimmed: make(map[uint64]uint64),
+		funcs:   make(map[string]types.FuncHandler),
+		calls:   make(map[string]int),
+	}
+}
+
+// serve makes sync invocations of funcName run handler as a cayonlib function
+func (f *fakeEnv) serve(funcName string, handler func(env *Env) (interface{}, error)) {
+	funcHandler, _ := CreateFuncHandlerFactory(handler).New(f, funcName)
+	f.funcs[funcName] = funcHandler
+}
+
+func (f *fakeEnv) callCount(funcName string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[funcName]
+}
+
+func newTestEnv(fake *fakeEnv) *Env {
+	return &Env{
+		LambdaId: "test",
+		FaasCtx:  context.Background(),
+		FaasEnv:  fake,
+	}
+}
+
+// newInstanceEnv returns an env running instanceId, which replays the steps
+// already logged by instanceId
+func newInstanceEnv(fake *fakeEnv, instanceId string) *Env {
+	env := newTestEnv(fake)
+	env.InstanceId = instanceId
+	env.Fsm = NewIntentFsm(instanceId)
+	env.Fsm.Catch(env)
+	return env
+}
+
+func hasTag(entry *types.LogEntry, tag uint64) bool {
+	for _, t := range entry.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *fakeEnv) visible(entry *types.LogEntry, tag uint64) bool {
+	return hasTag(entry, tag) && entry.SeqNum >= f.trimmed[tag]
+}
+
+func (f *fakeEnv) InvokeFunc(ctx context.Context, funcName string, input []byte) ([]byte, error) {
+	funcHandler, ok := f.funcs[funcName]
+	if !ok {
+		return nil, errors.New("InvokeFunc of a function not served")
+	}
+	f.mu.Lock()
+	f.calls[funcName]++
+	f.mu.Unlock()
+	return funcHandler.Call(ctx, input)
+}
+
+func (f *fakeEnv) InvokeFuncAsync(ctx context.Context, funcName string, input []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.invoked = append(f.invoked, funcName)
+	f.inputs = append(f.inputs, input)
+	return nil
+}
+
+func (f *fakeEnv) GrpcCall(ctx context.Context, service string, method string, request []byte) ([]byte, error) {
+	return nil, errors.New("GrpcCall is not supported")
+}
+
+func (f *fakeEnv) GenerateUniqueID() uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nextId++
+	return f.nextId
+}
+
+// Seqnums start from 1, as 0 stands for the head of a stream
+func (f *fakeEnv) SharedLogAppend(ctx context.Context, tags []uint64, data []byte) (uint64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	seqNum := uint64(len(f.entries) + 1)
+	f.entries = append(f.entries, &types.LogEntry{
+		SeqNum: seqNum,
+		Tags:   append([]uint64{}, tags...),
+		Data:   append([]byte{}, data...),
+	})
+	return seqNum, nil
+}
+
+func (f *fakeEnv) SharedLogReadNext(ctx context.Context, tag uint64, seqNum uint64) (*types.LogEntry, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, entry := range f.entries {
+		if entry.SeqNum >= seqNum && f.visible(entry, tag) {
+			copied := *entry
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeEnv) SharedLogReadNextBlock(ctx context.Context, tag uint64, seqNum uint64) (*types.LogEntry, error) {
+	return f.SharedLogReadNext(ctx, tag, seqNum)
+}
+
+func (f *fakeEnv) SharedLogReadPrev(ctx context.Context, tag uint64, seqNum uint64) (*types.LogEntry, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := len(f.entries) - 1; i >= 0; i-- {
+		entry := f.entries[i]
+		if entry.SeqNum <= seqNum && f.visible(entry, tag) {
+			copied := *entry
+			return &copied, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeEnv) SharedLogCheckTail(ctx context.Context, tag uint64) (*types.LogEntry, error) {
+	return f.SharedLogReadPrev(ctx, tag, ^uint64(0))
+}
+
+func (f *fakeEnv) SharedLogSetAuxData(ctx context.Context, seqNum uint64, auxData []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if seqNum == 0 || seqNum > uint64(len(f.entries)) {
+		return errors.New("no such log entry")
+	}
+	f.entries[seqNum-1].AuxData = append([]byte{}, auxData...)
+	return nil
+}
+
+func (f *fakeEnv) SharedLogTrim(ctx context.Context, tag uint64, seqNum uint64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if seqNum > f.trimmed[tag] {
+		f.trimmed[tag] = seqNum
+	}
+	return nil
+}
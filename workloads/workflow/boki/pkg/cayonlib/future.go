@@ -0,0 +1,123 @@
+package cayonlib
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/lithammer/shortuuid"
+)
+
+// Future is a synchronous invocation running in the background. Like
+// SyncInvoke, its PreInvoke step is proposed when it starts, and the callee
+// logs its output as the result of that step. A replayed instance gets the
+// output from the log without invoking the callee again.
+//
+// Futures are started and awaited by the goroutine running the instance,
+// which keeps the step numbers of an instance the same across replays.
+type Future struct {
+	instanceId string
+	step       int32
+	done       chan struct{}
+	output     interface{}
+	err        error
+}
+
+// InvokeAsync starts callee in the background. Its error is returned by
+// Await.
+func InvokeAsync(env *Env, callee string, input interface{}) (future *Future, err error) {
+	defer recoverStep(&err)
+	newLog, preInvokeLog := ProposeNextStep(env, aws.JSONValue{
+		"type":       "PreInvoke",
+		"instanceId": shortuuid.New(),
+		"callee":     callee,
+		"input":      input,
+	})
+	f := &Future{
+		instanceId: preInvokeLog.Data["instanceId"].(string),
+		step:       preInvokeLog.StepNumber,
+		done:       make(chan struct{}),
+	}
+	if !newLog {
+		CheckLogDataField(preInvokeLog, "type", "PreInvoke")
+		CheckLogDataField(preInvokeLog, "callee", callee)
+		log.Printf("[INFO] Seen PreInvoke log for step %d", preInvokeLog.StepNumber)
+		resultLog := FetchStepResultLog(env, preInvokeLog.StepNumber, false /* catch */)
+		if resultLog != nil {
+			CheckLogDataField(resultLog, "type", "InvokeResult")
+			log.Printf("[INFO] Seen InvokeResult log for step %d", preInvokeLog.StepNumber)
+			f.output, f.err = invokeResult(resultLog)
+			close(f.done)
+			return f, nil
+		}
+	}
+
+	payload := prepareInvoke(env, callee, input, f.step, f.instanceId)
+	go func() {
+		defer close(f.done)
+		f.output, f.err = callFunc(env, callee, payload)
+	}()
+	return f, nil
+}
+
+func (f *Future) InstanceId() string {
+	return f.instanceId
+}
+
+// Await blocks until the callee returns, and returns its output or error
+func (f *Future) Await() (interface{}, error) {
+	<-f.done
+	return f.output, f.err
+}
+
+// AwaitAll waits for all futures, and returns their outputs in the same
+// order, or the first error among them. It never returns while callees are
+// still running, so a caller failing on the error does not leave them behind.
+func AwaitAll(futures ...*Future) ([]interface{}, error) {
+	outputs := make([]interface{}, len(futures))
+	var firstErr error
+	for i, f := range futures {
+		output, err := f.Await()
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		outputs[i] = output
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return outputs, nil
+}
+
+// AwaitAny returns the index and output of the first future to finish. The
+// index is logged as a step, so a replayed instance picks the same future
+// even if another one finishes first this time.
+func AwaitAny(env *Env, futures ...*Future) (index int, output interface{}, err error) {
+	defer recoverStep(&err)
+	if len(futures) == 0 {
+		panic("AwaitAny without futures")
+	}
+	intentLog := env.Fsm.GetStepLog(env.StepNumber)
+	if intentLog != nil {
+		env.StepNumber += 1
+	} else {
+		first := make(chan int, len(futures))
+		for i, f := range futures {
+			go func(i int, f *Future) {
+				<-f.done
+				first <- i
+			}(i, f)
+		}
+		_, intentLog = ProposeNextStep(env, aws.JSONValue{
+			"type":  "AwaitAny",
+			"index": <-first,
+		})
+	}
+	CheckLogDataField(intentLog, "type", "AwaitAny")
+	index = int(intentLog.Data["index"].(float64))
+	if index >= len(futures) {
+		panic(fmt.Sprintf("AwaitAny picked future %d of %d", index, len(futures)))
+	}
+	output, err = futures[index].Await()
+	return index, output, err
+}
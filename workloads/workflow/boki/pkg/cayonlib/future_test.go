@@ -0,0 +1,115 @@
+package cayonlib
+
+import (
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// serveFutures serves "slow", which returns after 50ms, "fast" and "fail"
+func serveFutures(fake *fakeEnv) *int32 {
+	slowDone := new(int32)
+	fake.serve("slow", func(env *Env) (interface{}, error) {
+		time.Sleep(50 * time.Millisecond)
+		atomic.StoreInt32(slowDone, 1)
+		return "slow", nil
+	})
+	fake.serve("fast", func(env *Env) (interface{}, error) {
+		return "fast", nil
+	})
+	fake.serve("fail", func(env *Env) (interface{}, error) {
+		return nil, NewError("Failed", "fail")
+	})
+	return slowDone
+}
+
+func startFutures(t *testing.T, env *Env, callees ...string) []*Future {
+	futures := make([]*Future, 0, len(callees))
+	for _, callee := range callees {
+		future, err := InvokeAsync(env, callee, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		futures = append(futures, future)
+	}
+	return futures
+}
+
+func TestAwaitAll(t *testing.T) {
+	fake := newFakeEnv()
+	serveFutures(fake)
+	outputs, err := AwaitAll(startFutures(t, newInstanceEnv(fake, "caller"), "slow", "fast")...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []interface{}{"slow", "fast"}; !reflect.DeepEqual(outputs, want) {
+		t.Errorf("AwaitAll = %v, want %v", outputs, want)
+	}
+}
+
+func TestAwaitAllError(t *testing.T) {
+	fake := newFakeEnv()
+	slowDone := serveFutures(fake)
+	_, err := AwaitAll(startFutures(t, newInstanceEnv(fake, "caller"), "fail", "slow")...)
+	if err == nil || IsStepError(err) {
+		t.Errorf("AwaitAll error = %v, want the error of fail", err)
+	}
+	if atomic.LoadInt32(slowDone) == 0 {
+		t.Error("AwaitAll returned while slow was running")
+	}
+}
+
+func TestFutureReplay(t *testing.T) {
+	fake := newFakeEnv()
+	serveFutures(fake)
+	env := newInstanceEnv(fake, "caller")
+	outputs, err := AwaitAll(startFutures(t, env, "fast", "slow")...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = AwaitAll(startFutures(t, env, "fail")...)
+	if err == nil {
+		t.Fatal("fail did not fail")
+	}
+
+	// Outputs and errors of the callees come from the log
+	replay := newInstanceEnv(fake, "caller")
+	replayed, err := AwaitAll(startFutures(t, replay, "fast", "slow")...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(replayed, outputs) {
+		t.Errorf("replayed outputs %v, want %v", replayed, outputs)
+	}
+	if _, err := AwaitAll(startFutures(t, replay, "fail")...); err == nil {
+		t.Error("replayed fail did not fail")
+	}
+	for _, callee := range []string{"fast", "slow", "fail"} {
+		if got := fake.callCount(callee); got != 1 {
+			t.Errorf("%s was called %d times, want once", callee, got)
+		}
+	}
+}
+
+func TestAwaitAny(t *testing.T) {
+	fake := newFakeEnv()
+	serveFutures(fake)
+	env := newInstanceEnv(fake, "caller")
+	futures := startFutures(t, env, "slow", "fast")
+	index, output, err := AwaitAny(env, futures...)
+	if err != nil || index != 1 || output != "fast" {
+		t.Fatalf("AwaitAny = %d, %v, %v, want fast", index, output, err)
+	}
+	AwaitAll(futures...)
+
+	// Both futures are done when replayed, and the logged index is kept
+	replay := newInstanceEnv(fake, "caller")
+	index, output, err = AwaitAny(replay, startFutures(t, replay, "slow", "fast")...)
+	if err != nil || index != 1 || output != "fast" {
+		t.Errorf("replayed AwaitAny = %d, %v, %v, want fast", index, output, err)
+	}
+	if fake.callCount("slow") != 1 || fake.callCount("fast") != 1 {
+		t.Errorf("replay invoked callees again: slow %d, fast %d times", fake.callCount("slow"), fake.callCount("fast"))
+	}
+}
@@ -0,0 +1,275 @@
+package cayonlib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"cs.utexas.edu/zjia/faas/types"
+	"github.com/golang/snappy"
+)
+
+// logTrimmer is implemented by runtimes whose shared log supports trimming.
+// SharedLogTrim drops records of tag with seqnum below seqNum. The Boki
+// runtime these workloads are built against does not provide it yet, so
+// there GC fails with errTrimUnsupported and nothing is collected. GC only
+// works on a runtime adding SharedLogTrim to its Environment.
+type logTrimmer interface {
+	SharedLogTrim(ctx context.Context, tag uint64, seqNum uint64) error
+}
+
+// intentRecord summarizes the records of one instance on IntentLogTag
+type intentRecord struct {
+	InstanceId  string
+	LambdaId    string
+	TxnId       string
+	TxnTs       int64
+	TxnMode     string
+	Input       interface{}
+	Async       bool
+	CallerName  string
+	CallerId    string
+	CallerStep  int32
+	StartSeqNum uint64
+	StartTime   int64
+	Done        bool
+	DoneSeqNum  uint64
+	DoneTime    int64
+}
+
+// scanIntents reads IntentLogTag from its head, and returns records of all
+// instances that still have a start record, along with the seqnum following
+// the last record read. An instance appends a start record every time it is
+// (re-)executed, and StartTime is taken from the latest one.
+func scanIntents(env *Env) (map[string]*intentRecord, uint64) {
+	intents := make(map[string]*intentRecord)
+	seqNum := uint64(0)
+	for {
+		logEntry, err := env.FaasEnv.SharedLogReadNext(env.FaasCtx, IntentLogTag, seqNum)
+		checkStep(err)
+		if logEntry == nil {
+			break
+		}
+		seqNum = logEntry.SeqNum + 1
+		decoded, err := snappy.Decode(nil, logEntry.Data)
+		CHECK(err)
+		var data map[string]interface{}
+		CHECK(json.Unmarshal(decoded, &data))
+		instanceId, ok := data["InstanceId"].(string)
+		if !ok {
+			continue
+		}
+		if done, _ := data["DONE"].(bool); done {
+			// Only the first DONE counts, in case the instance was re-executed
+			if intent, exists := intents[instanceId]; exists && !intent.Done {
+				intent.Done = true
+				intent.DoneSeqNum = logEntry.SeqNum
+				if txnId, _ := data["TxnId"].(string); txnId != "" {
+					intent.TxnId = txnId
+				}
+				if ts, ok := data["TS"].(float64); ok {
+					intent.DoneTime = int64(ts)
+				}
+			}
+			continue
+		}
+		if intent, exists := intents[instanceId]; exists {
+			if ts, ok := data["ST"].(float64); ok {
+				intent.StartTime = int64(ts)
+			}
+			continue
+		}
+		intent := &intentRecord{
+			InstanceId:  instanceId,
+			Input:       data["INPUT"],
+			StartSeqNum: logEntry.SeqNum,
+		}
+		intent.LambdaId, _ = data["LambdaId"].(string)
+		intent.TxnId, _ = data["TxnId"].(string)
+		if ts, ok := data["TxnTs"].(float64); ok {
+			intent.TxnTs = int64(ts)
+		}
+		intent.TxnMode, _ = data["TxnMode"].(string)
+		intent.Async, _ = data["ASYNC"].(bool)
+		intent.CallerName, _ = data["CallerName"].(string)
+		intent.CallerId, _ = data["CallerId"].(string)
+		if step, ok := data["CallerStep"].(float64); ok {
+			intent.CallerStep = int32(step)
+		}
+		if ts, ok := data["ST"].(float64); ok {
+			intent.StartTime = int64(ts)
+		}
+		intents[instanceId] = intent
+	}
+	return intents, seqNum
+}
+
+type GCResult struct {
+	Instances int `json:"instances"`
+	Streams   int `json:"streams"`
+}
+
+var errTrimUnsupported = errors.New("shared log trimming is not supported by the runtime")
+
+// trimLog drops records of tag below seqNum. It returns false if the runtime
+// cannot trim the shared log.
+func trimLog(env *Env, tag uint64, seqNum uint64) bool {
+	trimmer, ok := env.FaasEnv.(logTrimmer)
+	if !ok {
+		return false
+	}
+	checkStep(trimmer.SharedLogTrim(env.FaasCtx, tag, seqNum))
+	return true
+}
+
+// lockIdsOfTxn returns the locks taken by reads and writes of lambdaId within
+// txnId
+func lockIdsOfTxn(env *Env, lambdaId string, txnId string) []string {
+	txnEnv := &Env{
+		LambdaId: lambdaId,
+		TxnId:    txnId,
+		FaasCtx:  env.FaasCtx,
+		FaasEnv:  env.FaasEnv,
+	}
+	lockIds := make([]string, 0)
+	for _, txnLog := range getAllTxnLogs(txnEnv) {
+		if txnLog.Callee != "" {
+			continue
+		}
+		op := txnLog.WriteOp
+		if txnLog.ReadOp != nil {
+			op = txnLog.ReadOp
+		}
+		tablename, _ := op["tablename"].(string)
+		key, _ := op["key"].(string)
+		lockIds = append(lockIds, fmt.Sprintf("%s-%s", tablename, key))
+	}
+	return lockIds
+}
+
+// GC trims shared log records of instances finished more than T seconds ago.
+// Intent step streams of these instances are trimmed up to their DONE
+// records. Transaction and transaction status streams are trimmed once the
+// instance starting the transaction is collected, and lock streams of keys
+// read or written by the transaction up to their latest unlock record, if the
+// lock is free. Finally, IntentLogTag is trimmed up to the first record of
+// any instance left.
+// Streams shared with instances left, due to hash collisions, are kept.
+// GC returns an error, before reading anything, if the runtime cannot trim
+// the shared log.
+func GC(env *Env) (result GCResult, err error) {
+	defer recoverStep(&err)
+	if _, ok := env.FaasEnv.(logTrimmer); !ok {
+		return result, errTrimUnsupported
+	}
+	intents, nextSeqNum := scanIntents(env)
+	deadline := time.Now().Unix() - T
+
+	collected := make(map[string]*intentRecord)
+	for instanceId, intent := range intents {
+		if intent.Done && intent.DoneTime < deadline {
+			collected[instanceId] = intent
+		}
+	}
+
+	// Trim points of streams, where seqnum 0 means the stream is kept
+	trimPoints := make(map[uint64]uint64)
+	setTrimPoint := func(tag uint64, seqNum uint64) {
+		if current, exists := trimPoints[tag]; !exists || (current != 0 && current < seqNum) {
+			trimPoints[tag] = seqNum
+		}
+	}
+	intentTrimPoint := nextSeqNum
+	for instanceId, intent := range intents {
+		if _, exists := collected[instanceId]; !exists {
+			trimPoints[IntentStepStreamTag(instanceId)] = 0
+			if intent.StartSeqNum < intentTrimPoint {
+				intentTrimPoint = intent.StartSeqNum
+			}
+		}
+	}
+
+	lockIds := make(map[string]bool)
+	for instanceId, intent := range collected {
+		setTrimPoint(IntentStepStreamTag(instanceId), intent.DoneSeqNum)
+		if intent.TxnId == "" || intent.LambdaId == "" {
+			continue
+		}
+		root, exists := collected[intent.TxnId]
+		if !exists {
+			continue
+		}
+		for _, lockId := range lockIdsOfTxn(env, intent.LambdaId, intent.TxnId) {
+			lockIds[lockId] = true
+		}
+		setTrimPoint(TransactionStreamTag(intent.LambdaId, intent.TxnId), root.DoneSeqNum)
+		setTrimPoint(TxnStatusStreamTag(intent.TxnId), root.DoneSeqNum)
+	}
+	for lockId := range lockIds {
+		fsm := getOrCreateLockFsm(lockId)
+		fsm.catch(env)
+		storeBackLockFsm(fsm)
+		if fsm.tail != nil && fsm.tail.UnlockOp {
+			setTrimPoint(LockStreamTag(lockId), fsm.tail.SeqNum)
+		}
+	}
+
+	result.Instances = len(collected)
+	for tag, seqNum := range trimPoints {
+		if seqNum == 0 {
+			continue
+		}
+		trimLog(env, tag, seqNum)
+		result.Streams++
+	}
+	if intentTrimPoint > 0 {
+		trimLog(env, IntentLogTag, intentTrimPoint)
+		result.Streams++
+	}
+	return result, nil
+}
+
+type gcHandler struct {
+	env types.Environment
+}
+
+// Call runs one GC pass, ignoring its input
+func (h *gcHandler) Call(ctx context.Context, input []byte) (output []byte, err error) {
+	defer recoverStep(&err)
+	env := &Env{
+		LambdaId: "gc",
+		FaasCtx:  ctx,
+		FaasEnv:  h.env,
+	}
+	start := time.Now()
+	result, err := GC(env)
+	if err != nil {
+		log.Printf("[ERROR] GC failed: %v", err)
+		return nil, err
+	}
+	log.Printf("[INFO] GC collected %d instances and trimmed %d streams in %s",
+		result.Instances, result.Streams, time.Since(start))
+	return json.Marshal(result)
+}
+
+type gcHandlerFactory struct {
+}
+
+func (f *gcHandlerFactory) New(env types.Environment, funcName string) (types.FuncHandler, error) {
+	return &gcHandler{env: env}, nil
+}
+
+func (f *gcHandlerFactory) GrpcNew(env types.Environment, service string) (types.GrpcFuncHandler, error) {
+	return nil, fmt.Errorf("Not implemented")
+}
+
+// CreateGCHandlerFactory serves a function that runs GC on every call. Unlike
+// functions from CreateFuncHandlerFactory, it appends no intent records. On
+// runtimes without SharedLogTrim, which includes the current Boki, every
+// call fails.
+func CreateGCHandlerFactory() types.FuncHandlerFactory {
+	return &gcHandlerFactory{}
+}
@@ -0,0 +1,111 @@
+package cayonlib
+
+import (
+	"testing"
+	"time"
+
+	"cs.utexas.edu/zjia/faas/types"
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func appendIntent(env *Env, instanceId string, lambdaId string, txnId string, start int64) uint64 {
+	return LibAppendLog(env, IntentLogTag, aws.JSONValue{
+		"InstanceId": instanceId,
+		"LambdaId":   lambdaId,
+		"TxnId":      txnId,
+		"CallerName": "",
+		"DONE":       false,
+		"ASYNC":      false,
+		"INPUT":      nil,
+		"ST":         start,
+	})
+}
+
+func appendDone(env *Env, instanceId string, txnId string, ts int64) uint64 {
+	done := aws.JSONValue{
+		"InstanceId": instanceId,
+		"DONE":       true,
+		"TS":         ts,
+	}
+	if txnId != "" {
+		done["TxnId"] = txnId
+	}
+	return LibAppendLog(env, IntentLogTag, done)
+}
+
+func appendStep(env *Env, instanceId string) {
+	LibAppendLog(env, IntentStepStreamTag(instanceId), aws.JSONValue{"InstanceId": instanceId})
+}
+
+func TestGC(t *testing.T) {
+	fake := newFakeEnv()
+	env := newTestEnv(fake)
+	old := time.Now().Unix() - 2*T
+	recent := time.Now().Unix()
+
+	appendIntent(env, "finished", "fn", "", old)
+	appendStep(env, "finished")
+	finishedDone := appendDone(env, "finished", "", old)
+
+	runningStart := appendIntent(env, "running", "fn", "", old)
+	appendStep(env, "running")
+
+	appendIntent(env, "recent", "fn", "", recent)
+	appendStep(env, "recent")
+	appendDone(env, "recent", "", recent)
+
+	// The root of a transaction has no TxnId until its DONE record
+	appendIntent(env, "root", "frontend", "", old)
+	appendIntent(env, "callee", "hotel", "root", old)
+	txnEnv := newTestEnv(fake)
+	txnEnv.LambdaId = "hotel"
+	txnEnv.TxnId = "root"
+	appendTxnLog(txnEnv, "frontend", &TxnLogEntry{Callee: "hotel"})
+	appendTxnLog(txnEnv, "hotel", &TxnLogEntry{WriteOp: aws.JSONValue{"tablename": "gc", "key": "k", "value": aws.JSONValue{}}})
+	lockFsm := getOrCreateLockFsm("gc-k")
+	lockFsm.Lock(txnEnv, "root")
+	lockFsm.Unlock(txnEnv, "root")
+	lockFsm.catch(txnEnv)
+	storeBackLockFsm(lockFsm)
+	appendDone(env, "callee", "", old)
+	rootDone := appendDone(env, "root", "root", old)
+
+	result, err := GC(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Instances != 3 {
+		t.Errorf("GC collected %d instances, want 3", result.Instances)
+	}
+	tests := []struct {
+		name string
+		tag  uint64
+		want uint64
+	}{
+		{"finished steps", IntentStepStreamTag("finished"), finishedDone},
+		{"running steps", IntentStepStreamTag("running"), 0},
+		{"recent steps", IntentStepStreamTag("recent"), 0},
+		{"root transaction", TransactionStreamTag("frontend", "root"), rootDone},
+		{"callee transaction", TransactionStreamTag("hotel", "root"), rootDone},
+		{"transaction status", TxnStatusStreamTag("root"), rootDone},
+		{"lock", LockStreamTag("gc-k"), lockFsm.tail.SeqNum},
+		{"intents", IntentLogTag, runningStart},
+	}
+	for _, test := range tests {
+		if got := fake.trimmed[test.tag]; got != test.want {
+			t.Errorf("%s trimmed up to %d, want %d", test.name, got, test.want)
+		}
+	}
+}
+
+func TestGCWithoutTrim(t *testing.T) {
+	fake := newFakeEnv()
+	env := newTestEnv(fake)
+	// Hides SharedLogTrim of the fake
+	env.FaasEnv = struct{ types.Environment }{fake}
+	appendIntent(env, "finished", "fn", "", 0)
+	appendDone(env, "finished", "", 0)
+	if _, err := GC(env); err != errTrimUnsupported {
+		t.Errorf("GC without SharedLogTrim = %v, want %v", err, errTrimUnsupported)
+	}
+}
@@ -5,10 +5,13 @@ import (
 )
 
 const IntentLogTag             uint64 = 1
+// Fixed tags end with the low bits of IntentLogTag, which hashed tags never do
+const TimerLogTag              uint64 = (1 << 3) + 1
 
 const intentStepStreamLowBits  uint64 = 2
 const lockStreamLowBits        uint64 = 3
 const transactionStreamLowBits uint64 = 4
+const txnStatusStreamLowBits   uint64 = 5
 
 func IntentStepStreamTag(instanceId string) uint64 {
 	h := xxhash.Sum64String(instanceId)
@@ -28,6 +31,15 @@ func TransactionStreamTag(lambdaId string, txnId string) uint64 {
 	return tag
 }
 
+func TxnStatusStreamTag(txnId string) uint64 {
+	h := xxhash.Sum64String(txnId)
+	tag := (h << 3) + txnStatusStreamLowBits
+	if tag == 0 || (^tag) == 0 {
+		panic("Invalid tag")
+	}
+	return tag
+}
+
 func LockStreamTag(lockId string) uint64 {
 	h := xxhash.Sum64String(lockId)
 	tag := (h << 3) + lockStreamLowBits
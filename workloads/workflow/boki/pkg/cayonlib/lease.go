@@ -0,0 +1,155 @@
+package cayonlib
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"cs.utexas.edu/zjia/faas/types"
+)
+
+// Locks are leases that expire LOCK_LEASE after they are taken, read from
+// LOCK_LEASE_MS. A requester finding an expired lock may break it, which
+// aborts the holding transaction, unless that transaction already started
+// to commit. Clocks of function nodes are assumed to be loosely in sync.
+var LOCK_LEASE = parseLockLease(os.Getenv("LOCK_LEASE_MS"))
+
+// Decisions on the transaction status stream. Only the first one counts:
+// CommitTxn and a requester breaking a lock race to append theirs.
+const (
+	kTxnCommitting = "committing"
+	kTxnAborted    = "aborted"
+)
+
+func parseLockLease(value string) time.Duration {
+	if value == "" {
+		return 10 * time.Second
+	}
+	return parseLockWaitTime(value)
+}
+
+func leaseExpired(lockLog *LockLogEntry) bool {
+	// Locks taken before leases were recorded never expire
+	if lockLog.Expiry == 0 {
+		return false
+	}
+	return time.Now().UnixNano()/int64(time.Millisecond) > lockLog.Expiry
+}
+
+// txnDecision returns the first decision on txnId, or "" if there is none
+func txnDecision(env *Env, txnId string) string {
+	for _, statusLog := range getTxnStatusLogs(env, txnId) {
+		if statusLog.Status == kTxnCommitting || statusLog.Status == kTxnAborted {
+			return statusLog.Status
+		}
+	}
+	return ""
+}
+
+// decideTxn proposes status as the decision on txnId, and returns whether it
+// is the decision taken
+func decideTxn(env *Env, txnId string, status string) bool {
+	if decision := txnDecision(env, txnId); decision != "" {
+		return decision == status
+	}
+	LibAppendLog(env, TxnStatusStreamTag(txnId), &TxnStatusLogEntry{
+		TxnId:  txnId,
+		Status: status,
+	})
+	return txnDecision(env, txnId) == status
+}
+
+// breakLock releases fsm on behalf of its holder, whose lease expired. It
+// returns false if the holder is committing, in which case its commit will
+// release the lock.
+func breakLock(env *Env, fsm *LockFsm) bool {
+	holder := fsm.tail.Holder
+	if !decideTxn(env, holder, kTxnAborted) {
+		return false
+	}
+	log.Printf("[WARN] Txn %s breaks lock %s of txn %s", env.TxnId, fsm.lockId, holder)
+	LibAppendLog(env, LockStreamTag(fsm.lockId), &LockLogEntry{
+		LockId:     fsm.lockId,
+		StepNumber: fsm.stepNumber,
+		UnlockOp:   true,
+		Holder:     holder,
+	})
+	fsm.catch(env)
+	return true
+}
+
+type HeldLock struct {
+	LockId  string `json:"lockId"`
+	Holder  string `json:"holder"`
+	Expiry  int64  `json:"expiry"`
+	Expired bool   `json:"expired"`
+}
+
+// ListLocks returns locks currently held. Locks are found through reads and
+// writes logged by transactions of unfinished or uncollected instances.
+func ListLocks(env *Env) []HeldLock {
+	intents, _ := scanIntents(env)
+	lockIds := make(map[string]bool)
+	for _, intent := range intents {
+		if intent.TxnId == "" || intent.LambdaId == "" {
+			continue
+		}
+		for _, lockId := range lockIdsOfTxn(env, intent.LambdaId, intent.TxnId) {
+			lockIds[lockId] = true
+		}
+	}
+	locks := make([]HeldLock, 0)
+	for lockId := range lockIds {
+		fsm := getOrCreateLockFsm(lockId)
+		fsm.catch(env)
+		storeBackLockFsm(fsm)
+		if fsm.holder() == "" {
+			continue
+		}
+		locks = append(locks, HeldLock{
+			LockId:  lockId,
+			Holder:  fsm.tail.Holder,
+			Expiry:  fsm.tail.Expiry,
+			Expired: leaseExpired(fsm.tail),
+		})
+	}
+	sort.Slice(locks, func(i, j int) bool {
+		return locks[i].LockId < locks[j].LockId
+	})
+	return locks
+}
+
+type locksHandler struct {
+	env types.Environment
+}
+
+// Call returns ListLocks as JSON, ignoring its input
+func (h *locksHandler) Call(ctx context.Context, input []byte) (output []byte, err error) {
+	defer recoverStep(&err)
+	env := &Env{
+		LambdaId: "locks",
+		FaasCtx:  ctx,
+		FaasEnv:  h.env,
+	}
+	return json.Marshal(ListLocks(env))
+}
+
+type locksHandlerFactory struct {
+}
+
+func (f *locksHandlerFactory) New(env types.Environment, funcName string) (types.FuncHandler, error) {
+	return &locksHandler{env: env}, nil
+}
+
+func (f *locksHandlerFactory) GrpcNew(env types.Environment, service string) (types.GrpcFuncHandler, error) {
+	return nil, fmt.Errorf("Not implemented")
+}
+
+// CreateLocksHandlerFactory serves a function listing locks currently held
+func CreateLocksHandlerFactory() types.FuncHandlerFactory {
+	return &locksHandlerFactory{}
+}
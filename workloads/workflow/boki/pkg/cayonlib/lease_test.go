@@ -0,0 +1,136 @@
+package cayonlib
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func withLockLease(t *testing.T, lease time.Duration) {
+	oldLease := LOCK_LEASE
+	LOCK_LEASE = lease
+	t.Cleanup(func() {
+		LOCK_LEASE = oldLease
+	})
+}
+
+func TestBreakLock(t *testing.T) {
+	withLockPolicy(t, LockNoWait)
+	withLockLease(t, -time.Second)
+	fake := newFakeEnv()
+	holder := txnEnv(fake, "holder", 1)
+	fsm := lockHeldBy(t, holder)
+	requester := txnEnv(fake, "requester", 2)
+	if got := lockWithPolicy(requester, fsm); got != "" {
+		t.Fatalf("locking an expired lock = %q", got)
+	}
+	if fsm.holder() != "requester" {
+		t.Errorf("expired lock is held by %q, want requester", fsm.holder())
+	}
+	if got := txnDecision(holder, "holder"); got != kTxnAborted {
+		t.Errorf("decision on the holder = %q, want %q", got, kTxnAborted)
+	}
+	// The holder finds out when it tries to commit
+	if decideTxn(holder, "holder", kTxnCommitting) {
+		t.Error("holder committed after its lock was broken")
+	}
+}
+
+func TestBreakLockOfCommittingTxn(t *testing.T) {
+	withLockPolicy(t, LockNoWait)
+	withLockLease(t, -time.Second)
+	fake := newFakeEnv()
+	holder := txnEnv(fake, "holder", 1)
+	fsm := lockHeldBy(t, holder)
+	if !decideTxn(holder, "holder", kTxnCommitting) {
+		t.Fatal("holder cannot commit")
+	}
+	requester := txnEnv(fake, "requester", 2)
+	if got := lockWithPolicy(requester, fsm); got != kLockBusy {
+		t.Errorf("locking an expired lock of a committing txn = %q, want %q", got, kLockBusy)
+	}
+	if fsm.holder() != "holder" {
+		t.Errorf("lock of a committing txn moved to %q", fsm.holder())
+	}
+}
+
+func TestLeaseNotExpired(t *testing.T) {
+	withLockPolicy(t, LockNoWait)
+	withLockLease(t, time.Minute)
+	fake := newFakeEnv()
+	holder := txnEnv(fake, "holder", 1)
+	fsm := lockHeldBy(t, holder)
+	if got := lockWithPolicy(txnEnv(fake, "requester", 2), fsm); got != kLockBusy {
+		t.Errorf("locking a held lock = %q, want %q", got, kLockBusy)
+	}
+	if got := txnDecision(holder, "holder"); got != "" {
+		t.Errorf("decision on the holder = %q, want none", got)
+	}
+}
+
+func TestDecideTxnRace(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		fake := newFakeEnv()
+		statuses := []string{kTxnCommitting, kTxnAborted, kTxnAborted}
+		decided := make([]bool, len(statuses))
+		var wg sync.WaitGroup
+		for j, status := range statuses {
+			wg.Add(1)
+			go func(j int, status string) {
+				defer wg.Done()
+				decided[j] = decideTxn(newTestEnv(fake), "txn", status)
+			}(j, status)
+		}
+		wg.Wait()
+		decision := txnDecision(newTestEnv(fake), "txn")
+		for j, status := range statuses {
+			if decided[j] != (status == decision) {
+				t.Fatalf("decideTxn(%q) = %v with decision %q", status, decided[j], decision)
+			}
+		}
+	}
+}
+
+func TestListLocks(t *testing.T) {
+	withLockLease(t, time.Minute)
+	fake := newFakeEnv()
+	env := newTestEnv(fake)
+	appendIntent(env, "callee", "hotel", "root", time.Now().Unix())
+	callee := txnEnv(fake, "root", 1)
+	callee.LambdaId = "hotel"
+	// A read lock left behind by a crashed TPLRead, and a released write lock
+	appendTxnLog(callee, "hotel", &TxnLogEntry{ReadOp: aws.JSONValue{"tablename": t.Name(), "key": "read"}})
+	appendTxnLog(callee, "hotel", &TxnLogEntry{WriteOp: writeOp("written", aws.JSONValue{})})
+	read := getOrCreateLockFsm(t.Name() + "-read")
+	read.Lock(callee, "root")
+	storeBackLockFsm(read)
+	written := getOrCreateLockFsm("t-written")
+	written.Lock(callee, "root")
+	written.Unlock(callee, "root")
+
+	locks := ListLocks(env)
+	if len(locks) != 1 {
+		t.Fatalf("ListLocks = %+v, want the read lock only", locks)
+	}
+	want := HeldLock{LockId: t.Name() + "-read", Holder: "root", Expiry: read.tail.Expiry}
+	if locks[0] != want {
+		t.Errorf("ListLocks = %+v, want %+v", locks[0], want)
+	}
+}
+
+func TestReadOnlyOps(t *testing.T) {
+	txnLogs := []*TxnLogEntry{
+		{ReadOp: aws.JSONValue{"tablename": "t", "key": "a"}},
+		{ReadOp: aws.JSONValue{"tablename": "t", "key": "b"}},
+		{WriteOp: writeOp("b", aws.JSONValue{})},
+		{Callee: "hotel", WriteOp: aws.JSONValue{}},
+		{ReadOp: aws.JSONValue{"tablename": "t", "key": "a"}},
+	}
+	want := []aws.JSONValue{{"tablename": "t", "key": "a"}}
+	if got := readOnlyOps(txnLogs); !reflect.DeepEqual(got, want) {
+		t.Errorf("readOnlyOps = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,178 @@
+package cayonlib
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang/snappy"
+)
+
+// LockPolicy decides what Lock does when another transaction holds the lock
+type LockPolicy string
+
+const (
+	// LockNoWait fails immediately
+	LockNoWait LockPolicy = "no-wait"
+	// LockWaitTimeout retries until LOCK_WAIT_TIMEOUT passes
+	LockWaitTimeout LockPolicy = "wait"
+	// LockWaitDie waits if the requester is older than the holder, and
+	// fails otherwise
+	LockWaitDie LockPolicy = "wait-die"
+	// LockWoundWait wounds the holder if the requester is older, and waits
+	// either way. A wounded transaction fails its next Lock, so that its
+	// caller aborts it and releases its locks.
+	LockWoundWait LockPolicy = "wound-wait"
+)
+
+// Causes of failed Lock calls, as counted by recordLockAbort
+const (
+	kLockBusy    = "busy"
+	kLockTimeout = "timeout"
+	kLockDied    = "died"
+	kLockWounded = "wounded"
+)
+
+const kLockMinBackoff = 2 * time.Millisecond
+const kLockMaxBackoff = 64 * time.Millisecond
+
+// The policy and timeout are read from LOCK_POLICY and LOCK_WAIT_TIMEOUT_MS.
+// Waiting policies never wait longer than LOCK_WAIT_TIMEOUT.
+var LOCK_POLICY = parseLockPolicy(os.Getenv("LOCK_POLICY"))
+var LOCK_WAIT_TIMEOUT = parseLockWaitTime(os.Getenv("LOCK_WAIT_TIMEOUT_MS"))
+
+func parseLockPolicy(value string) LockPolicy {
+	switch policy := LockPolicy(value); policy {
+	case "":
+		return LockNoWait
+	case LockNoWait, LockWaitTimeout, LockWaitDie, LockWoundWait:
+		return policy
+	default:
+		panic(fmt.Sprintf("Unknown lock policy: %s", value))
+	}
+}
+
+func parseLockWaitTime(value string) time.Duration {
+	if value == "" {
+		return time.Second
+	}
+	ms, err := strconv.Atoi(value)
+	CHECK(err)
+	return time.Duration(ms) * time.Millisecond
+}
+
+var lockAbortCounts = map[string]uint64{}
+var lockAbortCountsMutex = sync.Mutex{}
+
+// recordLockAbort counts a failed Lock call, and returns the number of failed
+// calls with the same cause in this process: busy (no-wait), timeout, died
+// (wait-die) or wounded (wound-wait). Functions taking locks run in their own
+// processes, so counts are reported in their logs by Lock.
+func recordLockAbort(cause string) uint64 {
+	lockAbortCountsMutex.Lock()
+	defer lockAbortCountsMutex.Unlock()
+	lockAbortCounts[cause]++
+	return lockAbortCounts[cause]
+}
+
+// olderTxn orders transactions by the start time logged by BeginTxn, with
+// ties broken by TxnId
+func olderTxn(ts1 int64, txnId1 string, ts2 int64, txnId2 string) bool {
+	if ts1 != ts2 {
+		return ts1 < ts2
+	}
+	return txnId1 < txnId2
+}
+
+type TxnStatusLogEntry struct {
+	SeqNum uint64 `json:"-"`
+	TxnId  string `json:"txnId"`
+	Status string `json:"status"`
+	Step   int32  `json:"step,omitempty"`
+	Ts     int64  `json:"ts,omitempty"`
+}
+
+func getTxnStatusLogs(env *Env, txnId string) []*TxnStatusLogEntry {
+	tag := TxnStatusStreamTag(txnId)
+	seqNum := uint64(0)
+	results := make([]*TxnStatusLogEntry, 0)
+	for {
+		logEntry, err := env.FaasEnv.SharedLogReadNext(env.FaasCtx, tag, seqNum)
+		checkStep(err)
+		if logEntry == nil {
+			break
+		}
+		decoded, err := snappy.Decode(nil, logEntry.Data)
+		CHECK(err)
+		var statusLog TxnStatusLogEntry
+		CHECK(json.Unmarshal(decoded, &statusLog))
+		if statusLog.TxnId == txnId {
+			statusLog.SeqNum = logEntry.SeqNum
+			results = append(results, &statusLog)
+		}
+		seqNum = logEntry.SeqNum + 1
+	}
+	return results
+}
+
+func woundTxn(env *Env, txnId string) {
+	log.Printf("[INFO] Txn %s wounds txn %s", env.TxnId, txnId)
+	LibAppendLog(env, TxnStatusStreamTag(txnId), &TxnStatusLogEntry{
+		TxnId:  txnId,
+		Status: "wounded",
+	})
+}
+
+func isWounded(env *Env, txnId string) bool {
+	for _, statusLog := range getTxnStatusLogs(env, txnId) {
+		if statusLog.Status == "wounded" {
+			return true
+		}
+	}
+	return false
+}
+
+// lockWithPolicy acquires fsm for env.TxnId under LOCK_POLICY, and returns
+// the cause if it fails
+func lockWithPolicy(env *Env, fsm *LockFsm) string {
+	deadline := time.Now().Add(LOCK_WAIT_TIMEOUT)
+	backoff := kLockMinBackoff
+	wounded := ""
+	for {
+		if LOCK_POLICY == LockWoundWait && isWounded(env, env.TxnId) {
+			return kLockWounded
+		}
+		if fsm.Lock(env, env.TxnId) {
+			return ""
+		}
+		holder := fsm.tail
+		if leaseExpired(holder) && breakLock(env, fsm) {
+			continue
+		}
+		older := olderTxn(env.TxnTs, env.TxnId, holder.TxnTs, holder.Holder)
+		switch LOCK_POLICY {
+		case LockNoWait:
+			return kLockBusy
+		case LockWaitDie:
+			if !older {
+				return kLockDied
+			}
+		case LockWoundWait:
+			if older && wounded != holder.Holder {
+				woundTxn(env, holder.Holder)
+				wounded = holder.Holder
+			}
+		}
+		if time.Now().Add(backoff).After(deadline) || env.FaasCtx.Err() != nil {
+			return kLockTimeout
+		}
+		time.Sleep(backoff)
+		if backoff < kLockMaxBackoff {
+			backoff *= 2
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package cayonlib
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestOlderTxn(t *testing.T) {
+	tests := []struct {
+		ts1    int64
+		txnId1 string
+		ts2    int64
+		txnId2 string
+		want   bool
+	}{
+		{1, "b", 2, "a", true},
+		{2, "a", 1, "b", false},
+		{1, "a", 1, "b", true},
+		{1, "b", 1, "a", false},
+		{1, "a", 1, "a", false},
+	}
+	for _, test := range tests {
+		if got := olderTxn(test.ts1, test.txnId1, test.ts2, test.txnId2); got != test.want {
+			t.Errorf("olderTxn(%d, %s, %d, %s) = %v, want %v",
+				test.ts1, test.txnId1, test.ts2, test.txnId2, got, test.want)
+		}
+	}
+}
+
+func withLockPolicy(t *testing.T, policy LockPolicy) {
+	oldPolicy, oldTimeout := LOCK_POLICY, LOCK_WAIT_TIMEOUT
+	LOCK_POLICY, LOCK_WAIT_TIMEOUT = policy, 20*time.Millisecond
+	t.Cleanup(func() {
+		LOCK_POLICY, LOCK_WAIT_TIMEOUT = oldPolicy, oldTimeout
+	})
+}
+
+func txnEnv(fake *fakeEnv, txnId string, txnTs int64) *Env {
+	env := newTestEnv(fake)
+	env.TxnId = txnId
+	env.TxnTs = txnTs
+	return env
+}
+
+// lockHeldBy returns a fresh lock taken by holder
+func lockHeldBy(t *testing.T, holder *Env) *LockFsm {
+	fsm := getOrCreateLockFsm(fmt.Sprintf("%s-%d", t.Name(), holder.FaasEnv.GenerateUniqueID()))
+	if !fsm.Lock(holder, holder.TxnId) {
+		t.Fatalf("%s cannot take a free lock", holder.TxnId)
+	}
+	return &fsm
+}
+
+func TestLockWithPolicy(t *testing.T) {
+	tests := []struct {
+		policy      LockPolicy
+		requesterTs int64
+		want        string
+	}{
+		{LockNoWait, 0, kLockBusy},
+		{LockNoWait, 2, kLockBusy},
+		{LockWaitTimeout, 0, kLockTimeout},
+		{LockWaitTimeout, 2, kLockTimeout},
+		{LockWaitDie, 0, kLockTimeout},
+		{LockWaitDie, 2, kLockDied},
+		{LockWoundWait, 0, kLockTimeout},
+		{LockWoundWait, 2, kLockTimeout},
+	}
+	for _, test := range tests {
+		withLockPolicy(t, test.policy)
+		fake := newFakeEnv()
+		fsm := lockHeldBy(t, txnEnv(fake, "holder", 1))
+		requester := txnEnv(fake, "requester", test.requesterTs)
+		if got := lockWithPolicy(requester, fsm); got != test.want {
+			t.Errorf("%s with requester at %d = %q, want %q", test.policy, test.requesterTs, got, test.want)
+		}
+		if fsm.holder() != "holder" {
+			t.Errorf("%s with requester at %d: lock moved to %s", test.policy, test.requesterTs, fsm.holder())
+		}
+	}
+}
+
+func TestLockWithPolicyWounds(t *testing.T) {
+	withLockPolicy(t, LockWoundWait)
+	fake := newFakeEnv()
+	holder := txnEnv(fake, "holder", 2)
+	fsm := lockHeldBy(t, holder)
+	older := txnEnv(fake, "older", 1)
+	lockWithPolicy(older, fsm)
+	if !isWounded(older, "holder") {
+		t.Fatal("older requester did not wound the holder")
+	}
+	if isWounded(older, "older") {
+		t.Fatal("older requester wounded itself")
+	}
+	// The wounded holder fails its next Lock, even of a free lock
+	free := getOrCreateLockFsm(t.Name() + "-free")
+	if got := lockWithPolicy(holder, &free); got != kLockWounded {
+		t.Errorf("wounded holder locking = %q, want %q", got, kLockWounded)
+	}
+	if got := lockWithPolicy(older, &free); got != "" {
+		t.Errorf("older requester locking a free lock = %q", got)
+	}
+}
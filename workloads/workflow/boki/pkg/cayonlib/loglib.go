@@ -62,7 +62,7 @@ func (fsm *IntentFsm) Catch(env *Env) {
 	}
 	for {
 		logEntry, err := env.FaasEnv.SharedLogReadNext(env.FaasCtx, tag, seqNum)
-		CHECK(err)
+		checkStep(err)
 		if logEntry == nil {
 			break
 		}
@@ -145,7 +145,7 @@ func LibAppendLog(env *Env, tag uint64, data interface{}) uint64 {
 	CHECK(err)
 	encoded := snappy.Encode(nil, serializedData)
 	seqNum, err := env.FaasEnv.SharedLogAppend(env.FaasCtx, []uint64{tag}, encoded)
-	CHECK(err)
+	checkStep(err)
 	return seqNum
 }
 
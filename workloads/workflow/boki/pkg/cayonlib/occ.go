@@ -0,0 +1,428 @@
+package cayonlib
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+)
+
+// Transaction modes. 2PL transactions lock keys as they are accessed. OCC
+// transactions record the VERSION of keys they read, buffer their writes,
+// and validate and apply everything at commit in one TransactWriteItems.
+const (
+	TxnMode2PL = "2pl"
+	TxnModeOCC = "occ"
+)
+
+// TXN_MODE is the mode of transactions started by BeginTxn, read from the
+// TXN_MODE environment variable
+var TXN_MODE = parseTxnMode(os.Getenv("TXN_MODE"))
+
+// DynamoDB limits the number of items in one TransactWriteItems
+const kMaxOCCTxnItems = 100
+
+// DynamoDB returns the first outcome of a TransactWriteItems retried with the
+// same ClientRequestToken only within this many milliseconds
+const kOCCTokenExpiry = 10 * 60 * 1000
+
+// Outcome of an OCC commit on the transaction status stream, which follows
+// a kTxnCommitting record appended before TransactWriteItems
+const kTxnCommitted = "committed"
+
+func parseTxnMode(value string) string {
+	switch value {
+	case "":
+		return TxnMode2PL
+	case TxnMode2PL, TxnModeOCC:
+		return value
+	default:
+		panic(fmt.Sprintf("Unknown transaction mode: %s", value))
+	}
+}
+
+// TxnRead reads key within the current transaction, in either mode. Like
+// TPLRead, it returns false if the transaction has to abort.
+func TxnRead(env *Env, tablename string, key string) (bool, interface{}, error) {
+	if env.TxnMode == TxnModeOCC {
+		item, err := OCCRead(env, tablename, key)
+		return err == nil, item, err
+	}
+	return TPLRead(env, tablename, key)
+}
+
+// TxnWrite writes value at key within the current transaction, in either
+// mode. Like TPLWrite, it returns false if the transaction has to abort.
+func TxnWrite(env *Env, tablename string, key string, value aws.JSONValue) (bool, error) {
+	if env.TxnMode == TxnModeOCC {
+		err := OCCWrite(env, tablename, key, value)
+		return err == nil, err
+	}
+	return TPLWrite(env, tablename, key, value)
+}
+
+// libReadVersioned returns V of key and its VERSION, or "" if key was never
+// written by CondWrite. VERSION is kept as a string, as seqnums may not fit
+// in the float64 JSON decodes numbers to.
+func libReadVersioned(tablename string, key string) (interface{}, string) {
+	Key, err := dynamodbattribute.MarshalMap(aws.JSONValue{"K": key})
+	CHECK(err)
+	expr, err := expression.NewBuilder().WithProjection(BuildProjection([]string{"V", "VERSION"})).Build()
+	CHECK(err)
+	res, err := DBClient.GetItem(&dynamodb.GetItemInput{
+		TableName:                aws.String(kTablePrefix + tablename),
+		Key:                      Key,
+		ProjectionExpression:     expr.Projection(),
+		ExpressionAttributeNames: expr.Names(),
+		ConsistentRead:           aws.Bool(true),
+	})
+	checkStep(err)
+	var value interface{}
+	if item, ok := res.Item["V"]; ok {
+		CHECK(dynamodbattribute.Unmarshal(item, &value))
+	}
+	version := ""
+	if item, ok := res.Item["VERSION"]; ok && item.N != nil {
+		version = *item.N
+	}
+	return value, version
+}
+
+// OCCRead reads key and records its VERSION in the transaction stream. It
+// does not see writes of the same transaction, which are applied at commit.
+func OCCRead(env *Env, tablename string, key string) (result interface{}, err error) {
+	defer recoverStep(&err)
+	step := env.StepNumber
+	newLog := false
+	intentLog := env.Fsm.GetStepLog(step)
+	if intentLog != nil {
+		env.StepNumber += 1
+	} else {
+		value, version := libReadVersioned(tablename, key)
+		newLog, intentLog = ProposeNextStep(env, aws.JSONValue{
+			"type":    "OCCRead",
+			"key":     key,
+			"table":   tablename,
+			"result":  value,
+			"version": version,
+		})
+	}
+	if !newLog {
+		CheckLogDataField(intentLog, "type", "OCCRead")
+		CheckLogDataField(intentLog, "key", key)
+		CheckLogDataField(intentLog, "table", tablename)
+		log.Printf("[INFO] Seen OCCRead log for step %d", intentLog.StepNumber)
+		// Only the first read of a key is validated, so the read is appended
+		// on replay only if the instance crashed before appending it
+		if occReadLogged(env, tablename, key) {
+			return intentLog.Data["result"], nil
+		}
+	}
+	LibAppendLog(env, TransactionStreamTag(env.LambdaId, env.TxnId), &TxnLogEntry{
+		LambdaId: env.LambdaId,
+		TxnId:    env.TxnId,
+		Callee:   "",
+		WriteOp:  aws.JSONValue{},
+		ReadOp: aws.JSONValue{
+			"tablename": tablename,
+			"key":       key,
+			"version":   intentLog.Data["version"],
+		},
+	})
+	return intentLog.Data["result"], nil
+}
+
+// occReadLogged returns true if the transaction stream of env has a read of
+// key by env.LambdaId
+func occReadLogged(env *Env, tablename string, key string) bool {
+	for _, txnLog := range getAllTxnLogs(env) {
+		if txnLog.ReadOp != nil && txnLog.ReadOp["tablename"] == tablename && txnLog.ReadOp["key"] == key {
+			return true
+		}
+	}
+	return false
+}
+
+// occApplied returns true if the writes of a transaction with the given
+// VERSION were applied, i.e. its TransactWriteItems succeeded before. As
+// writes are applied atomically, checking one written item is enough. It
+// returns false for transactions without writes, whose aborts have no effect,
+// and if a later transaction overwrote the item since.
+func occApplied(items map[string]*occItem, order []string, version uint64) bool {
+	for _, id := range order {
+		item := items[id]
+		if item.update == nil {
+			continue
+		}
+		_, applied := libReadVersioned(item.tablename, item.key)
+		return applied == strconv.FormatUint(version, 10)
+	}
+	return false
+}
+
+// OCCWrite buffers a write of value at key until commit
+func OCCWrite(env *Env, tablename string, key string, value aws.JSONValue) (err error) {
+	defer recoverStep(&err)
+	LibAppendLog(env, TransactionStreamTag(env.LambdaId, env.TxnId), &TxnLogEntry{
+		LambdaId: env.LambdaId,
+		TxnId:    env.TxnId,
+		Callee:   "",
+		WriteOp: aws.JSONValue{
+			"tablename": tablename,
+			"key":       key,
+			"value":     value,
+		},
+	})
+	return nil
+}
+
+// occItem is what an OCC transaction did to one key
+type occItem struct {
+	tablename string
+	key       string
+	read      bool
+	version   string
+	update    map[string]interface{}
+}
+
+// collectOCCItems merges transaction logs of lambdaId and, recursively, of
+// its callees. The first read of a key decides the version to validate, and
+// later writes to a key overwrite earlier ones.
+func collectOCCItems(env *Env, lambdaId string, items map[string]*occItem, order *[]string, visited map[string]bool) {
+	if visited[lambdaId] {
+		return
+	}
+	visited[lambdaId] = true
+	txnEnv := &Env{
+		LambdaId: lambdaId,
+		TxnId:    env.TxnId,
+		FaasCtx:  env.FaasCtx,
+		FaasEnv:  env.FaasEnv,
+	}
+	for _, txnLog := range getAllTxnLogs(txnEnv) {
+		if txnLog.Callee != "" {
+			collectOCCItems(env, txnLog.Callee, items, order, visited)
+			continue
+		}
+		op := txnLog.WriteOp
+		if txnLog.ReadOp != nil {
+			op = txnLog.ReadOp
+		}
+		tablename := op["tablename"].(string)
+		key := op["key"].(string)
+		id := fmt.Sprintf("%s-%s", tablename, key)
+		item, exists := items[id]
+		if !exists {
+			item = &occItem{tablename: tablename, key: key}
+			items[id] = item
+			*order = append(*order, id)
+		}
+		if txnLog.ReadOp != nil {
+			if !item.read && item.update == nil {
+				item.read = true
+				item.version = op["version"].(string)
+			}
+			continue
+		}
+		if item.update == nil {
+			item.update = make(map[string]interface{})
+		}
+		for k, v := range op["value"].(map[string]interface{}) {
+			item.update[k] = v
+		}
+	}
+}
+
+func occVersionCondition(item *occItem) expression.ConditionBuilder {
+	if item.version == "" {
+		return expression.AttributeNotExists(expression.Name("VERSION"))
+	}
+	return expression.Name("VERSION").Equal(expression.Value(dynamodbattribute.Number(item.version)))
+}
+
+// occTransactItem validates the read version of item, and applies its
+// writes along with a new VERSION
+func occTransactItem(item *occItem, version uint64) *dynamodb.TransactWriteItem {
+	Key, err := dynamodbattribute.MarshalMap(aws.JSONValue{"K": item.key})
+	CHECK(err)
+	tablename := aws.String(kTablePrefix + item.tablename)
+	if item.update == nil {
+		expr, err := expression.NewBuilder().WithCondition(occVersionCondition(item)).Build()
+		CHECK(err)
+		return &dynamodb.TransactWriteItem{
+			ConditionCheck: &dynamodb.ConditionCheck{
+				TableName:                 tablename,
+				Key:                       Key,
+				ConditionExpression:       expr.Condition(),
+				ExpressionAttributeNames:  expr.Names(),
+				ExpressionAttributeValues: expr.Values(),
+			},
+		}
+	}
+	// Sorted, so that a retry sends an identical request for the token
+	names := make([]string, 0, len(item.update))
+	for k := range item.update {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	updateBuilder := expression.UpdateBuilder{}
+	for _, k := range names {
+		updateBuilder = updateBuilder.Set(expression.Name(k), expression.Value(item.update[k]))
+	}
+	updateBuilder = updateBuilder.Set(expression.Name("VERSION"), expression.Value(version))
+	builder := expression.NewBuilder().WithUpdate(updateBuilder)
+	if item.read {
+		builder = builder.WithCondition(occVersionCondition(item))
+	}
+	expr, err := builder.Build()
+	CHECK(err)
+	return &dynamodb.TransactWriteItem{
+		Update: &dynamodb.Update{
+			TableName:                 tablename,
+			Key:                       Key,
+			ConditionExpression:       expr.Condition(),
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+			UpdateExpression:          expr.Update(),
+		},
+	}
+}
+
+// occCommitStatus returns the kTxnCommitting record and the outcome logged
+// by the OCC commit of env.TxnId at step, if any
+func occCommitStatus(env *Env, step int32) (committing *TxnStatusLogEntry, outcome string) {
+	for _, statusLog := range getTxnStatusLogs(env, env.TxnId) {
+		if statusLog.Step != step {
+			continue
+		}
+		switch statusLog.Status {
+		case kTxnCommitting:
+			if committing == nil {
+				committing = statusLog
+			}
+		case kTxnCommitted, kTxnAborted:
+			if outcome == "" {
+				outcome = statusLog.Status
+			}
+		}
+	}
+	return committing, outcome
+}
+
+// occRequestToken returns the ClientRequestToken of the OCC commit of txnId
+// at step. An instance may run several transactions with the same TxnId, and
+// tokens are at most 36 characters long.
+func occRequestToken(txnId string, step int32) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s-%d", txnId, step)))
+	return hex.EncodeToString(sum[:16])
+}
+
+// occTransactWrite validates and applies items in one TransactWriteItems,
+// and returns false if validation fails. committing is the record of an
+// earlier attempt, which may have been applied. The token makes a retry
+// within kOCCTokenExpiry return the first outcome, instead of failing
+// validation against its own writes. Later, a failed validation is checked
+// against the VERSION written by the commit, and if a later transaction
+// overwrote that too, the outcome is unknown and the commit fails.
+func occTransactWrite(env *Env, items map[string]*occItem, order []string, preCommitLog *IntentLogEntry, committing *TxnStatusLogEntry) bool {
+	transactItems := make([]*dynamodb.TransactWriteItem, 0, len(items))
+	for _, id := range order {
+		transactItems = append(transactItems, occTransactItem(items[id], preCommitLog.SeqNum))
+	}
+	_, err := DBClient.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+		TransactItems:      transactItems,
+		ClientRequestToken: aws.String(occRequestToken(env.TxnId, preCommitLog.StepNumber)),
+	})
+	if err == nil {
+		return true
+	}
+	if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != dynamodb.ErrCodeTransactionCanceledException {
+		checkStep(err)
+	}
+	if occApplied(items, order, preCommitLog.SeqNum) {
+		return true
+	}
+	if committing != nil && nowMillis()-committing.Ts > kOCCTokenExpiry {
+		panic(NewError("OCCOutcomeUnknown", fmt.Sprintf("Transaction %s may have committed more than %d ms ago", env.TxnId, kOCCTokenExpiry)))
+	}
+	return false
+}
+
+// OCCCommitTxn validates and applies the current OCC transaction, including
+// writes of its callees, and returns false if it aborts due to conflicts.
+// The outcome is logged as a step result, so replay does not commit again.
+func OCCCommitTxn(env *Env) (committed bool, err error) {
+	defer recoverStep(&err)
+	newLog, preCommitLog := ProposeNextStep(env, aws.JSONValue{
+		"type":  "PreOCCCommit",
+		"txnId": env.TxnId,
+	})
+	if !newLog {
+		CheckLogDataField(preCommitLog, "type", "PreOCCCommit")
+		log.Printf("[INFO] Seen PreOCCCommit log for step %d", preCommitLog.StepNumber)
+		resultLog := FetchStepResultLog(env, preCommitLog.StepNumber, false /* catch */)
+		if resultLog != nil {
+			CheckLogDataField(resultLog, "type", "PostOCCCommit")
+			log.Printf("[INFO] Seen PostOCCCommit log for step %d", preCommitLog.StepNumber)
+			committed = resultLog.Data["committed"].(bool)
+			resetTxn(env)
+			return committed, nil
+		}
+	}
+
+	items := make(map[string]*occItem)
+	order := make([]string, 0)
+	collectOCCItems(env, env.LambdaId, items, &order, make(map[string]bool))
+	if len(items) > kMaxOCCTxnItems {
+		panic(NewError("TxnTooLarge", fmt.Sprintf("Transaction %s accesses %d keys, more than %d", env.TxnId, len(items), kMaxOCCTxnItems)))
+	}
+	committed = true
+	if len(items) > 0 {
+		// The outcome is logged on the transaction status stream as soon as
+		// it is known, so that a retry never has to infer it from the items
+		committing, outcome := occCommitStatus(env, preCommitLog.StepNumber)
+		if outcome != "" {
+			committed = outcome == kTxnCommitted
+		} else {
+			if committing == nil {
+				LibAppendLog(env, TxnStatusStreamTag(env.TxnId), &TxnStatusLogEntry{
+					TxnId:  env.TxnId,
+					Status: kTxnCommitting,
+					Step:   preCommitLog.StepNumber,
+					Ts:     nowMillis(),
+				})
+			}
+			committed = occTransactWrite(env, items, order, preCommitLog, committing)
+			outcome = kTxnAborted
+			if committed {
+				outcome = kTxnCommitted
+			}
+			LibAppendLog(env, TxnStatusStreamTag(env.TxnId), &TxnStatusLogEntry{
+				TxnId:  env.TxnId,
+				Status: outcome,
+				Step:   preCommitLog.StepNumber,
+			})
+		}
+	}
+
+	if committed {
+		log.Printf("[INFO] Commit transaction %s", env.TxnId)
+	} else {
+		log.Printf("[WARN] Abort transaction %s due to conflicts", env.TxnId)
+	}
+	LogStepResult(env, env.InstanceId, preCommitLog.StepNumber, aws.JSONValue{
+		"type":      "PostOCCCommit",
+		"committed": committed,
+	})
+	resetTxn(env)
+	return committed, nil
+}
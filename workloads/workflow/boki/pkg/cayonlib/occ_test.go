@@ -0,0 +1,193 @@
+package cayonlib
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+)
+
+func appendTxnLog(env *Env, lambdaId string, txnLog *TxnLogEntry) {
+	txnLog.LambdaId = lambdaId
+	txnLog.TxnId = env.TxnId
+	if txnLog.WriteOp == nil {
+		txnLog.WriteOp = aws.JSONValue{}
+	}
+	LibAppendLog(env, TransactionStreamTag(lambdaId, env.TxnId), txnLog)
+}
+
+func readOp(key string, version string) aws.JSONValue {
+	return aws.JSONValue{"tablename": "t", "key": key, "version": version}
+}
+
+func writeOp(key string, value aws.JSONValue) aws.JSONValue {
+	return aws.JSONValue{"tablename": "t", "key": key, "value": value}
+}
+
+func TestCollectOCCItems(t *testing.T) {
+	env := newTestEnv(newFakeEnv())
+	env.LambdaId = "frontend"
+	env.TxnId = "txn"
+	appendTxnLog(env, "frontend", &TxnLogEntry{ReadOp: readOp("a", "5")})
+	appendTxnLog(env, "frontend", &TxnLogEntry{WriteOp: writeOp("a", aws.JSONValue{"V.Cap": 1})})
+	appendTxnLog(env, "frontend", &TxnLogEntry{ReadOp: readOp("a", "7")})
+	appendTxnLog(env, "frontend", &TxnLogEntry{Callee: "hotel"})
+	appendTxnLog(env, "frontend", &TxnLogEntry{WriteOp: writeOp("b", aws.JSONValue{"V.Cap": 2, "V.Name": "x"})})
+	appendTxnLog(env, "frontend", &TxnLogEntry{WriteOp: writeOp("b", aws.JSONValue{"V.Cap": 3})})
+	appendTxnLog(env, "frontend", &TxnLogEntry{WriteOp: writeOp("d", aws.JSONValue{"V.Cap": 4})})
+	appendTxnLog(env, "frontend", &TxnLogEntry{ReadOp: readOp("d", "9")})
+	appendTxnLog(env, "hotel", &TxnLogEntry{ReadOp: readOp("e", "")})
+	// Invoking an instance of a function already visited adds nothing
+	appendTxnLog(env, "hotel", &TxnLogEntry{Callee: "frontend"})
+
+	items := make(map[string]*occItem)
+	order := make([]string, 0)
+	collectOCCItems(env, env.LambdaId, items, &order, make(map[string]bool))
+
+	wantOrder := []string{"t-a", "t-e", "t-b", "t-d"}
+	if !reflect.DeepEqual(order, wantOrder) {
+		t.Fatalf("order = %v, want %v", order, wantOrder)
+	}
+	tests := []struct {
+		id     string
+		read   bool
+		ver    string
+		update map[string]interface{}
+	}{
+		// The first read decides the version, even if written later
+		{"t-a", true, "5", map[string]interface{}{"V.Cap": float64(1)}},
+		{"t-e", true, "", nil},
+		// Later writes overwrite fields of earlier ones
+		{"t-b", false, "", map[string]interface{}{"V.Cap": float64(3), "V.Name": "x"}},
+		// Reads of own writes are not validated
+		{"t-d", false, "", map[string]interface{}{"V.Cap": float64(4)}},
+	}
+	for _, test := range tests {
+		item := items[test.id]
+		if item.read != test.read || item.version != test.ver || !reflect.DeepEqual(item.update, test.update) {
+			t.Errorf("%s = {read: %v, version: %q, update: %v}, want {read: %v, version: %q, update: %v}",
+				test.id, item.read, item.version, item.update, test.read, test.ver, test.update)
+		}
+	}
+}
+
+func TestOCCVersionCondition(t *testing.T) {
+	tests := []struct {
+		version string
+		want    string
+	}{
+		{"", "attribute_not_exists (#0)"},
+		{"42", "#0 = :0"},
+	}
+	for _, test := range tests {
+		expr, err := expression.NewBuilder().WithCondition(occVersionCondition(&occItem{version: test.version})).Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := *expr.Condition(); got != test.want {
+			t.Errorf("condition for version %q = %s, want %s", test.version, got, test.want)
+		}
+		if *expr.Names()["#0"] != "VERSION" {
+			t.Errorf("condition for version %q is on %s", test.version, *expr.Names()["#0"])
+		}
+		if test.version != "" && *expr.Values()[":0"].N != test.version {
+			t.Errorf("condition for version %q compares to %s", test.version, *expr.Values()[":0"].N)
+		}
+	}
+}
+
+func TestOCCTransactItem(t *testing.T) {
+	update := map[string]interface{}{"V.Cap": float64(1), "V.Name": "x", "V.Id": "h"}
+	tests := []struct {
+		name      string
+		item      *occItem
+		check     bool
+		condition bool
+	}{
+		{"read", &occItem{tablename: "t", key: "k", read: true, version: "5"}, true, true},
+		{"write", &occItem{tablename: "t", key: "k", update: update}, false, false},
+		{"read and write", &occItem{tablename: "t", key: "k", read: true, version: "5", update: update}, false, true},
+	}
+	for _, test := range tests {
+		transactItem := occTransactItem(test.item, 42)
+		if test.check {
+			if transactItem.ConditionCheck == nil || transactItem.Update != nil {
+				t.Errorf("%s: want a ConditionCheck, got %v", test.name, transactItem)
+				continue
+			}
+			if !strings.HasSuffix(*transactItem.ConditionCheck.TableName, "t") {
+				t.Errorf("%s: table %s", test.name, *transactItem.ConditionCheck.TableName)
+			}
+			continue
+		}
+		if transactItem.Update == nil || transactItem.ConditionCheck != nil {
+			t.Errorf("%s: want an Update, got %v", test.name, transactItem)
+			continue
+		}
+		if (transactItem.Update.ConditionExpression != nil) != test.condition {
+			t.Errorf("%s: condition = %v", test.name, transactItem.Update.ConditionExpression)
+		}
+		versionSet := false
+		for placeholder, name := range transactItem.Update.ExpressionAttributeNames {
+			if *name == "VERSION" && strings.Contains(*transactItem.Update.UpdateExpression, placeholder) {
+				versionSet = true
+			}
+		}
+		if !versionSet {
+			t.Errorf("%s: VERSION is not updated by %s", test.name, *transactItem.Update.UpdateExpression)
+		}
+		// Retries must send the same request for the ClientRequestToken
+		if again := occTransactItem(test.item, 42); !reflect.DeepEqual(again, transactItem) {
+			t.Errorf("%s: requests differ:\n%v\n%v", test.name, transactItem, again)
+		}
+	}
+}
+
+func TestOCCCommitStatus(t *testing.T) {
+	env := newTestEnv(newFakeEnv())
+	env.TxnId = "txn"
+	appendStatus := func(status string, step int32) {
+		LibAppendLog(env, TxnStatusStreamTag("txn"), &TxnStatusLogEntry{TxnId: "txn", Status: status, Step: step})
+	}
+	// An earlier transaction of the same instance
+	appendStatus(kTxnCommitting, 1)
+	appendStatus(kTxnAborted, 1)
+	appendStatus(kTxnCommitting, 5)
+
+	committing, outcome := occCommitStatus(env, 5)
+	if committing == nil || committing.Step != 5 || outcome != "" {
+		t.Errorf("occCommitStatus after committing = %+v, %q, want the record at step 5 and no outcome", committing, outcome)
+	}
+	appendStatus(kTxnCommitted, 5)
+	appendStatus(kTxnAborted, 5)
+	if _, outcome := occCommitStatus(env, 5); outcome != kTxnCommitted {
+		t.Errorf("occCommitStatus outcome = %q, want the first one, %q", outcome, kTxnCommitted)
+	}
+	if committing, outcome := occCommitStatus(env, 9); committing != nil || outcome != "" {
+		t.Errorf("occCommitStatus of a step without records = %+v, %q", committing, outcome)
+	}
+}
+
+func TestOCCRequestToken(t *testing.T) {
+	long := strings.Repeat("x", 64)
+	tokens := map[string]bool{}
+	for _, token := range []string{
+		occRequestToken("txn", 1),
+		occRequestToken("txn", 2),
+		occRequestToken("txn-1", 2),
+		occRequestToken(long, 1),
+	} {
+		if len(token) > 36 {
+			t.Errorf("token %s is longer than 36 characters", token)
+		}
+		tokens[token] = true
+	}
+	if len(tokens) != 4 {
+		t.Errorf("tokens are not distinct: %v", tokens)
+	}
+	if occRequestToken("txn", 1) != occRequestToken("txn", 1) {
+		t.Error("a retry gets a different token")
+	}
+}
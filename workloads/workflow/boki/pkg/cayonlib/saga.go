@@ -0,0 +1,96 @@
+package cayonlib
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// Saga runs a sequence of steps without locks. Each step that succeeds
+// registers a compensation, and a failure runs the compensations registered
+// so far in reverse order. Steps and compensations are ordinary cayonlib
+// code, so their reads, writes and invocations are logged in the intent step
+// stream like any others. Saga only adds markers to that stream, and relies
+// on replay re-registering the same compensations: an instance restarted
+// during compensation replays the failed step and the compensations already
+// done, then continues with the remaining ones.
+type Saga struct {
+	env           *Env
+	names         []string
+	compensations []func() error
+	aborted       bool
+}
+
+func BeginSaga(env *Env) *Saga {
+	return &Saga{
+		env:           env,
+		names:         make([]string, 0),
+		compensations: make([]func() error, 0),
+		aborted:       false,
+	}
+}
+
+func (s *Saga) mark(data aws.JSONValue) {
+	newLog, markLog := ProposeNextStep(s.env, data)
+	if !newLog {
+		CheckLogDataField(markLog, "type", data["type"].(string))
+		CheckLogDataField(markLog, "name", data["name"].(string))
+		log.Printf("[INFO] Seen %s log for step %d", data["type"], markLog.StepNumber)
+	}
+}
+
+// Step runs action, and registers compensation if it returns true. Otherwise
+// it aborts the saga and returns false. compensation may be nil for steps
+// with nothing to undo.
+//
+// Step errors of action are returned without compensating, since running
+// the instance again resumes the saga. Application errors abort it. Steps
+// of an aborted saga fail with a SagaAborted error.
+func (s *Saga) Step(name string, action func() (bool, error), compensation func() error) (ok bool, err error) {
+	defer recoverStep(&err)
+	if s.aborted {
+		return false, NewError("SagaAborted", fmt.Sprintf("Step %s of an aborted saga", name))
+	}
+	s.mark(aws.JSONValue{"type": "SagaStep", "name": name})
+	ok, err = action()
+	if err != nil && IsStepError(err) {
+		return false, err
+	}
+	if err != nil || !ok {
+		log.Printf("[WARN] Saga step %s of instance %s failed", name, s.env.InstanceId)
+		if abortErr := s.Abort(); abortErr != nil {
+			return false, abortErr
+		}
+		return false, err
+	}
+	if compensation != nil {
+		s.names = append(s.names, name)
+		s.compensations = append(s.compensations, compensation)
+	}
+	return true, nil
+}
+
+// Abort runs the compensations of all succeeded steps in reverse order. It
+// is called by Step on failures, and may be called by the workflow when it
+// decides to give up after some steps succeeded.
+// Any error of a compensation stops the abort as a step error, even an
+// application error, so that the instance stays unfinished and a replay
+// resumes the abort from that compensation.
+func (s *Saga) Abort() (err error) {
+	defer recoverStep(&err)
+	if s.aborted {
+		return nil
+	}
+	s.aborted = true
+	for i := len(s.compensations) - 1; i >= 0; i-- {
+		s.mark(aws.JSONValue{"type": "SagaCompensate", "name": s.names[i]})
+		CHECK(asStepError(s.compensations[i]()))
+	}
+	s.mark(aws.JSONValue{"type": "SagaAborted", "name": ""})
+	return nil
+}
+
+func (s *Saga) Aborted() bool {
+	return s.aborted
+}
@@ -0,0 +1,70 @@
+package cayonlib
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func sagaEnv(fake *fakeEnv) *Env {
+	return newInstanceEnv(fake, "saga")
+}
+
+// runSaga runs three steps, the last of which fails, and returns the names
+// of the compensations run
+func runSaga(t *testing.T, env *Env, compensationErr error) ([]string, error) {
+	compensated := make([]string, 0)
+	saga := BeginSaga(env)
+	for _, name := range []string{"first", "second"} {
+		name := name
+		ok, err := saga.Step(name, func() (bool, error) { return true, nil }, func() error {
+			compensated = append(compensated, name)
+			if name == "second" {
+				return compensationErr
+			}
+			return nil
+		})
+		if !ok || err != nil {
+			t.Fatalf("step %s = %v, %v", name, ok, err)
+		}
+	}
+	ok, err := saga.Step("third", func() (bool, error) { return false, nil }, nil)
+	if ok {
+		t.Fatal("failed step returned true")
+	}
+	return compensated, err
+}
+
+func TestSagaAbort(t *testing.T) {
+	compensated, err := runSaga(t, sagaEnv(newFakeEnv()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"second", "first"}; !reflect.DeepEqual(compensated, want) {
+		t.Errorf("compensations ran in order %v, want %v", compensated, want)
+	}
+}
+
+func TestSagaAbortCompensationError(t *testing.T) {
+	fake := newFakeEnv()
+	compensated, err := runSaga(t, sagaEnv(fake), NewError("Full", "no room"))
+	if !IsStepError(err) {
+		t.Fatalf("failed compensation returned %v, want a step error", err)
+	}
+	var appErr *Error
+	if !errors.As(err, &appErr) || appErr.Type != "Full" {
+		t.Errorf("failed compensation returned %v, want it to wrap the compensation error", err)
+	}
+	if want := []string{"second"}; !reflect.DeepEqual(compensated, want) {
+		t.Errorf("compensations ran %v, want %v", compensated, want)
+	}
+
+	// A replay resumes the abort
+	compensated, err = runSaga(t, sagaEnv(fake), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"second", "first"}; !reflect.DeepEqual(compensated, want) {
+		t.Errorf("replay ran compensations %v, want %v", compensated, want)
+	}
+}
@@ -0,0 +1,217 @@
+package cayonlib
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"cs.utexas.edu/zjia/faas/types"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/golang/snappy"
+)
+
+// TimerLogEntry registers a timer of a sleeping instance on TimerLogTag, or
+// marks it fired
+type TimerLogEntry struct {
+	SeqNum     uint64 `json:"-"`
+	InstanceId string `json:"instanceId"`
+	StepNumber int32  `json:"step"`
+	FireAt     int64  `json:"fireAt"`
+	Fired      bool   `json:"fired"`
+}
+
+// sleepSignal unwinds the handler of an instance going to sleep, and is
+// recovered by runHandler
+type sleepSignal struct{}
+
+func nowMillis() int64 {
+	return time.Now().UnixNano() / int64(time.Millisecond)
+}
+
+// Sleep pauses the instance for d. The wake-up time is logged as a step, so
+// a replayed instance sleeps until the same time, and returns at once if it
+// has passed.
+//
+// An instance nobody waits on, i.e. an async callee or one invoked from
+// outside cayonlib, does not sleep in place. It registers a timer and
+// returns without finishing, and the timer service re-invokes it once the
+// timer fires, replaying it past the sleep. Clients invoking such an instance
+// directly get a "Sleeping" status with its InstanceId, and poll for its
+// output as described at OutputWrapper. Synchronous callees block their
+// caller anyway, so they sleep in place.
+func Sleep(env *Env, d time.Duration) error {
+	return SleepUntil(env, time.Now().Add(d))
+}
+
+func SleepUntil(env *Env, t time.Time) (err error) {
+	defer recoverStep(&err)
+	newLog, sleepLog := ProposeNextStep(env, aws.JSONValue{
+		"type":  "Sleep",
+		"until": t.UnixNano() / int64(time.Millisecond),
+	})
+	if !newLog {
+		CheckLogDataField(sleepLog, "type", "Sleep")
+		log.Printf("[INFO] Seen Sleep log for step %d", sleepLog.StepNumber)
+	}
+	until := int64(sleepLog.Data["until"].(float64))
+	remaining := time.Duration(until-nowMillis()) * time.Millisecond
+	if remaining <= 0 {
+		return nil
+	}
+	if !env.Detached {
+		time.Sleep(remaining)
+		return nil
+	}
+	log.Printf("[INFO] Instance %s sleeps until step %d fires in %s", env.InstanceId, sleepLog.StepNumber, remaining)
+	LibAppendLog(env, TimerLogTag, &TimerLogEntry{
+		InstanceId: env.InstanceId,
+		StepNumber: sleepLog.StepNumber,
+		FireAt:     until,
+		Fired:      false,
+	})
+	panic(sleepSignal{})
+}
+
+// runHandler runs f, and returns true instead of its output if the instance
+// went to sleep. Errors the handler panics with, e.g. from CHECK, are
+// returned like errors it returns.
+func runHandler(f func(*Env) (interface{}, error), env *Env) (output interface{}, err error, asleep bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(sleepSignal); ok {
+				asleep = true
+				return
+			}
+			recovered, ok := asError(r)
+			if !ok {
+				panic(r)
+			}
+			output, err = nil, recovered
+		}
+	}()
+	output, err = f(env)
+	return output, err, false
+}
+
+func getTimerLogs(env *Env) []*TimerLogEntry {
+	seqNum := uint64(0)
+	results := make([]*TimerLogEntry, 0)
+	for {
+		logEntry, err := env.FaasEnv.SharedLogReadNext(env.FaasCtx, TimerLogTag, seqNum)
+		checkStep(err)
+		if logEntry == nil {
+			break
+		}
+		decoded, err := snappy.Decode(nil, logEntry.Data)
+		CHECK(err)
+		var timerLog TimerLogEntry
+		CHECK(json.Unmarshal(decoded, &timerLog))
+		timerLog.SeqNum = logEntry.SeqNum
+		results = append(results, &timerLog)
+		seqNum = logEntry.SeqNum + 1
+	}
+	return results
+}
+
+type TimerResult struct {
+	Fired   int `json:"fired"`
+	Pending int `json:"pending"`
+}
+
+// pendingTimers returns the timers of timerLogs not fired yet, by instance
+// and step, along with their ids in the order they were registered. Timers of
+// the same sleep registered again by a replay count once.
+func pendingTimers(timerLogs []*TimerLogEntry) (map[string]*TimerLogEntry, []string) {
+	pending := make(map[string]*TimerLogEntry)
+	order := make([]string, 0)
+	for _, timerLog := range timerLogs {
+		id := fmt.Sprintf("%s-%d", timerLog.InstanceId, timerLog.StepNumber)
+		if timerLog.Fired {
+			delete(pending, id)
+		} else if _, exists := pending[id]; !exists {
+			pending[id] = timerLog
+			order = append(order, id)
+		}
+	}
+	return pending, order
+}
+
+// FireTimers re-invokes instances whose timers are due, and marks these
+// timers fired. TimerLogTag is then trimmed up to the first pending timer.
+func FireTimers(env *Env) TimerResult {
+	timerLogs := getTimerLogs(env)
+	pending, order := pendingTimers(timerLogs)
+
+	var intents map[string]*intentRecord
+	result := TimerResult{}
+	now := nowMillis()
+	trimPoint := uint64(0)
+	if len(timerLogs) > 0 {
+		trimPoint = timerLogs[len(timerLogs)-1].SeqNum + 1
+	}
+	for _, id := range order {
+		timerLog, exists := pending[id]
+		if !exists {
+			continue
+		}
+		if timerLog.FireAt > now {
+			result.Pending++
+			if timerLog.SeqNum < trimPoint {
+				trimPoint = timerLog.SeqNum
+			}
+			continue
+		}
+		if intents == nil {
+			intents, _ = scanIntents(env)
+		}
+		if intent, exists := intents[timerLog.InstanceId]; exists && !intent.Done {
+			log.Printf("[INFO] Wake up instance %s of %s", intent.InstanceId, intent.LambdaId)
+			restartInstance(env, intent)
+			result.Fired++
+		}
+		LibAppendLog(env, TimerLogTag, &TimerLogEntry{
+			InstanceId: timerLog.InstanceId,
+			StepNumber: timerLog.StepNumber,
+			FireAt:     timerLog.FireAt,
+			Fired:      true,
+		})
+	}
+	if trimPoint > 0 {
+		trimLog(env, TimerLogTag, trimPoint)
+	}
+	return result
+}
+
+type timerHandler struct {
+	env types.Environment
+}
+
+// Call runs FireTimers, ignoring its input
+func (h *timerHandler) Call(ctx context.Context, input []byte) (output []byte, err error) {
+	defer recoverStep(&err)
+	env := &Env{
+		LambdaId: "timer",
+		FaasCtx:  ctx,
+		FaasEnv:  h.env,
+	}
+	return json.Marshal(FireTimers(env))
+}
+
+type timerHandlerFactory struct {
+}
+
+func (f *timerHandlerFactory) New(env types.Environment, funcName string) (types.FuncHandler, error) {
+	return &timerHandler{env: env}, nil
+}
+
+func (f *timerHandlerFactory) GrpcNew(env types.Environment, service string) (types.GrpcFuncHandler, error) {
+	return nil, fmt.Errorf("Not implemented")
+}
+
+// CreateTimerHandlerFactory serves a function firing due timers on every
+// call. Timers fire late by up to the interval it is invoked at.
+func CreateTimerHandlerFactory() types.FuncHandlerFactory {
+	return &timerHandlerFactory{}
+}
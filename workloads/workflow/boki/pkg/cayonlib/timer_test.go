@@ -0,0 +1,114 @@
+package cayonlib
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func appendStartRecord(env *Env, instanceId string, lambdaId string) {
+	LibAppendLog(env, IntentLogTag, aws.JSONValue{
+		"InstanceId": instanceId,
+		"LambdaId":   lambdaId,
+		"TxnId":      "",
+		"CallerName": "",
+		"DONE":       false,
+		"ASYNC":      false,
+		"INPUT":      nil,
+		"ST":         0,
+	})
+}
+
+func appendTimer(env *Env, instanceId string, step int32, fireAt int64, fired bool) uint64 {
+	return LibAppendLog(env, TimerLogTag, &TimerLogEntry{
+		InstanceId: instanceId,
+		StepNumber: step,
+		FireAt:     fireAt,
+		Fired:      fired,
+	})
+}
+
+func TestFireTimers(t *testing.T) {
+	fake := newFakeEnv()
+	env := newTestEnv(fake)
+	now := nowMillis()
+	appendStartRecord(env, "due", "due-fn")
+	appendStartRecord(env, "fired", "fired-fn")
+	appendStartRecord(env, "pending", "pending-fn")
+
+	appendTimer(env, "due", 1, now-1000, false)
+	appendTimer(env, "fired", 1, now-1000, false)
+	appendTimer(env, "fired", 1, now-1000, true)
+	pendingSeqNum := appendTimer(env, "pending", 1, now+60000, false)
+	// Registered again by replays of the same sleep
+	appendTimer(env, "due", 1, now-1000, false)
+	appendTimer(env, "pending", 1, now+60000, false)
+
+	result := FireTimers(env)
+	if result != (TimerResult{Fired: 1, Pending: 1}) {
+		t.Errorf("FireTimers = %+v, want 1 fired and 1 pending", result)
+	}
+	if !reflect.DeepEqual(fake.invoked, []string{"due-fn"}) {
+		t.Errorf("FireTimers invoked %v, want [due-fn]", fake.invoked)
+	}
+	if fake.trimmed[TimerLogTag] != pendingSeqNum {
+		t.Errorf("TimerLogTag trimmed up to %d, want %d", fake.trimmed[TimerLogTag], pendingSeqNum)
+	}
+
+	// Fired timers are marked, so a second pass invokes nothing
+	result = FireTimers(env)
+	if result != (TimerResult{Fired: 0, Pending: 1}) {
+		t.Errorf("second FireTimers = %+v, want 1 pending", result)
+	}
+	if len(fake.invoked) != 1 {
+		t.Errorf("second FireTimers invoked %v", fake.invoked[1:])
+	}
+}
+
+func TestPoll(t *testing.T) {
+	fake := newFakeEnv()
+	runs := 0
+	fake.serve("sleeper", func(env *Env) (interface{}, error) {
+		runs++
+		if err := Sleep(env, time.Hour); err != nil {
+			return nil, err
+		}
+		return "awake", nil
+	})
+	call := func(iw InputWrapper) OutputWrapper {
+		output, err := fake.funcs["sleeper"].Call(context.Background(), iw.Serialize())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ow OutputWrapper
+		ow.Deserialize(output)
+		return ow
+	}
+
+	ow := call(InputWrapper{InstanceId: "sleeping", Input: nil})
+	if ow.Status != "Sleeping" || ow.InstanceId != "sleeping" {
+		t.Fatalf("sleeping instance returned %+v", ow)
+	}
+	if ow := call(InputWrapper{InstanceId: "sleeping", Poll: true}); ow.Status != "Sleeping" {
+		t.Errorf("poll of a sleeping instance returned %+v", ow)
+	}
+	if runs != 2 {
+		t.Errorf("the handler ran %d times, want 2", runs)
+	}
+
+	// Like an instance whose steps GC trimmed
+	ow = call(InputWrapper{InstanceId: "unknown", Poll: true})
+	if ow.Status != "Failure" || ow.ErrorType != "InstanceNotFound" {
+		t.Errorf("poll of an unknown instance returned %+v, want an InstanceNotFound failure", ow)
+	}
+	if runs != 2 {
+		t.Error("poll of an unknown instance ran the handler")
+	}
+	intents, _ := scanIntents(newTestEnv(fake))
+	if _, exists := intents["unknown"]; exists {
+		t.Error("poll of an unknown instance appended a start record")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"encoding/json"
 	"sync"
+	"time"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/golang/snappy"
 	// "github.com/aws/aws-sdk-go/service/dynamodb/expression"
@@ -16,6 +17,8 @@ type LockLogEntry struct {
 	StepNumber int32   `json:"step"`
 	UnlockOp   bool    `json:"unlockOp"`
 	Holder     string  `json:"holder"`
+	TxnTs      int64   `json:"txnTs"`
+	Expiry     int64   `json:"expiry"`
 }
 
 type LockFsm struct {
@@ -57,7 +60,7 @@ func (fsm *LockFsm) catch(env *Env) {
 	tag := LockStreamTag(fsm.lockId)
 	for {
 		logEntry, err := env.FaasEnv.SharedLogReadNext(env.FaasCtx, tag, fsm.tailSeqNum)
-		CHECK(err)
+		checkStep(err)
 		if logEntry == nil {
 			break
 		}
@@ -66,11 +69,16 @@ func (fsm *LockFsm) catch(env *Env) {
 		var lockLog LockLogEntry
 		err = json.Unmarshal(decoded, &lockLog)
 		CHECK(err)
+		if lockLog.LockId == fsm.lockId && fsm.tail == nil && lockLog.UnlockOp {
+			// GC trims a lock stream up to an unlock record, which then
+			// becomes the first record of the lock
+			fsm.stepNumber = lockLog.StepNumber
+		}
 		if lockLog.LockId == fsm.lockId && lockLog.StepNumber == fsm.stepNumber {
 			// log.Printf("[INFO] Found my log: seqnum=%d, step=%d", logEntry.SeqNum, lockLog.StepNumber)
 			lockLog.SeqNum = logEntry.SeqNum
 			if lockLog.UnlockOp {
-				if fsm.tail == nil || fsm.tail.UnlockOp || fsm.tail.Holder != lockLog.Holder {
+				if fsm.tail != nil && (fsm.tail.UnlockOp || fsm.tail.Holder != lockLog.Holder) {
 					panic(fmt.Sprintf("Invalid Unlock op for lock %s and holder %s", fsm.lockId, lockLog.Holder))
 				}
 			} else {
@@ -106,6 +114,8 @@ func (fsm *LockFsm) Lock(env *Env, holder string) bool {
 		StepNumber: fsm.stepNumber,
 		UnlockOp:   false,
 		Holder:     holder,
+		TxnTs:      env.TxnTs,
+		Expiry:     time.Now().Add(LOCK_LEASE).UnixNano() / int64(time.Millisecond),
 	})
 	fsm.catch(env)
 	return fsm.holder() == holder
@@ -125,30 +135,52 @@ func (fsm *LockFsm) Unlock(env *Env, holder string) {
 	})
 }
 
-func Lock(env *Env, tablename string, key string) bool {
+func Lock(env *Env, tablename string, key string) (locked bool, err error) {
+	defer recoverStep(&err)
 	lockId := fmt.Sprintf("%s-%s", tablename, key)
 	fsm := getOrCreateLockFsm(lockId)
-	success := fsm.Lock(env, env.TxnId)
+	cause := lockWithPolicy(env, &fsm)
 	storeBackLockFsm(fsm)
-	if !success {
-		log.Printf("[WARN] Failed to lock %s with txn %s", lockId, env.TxnId)
+	if cause != "" {
+		count := recordLockAbort(cause)
+		log.Printf("[WARN] Failed to lock %s with txn %s: %s (%d %s aborts so far)",
+			lockId, env.TxnId, cause, count, cause)
+		return false, nil
 	}
-	return success
+	return true, nil
 }
 
-func Unlock(env *Env, tablename string, key string) {
+func Unlock(env *Env, tablename string, key string) (err error) {
+	defer recoverStep(&err)
 	lockId := fmt.Sprintf("%s-%s", tablename, key)
 	fsm := getOrCreateLockFsm(lockId)
 	fsm.Unlock(env, env.TxnId)
 	storeBackLockFsm(fsm)
+	return nil
 }
 
-func TPLRead(env *Env, tablename string, key string) (bool, interface{}) {
-	if Lock(env, tablename, key) {
-		return true, Read(env, tablename, key)
-	} else {
-		return false, nil
+func TPLRead(env *Env, tablename string, key string) (ok bool, item interface{}, err error) {
+	defer recoverStep(&err)
+	locked, err := Lock(env, tablename, key)
+	if err != nil || !locked {
+		return false, nil, err
+	}
+	// Read locks are logged like writes, so that they are released on commit
+	// or abort, and found by ListLocks if the instance never gets there
+	if !occReadLogged(env, tablename, key) {
+		LibAppendLog(env, TransactionStreamTag(env.LambdaId, env.TxnId), &TxnLogEntry{
+			LambdaId: env.LambdaId,
+			TxnId:    env.TxnId,
+			Callee:   "",
+			WriteOp:  aws.JSONValue{},
+			ReadOp:   aws.JSONValue{
+				"tablename": tablename,
+				"key":       key,
+			},
+		})
 	}
+	item, err = Read(env, tablename, key)
+	return err == nil, item, err
 }
 
 type TxnLogEntry struct {
@@ -157,10 +189,14 @@ type TxnLogEntry struct {
 	TxnId    string        `json:"txnId"`
 	Callee   string        `json:"callee"`
 	WriteOp  aws.JSONValue `json:"write"`
+	ReadOp   aws.JSONValue `json:"read,omitempty"`
 }
 
-func TPLWrite(env *Env, tablename string, key string, value aws.JSONValue) bool {
-	if Lock(env, tablename, key) {
+func TPLWrite(env *Env, tablename string, key string, value aws.JSONValue) (written bool, err error) {
+	defer recoverStep(&err)
+	locked, err := Lock(env, tablename, key)
+	CHECK(err)
+	if locked {
 		tag := TransactionStreamTag(env.LambdaId, env.TxnId)
 		LibAppendLog(env, tag, &TxnLogEntry{
 			LambdaId: env.LambdaId,
@@ -172,29 +208,64 @@ func TPLWrite(env *Env, tablename string, key string, value aws.JSONValue) bool
 				"value":     value,
 			},
 		})
-		return true
+		return true, nil
 	} else {
-		return false
+		return false, nil
 	}
 }
 
-func BeginTxn(env *Env) {
+func BeginTxn(env *Env) (err error) {
+	defer recoverStep(&err)
 	env.TxnId = env.InstanceId
+	env.OwnsTxn = true
+	env.TxnMode = TXN_MODE
 	env.Instruction = "EXECUTE"
+	// The start time orders transactions for wait-die and wound-wait, so it
+	// is logged as a step to stay the same when the instance is replayed
+	_, beginLog := ProposeNextStep(env, aws.JSONValue{
+		"type": "BeginTxn",
+		"ts":   time.Now().UnixNano() / int64(time.Microsecond),
+	})
+	CheckLogDataField(beginLog, "type", "BeginTxn")
+	env.TxnTs = int64(beginLog.Data["ts"].(float64))
+	return nil
 }
 
-func CommitTxn(env *Env) {
+// CommitTxn returns false if the transaction aborts instead, because one of
+// its locks was broken after its lease expired
+func CommitTxn(env *Env) (committed bool, err error) {
+	defer recoverStep(&err)
+	if env.TxnMode == TxnModeOCC {
+		return OCCCommitTxn(env)
+	}
+	if !decideTxn(env, env.TxnId, kTxnCommitting) {
+		log.Printf("[WARN] Transaction %s lost a lock before commit", env.TxnId)
+		return false, AbortTxn(env)
+	}
 	log.Printf("[INFO] Commit transaction %s", env.TxnId)
 	env.Instruction = "COMMIT"
-	TPLCommit(env)
-	env.TxnId = ""
-	env.Instruction = ""
+	CHECK(asStepError(TPLCommit(env)))
+	resetTxn(env)
+	return true, nil
 }
 
-func AbortTxn(env *Env) {
+func AbortTxn(env *Env) (err error) {
+	defer recoverStep(&err)
 	log.Printf("[WARN] Abort transaction %s", env.TxnId)
+	if env.TxnMode == TxnModeOCC {
+		// Nothing was written or locked before commit
+		resetTxn(env)
+		return nil
+	}
+	decideTxn(env, env.TxnId, kTxnAborted)
 	env.Instruction = "ABORT"
-	TPLAbort(env)
+	CHECK(asStepError(TPLAbort(env)))
+	resetTxn(env)
+	return nil
+}
+
+func resetTxn(env *Env) {
 	env.TxnId = ""
+	env.TxnMode = ""
 	env.Instruction = ""
 }
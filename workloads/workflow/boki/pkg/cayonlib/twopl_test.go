@@ -0,0 +1,48 @@
+package cayonlib
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// failedCalleeEnv returns the root of a transaction with callee "hotel",
+// replaying an invocation of the callee that failed with an application error
+func failedCalleeEnv(fake *fakeEnv, instruction string) *Env {
+	env := newInstanceEnv(fake, "root")
+	env.LambdaId = "frontend"
+	env.TxnId = "root"
+	appendTxnLog(env, "frontend", &TxnLogEntry{Callee: "hotel"})
+	_, preInvokeLog := ProposeNextStep(env, aws.JSONValue{
+		"type":       "PreInvoke",
+		"instanceId": "callee",
+		"callee":     "hotel",
+		"input":      aws.JSONValue{},
+	})
+	LogStepResult(env, "root", preInvokeLog.StepNumber, aws.JSONValue{
+		"type":   "InvokeResult",
+		"output": nil,
+		"error":  aws.JSONValue{"type": "Full", "message": "no room"},
+	})
+	replay := newInstanceEnv(fake, "root")
+	replay.LambdaId = "frontend"
+	replay.TxnId = "root"
+	replay.Instruction = instruction
+	return replay
+}
+
+func TestTPLCalleeError(t *testing.T) {
+	tests := []struct {
+		instruction string
+		finish      func(*Env) error
+	}{
+		{"COMMIT", TPLCommit},
+		{"ABORT", TPLAbort},
+	}
+	for _, test := range tests {
+		env := failedCalleeEnv(newFakeEnv(), test.instruction)
+		if err := test.finish(env); !IsStepError(err) {
+			t.Errorf("%s with a failed callee = %v, want a step error", test.instruction, err)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+// Package typed wraps cayonlib steps with type parameters. Values are
+// converted through JSON, the same encoding used by the intent step log, so
+// a value decodes the same way whether it was just read from DynamoDB or
+// replayed from the log, and JSON tags of T apply to both.
+package typed
+
+import (
+	"encoding/json"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+	"github.com/eniac/Beldi/pkg/cayonlib"
+)
+
+// Decode converts a value returned by an untyped cayonlib step into T. A nil
+// value decodes to the zero value of T. Values that do not fit T are
+// application errors, since decoding them again fails the same way.
+func Decode[T any](value interface{}) (T, error) {
+	var result T
+	if value == nil {
+		return result, nil
+	}
+	encoded, err := json.Marshal(value)
+	if err == nil {
+		err = json.Unmarshal(encoded, &result)
+	}
+	if err != nil {
+		return result, cayonlib.NewError("DecodeError", err.Error())
+	}
+	return result, nil
+}
+
+// Encode converts value into what JSON decodes it to, so that it is stored
+// with the field names Decode expects
+func Encode[T any](value T) (interface{}, error) {
+	var result interface{}
+	encoded, err := json.Marshal(value)
+	if err == nil {
+		err = json.Unmarshal(encoded, &result)
+	}
+	if err != nil {
+		return nil, cayonlib.NewError("EncodeError", err.Error())
+	}
+	return result, nil
+}
+
+// Read returns the value at key, and false if key does not exist
+func Read[T any](env *cayonlib.Env, tablename string, key string) (T, bool, error) {
+	item, err := cayonlib.Read(env, tablename, key)
+	if err != nil {
+		var zero T
+		return zero, false, err
+	}
+	result, err := Decode[T](item)
+	return result, item != nil, err
+}
+
+// Write replaces the value at key
+func Write[T any](env *cayonlib.Env, tablename string, key string, value T) error {
+	encoded, err := Encode(value)
+	if err != nil {
+		return err
+	}
+	return cayonlib.Write(env, tablename, key, map[expression.NameBuilder]expression.OperandBuilder{
+		expression.Name("V"): expression.Value(encoded),
+	})
+}
+
+// TxnRead reads key within the current transaction, and returns false if
+// the transaction has to abort
+func TxnRead[T any](env *cayonlib.Env, tablename string, key string) (T, bool, error) {
+	ok, item, err := cayonlib.TxnRead(env, tablename, key)
+	if err != nil {
+		var zero T
+		return zero, false, err
+	}
+	result, err := Decode[T](item)
+	return result, ok, err
+}
+
+// SyncInvoke invokes callee with input, and returns its output along with
+// the instance id of the callee, or the error of the callee
+func SyncInvoke[In any, Out any](env *cayonlib.Env, callee string, input In) (Out, string, error) {
+	output, instanceId, err := cayonlib.SyncInvoke(env, callee, input)
+	if err != nil {
+		var zero Out
+		return zero, instanceId, err
+	}
+	result, err := Decode[Out](output)
+	return result, instanceId, err
+}
@@ -0,0 +1,128 @@
+package typed
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/eniac/Beldi/pkg/cayonlib"
+)
+
+type hotel struct {
+	HotelId   string
+	Cap       int32
+	Customers []string
+}
+
+type tagged struct {
+	Name  string `json:"name"`
+	Count int    `json:"count,omitempty"`
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  hotel
+	}{
+		{"nil", nil, hotel{}},
+		{"item", map[string]interface{}{
+			"HotelId":   "h1",
+			"Cap":       float64(3),
+			"Customers": []interface{}{"u1", "u2"},
+		}, hotel{HotelId: "h1", Cap: 3, Customers: []string{"u1", "u2"}}},
+		{"missing fields", map[string]interface{}{"Cap": float64(1)}, hotel{Cap: 1}},
+		{"unknown fields", map[string]interface{}{"HotelId": "h1", "Rate": 5}, hotel{HotelId: "h1"}},
+	}
+	for _, test := range tests {
+		got, err := Decode[hotel](test.value)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: Decode = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+	}{
+		{"wrong type", map[string]interface{}{"Cap": "full"}},
+		{"not an object", "h1"},
+		{"overflow", map[string]interface{}{"Cap": float64(1 << 40)}},
+	}
+	for _, test := range tests {
+		_, err := Decode[hotel](test.value)
+		var appErr *cayonlib.Error
+		if !errors.As(err, &appErr) || appErr.Type != "DecodeError" {
+			t.Errorf("%s: Decode error = %v, want a DecodeError", test.name, err)
+		}
+		if cayonlib.IsStepError(err) {
+			t.Errorf("%s: Decode returned a step error", test.name)
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  interface{}
+	}{
+		{"struct", hotel{HotelId: "h1", Cap: 2}, map[string]interface{}{
+			"HotelId":   "h1",
+			"Cap":       float64(2),
+			"Customers": nil,
+		}},
+		{"tags", tagged{Name: "n"}, map[string]interface{}{"name": "n"}},
+		{"number", int32(7), float64(7)},
+		{"nil slice", []string(nil), nil},
+	}
+	for _, test := range tests {
+		got, err := Encode(test.value)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: Encode = %#v, want %#v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestEncodeError(t *testing.T) {
+	_, err := Encode(make(chan int))
+	var appErr *cayonlib.Error
+	if !errors.As(err, &appErr) || appErr.Type != "EncodeError" {
+		t.Errorf("Encode error = %v, want an EncodeError", err)
+	}
+}
+
+// Reservations write V.Cap only, and the item read back must still decode
+func TestCapRoundTrip(t *testing.T) {
+	encoded, err := Encode(hotel{HotelId: "h1", Cap: 5, Customers: []string{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	item := encoded.(map[string]interface{})
+	decoded, err := Decode[hotel](item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	item["Cap"], err = Encode(decoded.Cap - 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Decode[hotel](item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := hotel{HotelId: "h1", Cap: 4, Customers: []string{}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Decode after V.Cap update = %+v, want %+v", got, want)
+	}
+}